@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/ui"
+)
+
+var certsWarnDays int
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Inspect OpenVPN certificates",
+}
+
+var certsCheckCmd = &cobra.Command{
+	Use:   "check [server...]",
+	Short: "Check OpenVPN certificates for expiry",
+	Long: `Check the CA and client certificates of OpenVPN servers, all of them or
+those named. The command fails if a certificate has expired, is not yet
+valid, cannot be parsed, or expires within --days (cert_warn_days in the
+config, 30 by default), so it can be run from monitoring.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var servers []*config.ServerConfig
+		if len(args) == 0 {
+			all, err := config.ListServers()
+			if err != nil {
+				return fmt.Errorf("failed to list servers: %w", err)
+			}
+			for _, s := range all {
+				if s.Protocol == "openvpn" {
+					servers = append(servers, s)
+				}
+			}
+		}
+		for _, name := range args {
+			server, err := config.LoadServer(name)
+			if err != nil {
+				return err
+			}
+			servers = append(servers, server)
+		}
+
+		warnDays := certsWarnDays
+		if !cmd.Flags().Changed("days") {
+			warnDays = certWarnDays()
+		}
+		now := time.Now()
+
+		var rows []ui.TableRow
+		problems := 0
+		for _, server := range servers {
+			certs, err := config.ServerCertificates(server)
+			if err != nil {
+				rows = append(rows, ui.TableRow{server.Name, "", "", "", err.Error()})
+				problems++
+				continue
+			}
+			for _, c := range certs {
+				status := c.Status(now, warnDays)
+				if status != config.CertValid {
+					problems++
+				}
+				rows = append(rows, ui.TableRow{server.Name, c.Role, c.Subject, c.NotAfter.Format("2006-01-02"), certStatusText(c, status, now)})
+			}
+		}
+		if len(rows) == 0 {
+			fmt.Println(ui.DimStyle.Render("No OpenVPN certificates to check"))
+			return nil
+		}
+
+		columns := []ui.TableColumn{
+			{Header: "Server", Width: 20},
+			{Header: "Certificate", Width: 11},
+			{Header: "Subject", Width: 28},
+			{Header: "Expires", Width: 10},
+			{Header: "Status", Width: 20},
+		}
+		fmt.Println(ui.RenderTable(columns, rows))
+		if problems > 0 {
+			return fmt.Errorf("%d certificate problem(s) found", problems)
+		}
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ All certificates valid for more than %d days", warnDays)))
+		return nil
+	},
+}
+
+// certWarnDays returns cert_warn_days from the config, or the default if it
+// cannot be read.
+func certWarnDays() int {
+	cfg, err := config.Load()
+	if err != nil {
+		return config.DefaultCertWarnDays
+	}
+	return cfg.CertWarnDays
+}
+
+// certStatusText describes a certificate's status for tables.
+func certStatusText(c config.CertificateInfo, status config.CertificateStatus, now time.Time) string {
+	switch status {
+	case config.CertExpired:
+		return "expired"
+	case config.CertNotYetValid:
+		return "not yet valid"
+	case config.CertExpiring:
+		return fmt.Sprintf("expires in %d days", c.DaysLeft(now))
+	}
+	return "ok"
+}
+
+// certWarnings returns a warning for each of the server's certificates that
+// is expired, not yet valid, or expires within warnDays.
+func certWarnings(server *config.ServerConfig, warnDays int, now time.Time) []string {
+	certs, err := config.ServerCertificates(server)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var warnings []string
+	for _, c := range certs {
+		role := "client"
+		if c.Role == "CA" {
+			role = "CA"
+		}
+		switch c.Status(now, warnDays) {
+		case config.CertExpired:
+			warnings = append(warnings, fmt.Sprintf("%s certificate %q expired on %s", role, c.Subject, c.NotAfter.Format("2006-01-02")))
+		case config.CertNotYetValid:
+			warnings = append(warnings, fmt.Sprintf("%s certificate %q is not valid until %s", role, c.Subject, c.NotBefore.Format("2006-01-02")))
+		case config.CertExpiring:
+			warnings = append(warnings, fmt.Sprintf("%s certificate %q expires in %d days (%s)", role, c.Subject, c.DaysLeft(now), c.NotAfter.Format("2006-01-02")))
+		}
+	}
+	return warnings
+}
+
+func init() {
+	certsCheckCmd.Flags().IntVar(&certsWarnDays, "days", config.DefaultCertWarnDays, "Report certificates expiring within this many days (default: cert_warn_days)")
+
+	certsCmd.AddCommand(certsCheckCmd)
+}
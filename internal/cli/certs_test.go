@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+// certPEM returns a self-signed certificate valid from notBefore to notAfter.
+func certPEM(t *testing.T, cn string, notBefore, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCertWarnings(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	server := &config.ServerConfig{
+		CACert:     certPEM(t, "Test CA", now.AddDate(-1, 0, 0), now.AddDate(0, 0, 10)),
+		ClientCert: certPEM(t, "alice", now.AddDate(-1, 0, 0), now.AddDate(0, 0, -1)),
+	}
+
+	warnings := certWarnings(server, 30, now)
+	want := []string{
+		`CA certificate "Test CA" expires in 10 days (2026-10-11)`,
+		`client certificate "alice" expired on 2026-09-30`,
+	}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("certWarnings() = %q, want %q", warnings, want)
+	}
+
+	if warnings := certWarnings(server, 5, now); len(warnings) != 1 {
+		t.Errorf("certWarnings() within 5 days = %q, want only the expired certificate", warnings)
+	}
+	if warnings := certWarnings(&config.ServerConfig{}, 30, now); len(warnings) != 0 {
+		t.Errorf("certWarnings() without certificates = %q, want none", warnings)
+	}
+	if warnings := certWarnings(&config.ServerConfig{CACert: "garbage"}, 30, now); len(warnings) != 1 {
+		t.Errorf("certWarnings() with a broken certificate = %q, want one warning", warnings)
+	}
+}
+
+func TestCertStatusText(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	c := config.CertificateInfo{NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(0, 0, 7)}
+	tests := map[config.CertificateStatus]string{
+		config.CertValid:       "ok",
+		config.CertExpiring:    "expires in 7 days",
+		config.CertExpired:     "expired",
+		config.CertNotYetValid: "not yet valid",
+	}
+	for status, want := range tests {
+		if got := certStatusText(c, status, now); got != want {
+			t.Errorf("certStatusText(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package cli
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/voidvpn/voidvpn/internal/config"
 	"github.com/voidvpn/voidvpn/internal/ui"
+	"github.com/voidvpn/voidvpn/internal/wireguard"
 )
 
 var configCmd = &cobra.Command{
@@ -28,6 +30,9 @@ var configShowCmd = &cobra.Command{
 		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Default Server:"), ui.ValueStyle.Render(cfg.DefaultServer))
 		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Auto Connect:"), ui.ValueStyle.Render(fmt.Sprintf("%v", cfg.AutoConnect)))
 		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Kill Switch:"), ui.ValueStyle.Render(fmt.Sprintf("%v", cfg.KillSwitch)))
+		fmt.Printf("%s %s\n", ui.LabelStyle.Render("WireGuard Backend:"), ui.ValueStyle.Render(cfg.WireGuardBackend))
+		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Disable UAPI:"), ui.ValueStyle.Render(fmt.Sprintf("%v", cfg.DisableUAPI)))
+		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Cert Warn Days:"), ui.ValueStyle.Render(strconv.Itoa(cfg.CertWarnDays)))
 		fmt.Printf("%s %s\n", ui.LabelStyle.Render("DNS Fallback:"), ui.ValueStyle.Render(fmt.Sprintf("%v", cfg.DNSFallback)))
 		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Config Path:"), ui.DimStyle.Render(config.ConfigFile()))
 
@@ -39,10 +44,13 @@ var configSetCmd = &cobra.Command{
 	Use:   "set <key> <value>",
 	Short: "Set a configuration value",
 	Long: `Set a configuration value. Available keys:
-  log_level       - Logging level (debug, info, warn, error)
-  default_server  - Default server for quick connect
-  auto_connect    - Auto-connect on startup (true/false)
-  kill_switch     - Block traffic if VPN drops (true/false)`,
+  log_level         - Logging level (debug, info, warn, error)
+  default_server    - Default server for quick connect
+  auto_connect      - Auto-connect on startup (true/false)
+  kill_switch       - Block traffic if VPN drops (true/false)
+  wireguard_backend - WireGuard implementation (auto, kernel, wireguard-go)
+  disable_uapi      - Don't expose the tunnel to wg(8) over UAPI (true/false)
+  cert_warn_days    - Warn this many days before an OpenVPN certificate expires`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key, value := args[0], args[1]
@@ -52,6 +60,16 @@ var configSetCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		if key == "wireguard_backend" {
+			if _, err := wireguard.ParseBackend(value); err != nil {
+				return err
+			}
+		}
+		if key == "cert_warn_days" {
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				return fmt.Errorf("invalid cert_warn_days %q: want a number of days", value)
+			}
+		}
 		if !cfg.Set(key, value) {
 			return fmt.Errorf("unknown config key: %s", key)
 		}
@@ -1,9 +1,13 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -16,20 +20,34 @@ import (
 	"github.com/voidvpn/voidvpn/internal/tunnel"
 	"github.com/voidvpn/voidvpn/internal/ui"
 	"github.com/voidvpn/voidvpn/internal/wireguard"
+	"golang.org/x/term"
 )
 
 var (
-	connectDaemon bool
+	connectDaemon    bool
+	connectUserspace bool
+	connectMTU       string
+	connectNetns     bool
+	connectSaveCreds bool
 )
 
 var connectCmd = &cobra.Command{
 	Use:   "connect [server]",
 	Short: "Connect to a VPN server",
-	Long:  "Connect to a configured VPN server (WireGuard or OpenVPN). Requires administrator/root privileges.",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Connect to a configured VPN server (WireGuard or OpenVPN). Requires administrator/root privileges.
+
+With --userspace, WireGuard runs on an in-process network stack instead of a
+TUN device. No privileges are needed and the host's addresses, routes and DNS
+are left untouched; only VoidVPN's local proxy listeners reach the tunnel.
+
+With --netns (or namespace: true in the server config), WireGuard's interface
+is moved into the network namespace voidvpn-<server> and configured there. The
+host's routes and DNS are left untouched; run programs through the tunnel with
+'voidvpn exec <server> -- <command>'. Linux only.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Require admin/root — needed for network adapter configuration
-		if !platform.IsAdmin() {
+		if !connectUserspace && !platform.IsAdmin() {
 			return fmt.Errorf("administrator/root privileges required.\nOn Windows: right-click terminal and select 'Run as administrator'\nOn Linux/macOS: use 'sudo voidvpn connect'")
 		}
 
@@ -59,37 +77,107 @@ var connectCmd = &cobra.Command{
 			return fmt.Errorf("server '%s' not found. Run 'voidvpn servers list' to see available servers", serverName)
 		}
 
+		if err := applyMTU(serverCfg, connectMTU); err != nil {
+			return err
+		}
+		if connectNetns {
+			serverCfg.Namespace = true
+		}
+
 		// Create the appropriate tunnel based on protocol
 		var tun tunnel.Tunnel
+		var ovpn *openvpn.Tunnel
+		credsFromKeystore := false
+		keyPassFromKeystore := false
+
+		if connectUserspace && serverCfg.Protocol == "openvpn" {
+			return fmt.Errorf("--userspace is only supported for WireGuard servers")
+		}
+		if serverCfg.Namespace && (connectUserspace || serverCfg.Protocol == "openvpn") {
+			return fmt.Errorf("namespace mode is only supported for WireGuard servers without --userspace")
+		}
+		if serverCfg.Namespace && (serverCfg.SOCKSProxy != nil || serverCfg.HTTPProxy != nil) {
+			return fmt.Errorf("SOCKS5 and HTTP proxies are not available in namespace mode; use 'voidvpn exec %s -- <command>'", serverCfg.Name)
+		}
 
 		switch serverCfg.Protocol {
 		case "openvpn":
+			if openvpn.NeedsCredentials(serverCfg) {
+				if credsFromKeystore, err = loadOpenVPNCredentials(serverCfg, connectSaveCreds); err != nil {
+					return err
+				}
+			}
+			if keyPassFromKeystore, err = loadOpenVPNKey(serverCfg, connectSaveCreds); err != nil {
+				return err
+			}
+			for _, w := range certWarnings(serverCfg, certWarnDays(), time.Now()) {
+				fmt.Println(ui.WarningStyle.Render("⚠ " + w))
+			}
 			// OpenVPN uses the Interactive Service on Windows — no admin required
-			tun = openvpn.NewTunnel(serverCfg)
+			ovpn = openvpn.NewTunnel(serverCfg)
+			tun = ovpn
 		default:
-			// WireGuard requires admin/root privileges
-			if !platform.IsAdmin() {
+			// WireGuard requires admin/root privileges unless it runs in userspace
+			if !connectUserspace && !platform.IsAdmin() {
 				return fmt.Errorf("administrator/root privileges required for WireGuard.\nOn Windows: right-click terminal and select 'Run as administrator'\nOn Linux/macOS: use 'sudo voidvpn connect'")
 			}
-			ks := keystore.New()
-			privateKey, err := ks.Load(serverName)
+			privateKey, err := loadPrivateKey(serverName)
 			if err != nil {
-				// Try default key
-				privateKey, err = ks.Load("default")
-				if err != nil {
-					return fmt.Errorf("no private key found for '%s'. Run 'voidvpn keygen --save' or import a config", serverName)
+				return err
+			}
+			if connectUserspace {
+				tun = wireguard.NewUserspaceTunnel(serverCfg, privateKey)
+				break
+			}
+			backend := wireguard.BackendAuto
+			if appCfg, err := config.Load(); err == nil {
+				if backend, err = wireguard.ParseBackend(appCfg.WireGuardBackend); err != nil {
+					return err
 				}
 			}
-			tun = wireguard.NewTunnel(serverCfg, privateKey)
+			// A kernel device is configured by name over netlink, which
+			// no longer finds it once it has moved into the namespace.
+			if serverCfg.Namespace {
+				backend = wireguard.BackendGo
+			}
+			if tun, err = wireguard.NewTunnelWithBackend(serverCfg, privateKey, backend); err != nil {
+				return err
+			}
 		}
 
 		fmt.Println(ui.Banner())
 
 		d := daemon.New(tun, serverCfg)
+		if appCfg, err := config.Load(); err == nil {
+			d.UAPI = !appCfg.DisableUAPI
+		}
 
 		// Pause logs before starting daemon to prevent interleaved output with spinner
 		logger.Pause()
 
+		// Show spinner while connecting
+		spinnerModel := ui.NewSpinner(fmt.Sprintf("Connecting to %s...", serverName))
+		p := tea.NewProgram(spinnerModel)
+
+		// One-time passwords and other challenges are asked for in the
+		// spinner while OpenVPN waits.
+		uiDone := make(chan struct{})
+		if ovpn != nil {
+			ovpn.SetChallengeFunc(func(prompt string, echo bool) (string, error) {
+				reply := make(chan string, 1)
+				p.Send(ui.ChallengeMsg{Prompt: prompt, Echo: echo, Reply: reply})
+				select {
+				case resp, ok := <-reply:
+					if !ok {
+						return "", fmt.Errorf("challenge cancelled")
+					}
+					return resp, nil
+				case <-uiDone:
+					return "", fmt.Errorf("challenge cancelled")
+				}
+			})
+		}
+
 		// Run daemon in background
 		connectErr := make(chan error, 1)
 		go func() {
@@ -97,22 +185,27 @@ var connectCmd = &cobra.Command{
 			connectErr <- d.Run(ctx)
 		}()
 
-		// Show spinner while connecting
-		spinnerModel := ui.NewSpinner(fmt.Sprintf("Connecting to %s...", serverName))
-		p := tea.NewProgram(spinnerModel)
-
 		go func() {
 			select {
 			case err := <-connectErr:
-				// Run() returned early — connection failed
-				p.Send(ui.ConnectMsg{Err: err})
+				// Run() returned early — connection failed. Hand the error
+				// back so the command exits with it after the spinner.
+				connectErr <- err
+				msg := ui.ConnectMsg{Err: err}
+				var hsErr *wireguard.HandshakeError
+				if errors.As(err, &hsErr) {
+					msg.Hint = hsErr.Hint()
+				}
+				p.Send(msg)
 			case <-d.Connected:
 				// Tunnel connected successfully
 				p.Send(ui.ConnectMsg{Err: nil})
 			}
 		}()
 
-		if _, err := p.Run(); err != nil {
+		_, err = p.Run()
+		close(uiDone)
+		if err != nil {
 			logger.Resume()
 			return fmt.Errorf("UI error: %w", err)
 		}
@@ -122,6 +215,18 @@ var connectCmd = &cobra.Command{
 
 		// If connection succeeded, keep running until daemon exits (Ctrl+C)
 		if err := <-connectErr; err != nil {
+			// Forget rejected credentials so the next attempt prompts again.
+			// A rejected challenge response says nothing about them.
+			if credsFromKeystore && errors.Is(err, openvpn.ErrAuthFailed) {
+				if keystore.New().Delete(credentialsKey(serverName)) == nil {
+					fmt.Println(ui.DimStyle.Render("  Removed the stored credentials; connect again to re-enter them."))
+				}
+			}
+			if keyPassFromKeystore && errors.Is(err, openvpn.ErrKeyPassphrase) {
+				if keystore.New().Delete(keyPassphraseKey(serverName)) == nil {
+					fmt.Println(ui.DimStyle.Render("  Removed the stored key passphrase; connect again to re-enter it."))
+				}
+			}
 			return err
 		}
 
@@ -129,8 +234,133 @@ var connectCmd = &cobra.Command{
 	},
 }
 
+// loadPrivateKey returns the server's private key, or the default key.
+func loadPrivateKey(serverName string) (string, error) {
+	ks := keystore.New()
+	privateKey, err := ks.Load(serverName)
+	if err != nil {
+		// Try default key
+		privateKey, err = ks.Load("default")
+		if err != nil {
+			return "", fmt.Errorf("no private key found for '%s'. Run 'voidvpn keygen --save' or import a config", serverName)
+		}
+	}
+	return privateKey, nil
+}
+
+// credentialsKey is the keystore entry holding a server's OpenVPN
+// username and password.
+func credentialsKey(serverName string) string {
+	return serverName + "-auth"
+}
+
+// loadOpenVPNCredentials fills in the server's missing username and password
+// from the keystore, or else prompts for them. Prompted credentials are
+// stored when save is set. It reports whether they came from the keystore.
+func loadOpenVPNCredentials(server *config.ServerConfig, save bool) (bool, error) {
+	if server.Username != "" && server.Password != "" {
+		return false, nil
+	}
+	ks := keystore.New()
+	if stored, err := ks.Load(credentialsKey(server.Name)); err == nil {
+		user, pass, _ := strings.Cut(stored, "\n")
+		if server.Username == "" || server.Username == user {
+			server.Username, server.Password = user, pass
+			return true, nil
+		}
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("server '%s' requires a username and password. Run 'voidvpn connect %s --save-credentials' in a terminal to store them", server.Name, server.Name)
+	}
+	fmt.Println(ui.LabelStyle.Render(fmt.Sprintf("Credentials for %s", server.Name)))
+	if server.Username == "" {
+		fmt.Print("  Username: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read username: %w", err)
+		}
+		server.Username = strings.TrimSpace(line)
+	}
+	fmt.Print("  Password: ")
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return false, fmt.Errorf("failed to read password: %w", err)
+	}
+	server.Password = string(pass)
+
+	if save {
+		if err := ks.Store(credentialsKey(server.Name), server.Username+"\n"+server.Password); err != nil {
+			return false, fmt.Errorf("failed to save credentials: %w", err)
+		}
+		fmt.Println(ui.SuccessStyle.Render("  ✓ Credentials saved to keystore"))
+	}
+	return false, nil
+}
+
+// clientKeyKey is the keystore entry holding a server's OpenVPN client key,
+// when ClientKeyInKeystore is set.
+func clientKeyKey(serverName string) string {
+	return serverName + "-key"
+}
+
+// keyPassphraseKey is the keystore entry holding the passphrase of a
+// server's encrypted OpenVPN client key.
+func keyPassphraseKey(serverName string) string {
+	return serverName + "-keypass"
+}
+
+// loadOpenVPNKey fills in a client key kept in the keystore and, if the key
+// is encrypted, its passphrase from the keystore or a prompt. A prompted
+// passphrase is stored when save is set. It reports whether the passphrase
+// came from the keystore.
+func loadOpenVPNKey(server *config.ServerConfig, save bool) (bool, error) {
+	if !server.ClientKeyInKeystore && !openvpn.NeedsKeyPassphrase(server) {
+		return false, nil
+	}
+	ks := keystore.New()
+	if server.ClientKeyInKeystore {
+		key, err := ks.Load(clientKeyKey(server.Name))
+		if err != nil {
+			return false, fmt.Errorf("client key for '%s' not found in the keystore. Import the profile again", server.Name)
+		}
+		server.ClientKey = key
+	}
+	if !openvpn.NeedsKeyPassphrase(server) {
+		return false, nil
+	}
+	if pass, err := ks.Load(keyPassphraseKey(server.Name)); err == nil {
+		server.KeyPassphrase = pass
+		return true, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("the client key of '%s' is encrypted. Run 'voidvpn connect %s --save-credentials' in a terminal to store its passphrase", server.Name, server.Name)
+	}
+	fmt.Print(ui.LabelStyle.Render(fmt.Sprintf("Passphrase for the %s client key: ", server.Name)))
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return false, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	server.KeyPassphrase = string(pass)
+
+	if save {
+		if err := ks.Store(keyPassphraseKey(server.Name), server.KeyPassphrase); err != nil {
+			return false, fmt.Errorf("failed to save key passphrase: %w", err)
+		}
+		fmt.Println(ui.SuccessStyle.Render("  ✓ Key passphrase saved to keystore"))
+	}
+	return false, nil
+}
+
 func init() {
 	connectCmd.Flags().BoolVar(&connectDaemon, "daemon", false, "Run in background (daemon mode)")
+	connectCmd.Flags().BoolVar(&connectUserspace, "userspace", false, "Run WireGuard on a userspace network stack (no root, no host routes)")
+	connectCmd.Flags().StringVar(&connectMTU, "mtu", "", "Override the server's tunnel MTU for this connection, or auto to probe the path")
+	connectCmd.Flags().BoolVar(&connectNetns, "netns", false, "Keep the tunnel in its own network namespace (Linux)")
+	connectCmd.Flags().BoolVar(&connectSaveCreds, "save-credentials", false, "Store prompted OpenVPN credentials and key passphrases in the keystore")
 
 	// Suppress usage on the unused variable
 	_ = os.Stdout
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/voidvpn/voidvpn/internal/daemon"
+	"github.com/voidvpn/voidvpn/internal/network"
+	"github.com/voidvpn/voidvpn/internal/platform"
+)
+
+var (
+	execBypass  bool
+	execOnlyVPN bool
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec (--bypass | --only-vpn | <server>) -- <command> [args...]",
+	Short: "Run a program inside or outside the VPN tunnel",
+	Long: `Run a program with its traffic forced around (--bypass) or through (--only-vpn)
+the active tunnel, regardless of the tunnel's routes. With --only-vpn the
+program loses network access if the tunnel goes down.
+
+Given a server connected with --netns instead, the program runs inside that
+server's network namespace, where the tunnel is the only way out and the
+server's DNS servers are used.
+
+Linux only; requires root and a running connection. The program runs as the
+user who invoked sudo.`,
+	Example: `  sudo voidvpn exec --bypass -- firefox
+  sudo voidvpn exec --only-vpn -- ssh build.corp.example
+  sudo voidvpn exec work -- curl https://intranet.example`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if execBypass && execOnlyVPN {
+			return fmt.Errorf("specify exactly one of --bypass or --only-vpn")
+		}
+		if !execBypass && !execOnlyVPN {
+			// exec <server> -- <command>: the server is the only argument
+			// before the dash
+			if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+				return fmt.Errorf("specify --bypass, --only-vpn or a server connected with --netns")
+			}
+			return execInNamespace(args[0], args[1:])
+		}
+		mode := network.AppOnlyVPN
+		if execBypass {
+			mode = network.AppBypass
+		}
+
+		if !platform.IsAdmin() {
+			return fmt.Errorf("root privileges required.\nUse 'sudo voidvpn exec ...'")
+		}
+		if !daemon.IsConnected() {
+			return fmt.Errorf("not connected. Run 'voidvpn connect' first")
+		}
+
+		resp, err := daemon.SendIPCRequestArgs("app-split", map[string]string{"mode": string(mode)})
+		if err != nil {
+			return fmt.Errorf("failed to contact daemon: %w", err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("failed to set up split tunneling: %s", resp.Error)
+		}
+
+		child := newExecChild(args)
+		release, err := network.PrepareAppCommand(child, resp.Data["cgroup"])
+		if err != nil {
+			return err
+		}
+		return runExecChild(child, release)
+	},
+}
+
+// execInNamespace runs a program in the network namespace of a server that
+// is connected in namespace mode.
+func execInNamespace(server string, args []string) error {
+	if !platform.IsAdmin() {
+		return fmt.Errorf("root privileges required.\nUse 'sudo voidvpn exec ...'")
+	}
+	state, err := daemon.LoadState()
+	if err != nil || !daemon.IsConnected() {
+		return fmt.Errorf("not connected. Run 'voidvpn connect --netns %s' first", server)
+	}
+	if state.Namespace != network.NamespaceName(server) {
+		return fmt.Errorf("'%s' is not connected in namespace mode. Run 'voidvpn connect --netns %s' first", server, server)
+	}
+
+	// Everything started from this goroutine from now on runs in the namespace
+	if err := network.EnterNamespace(state.Namespace); err != nil {
+		return err
+	}
+	return runExecChild(newExecChild(args), func() {})
+}
+
+func newExecChild(args []string) *exec.Cmd {
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	return child
+}
+
+// runExecChild starts child as the invoking user and exits with its exit
+// code. release frees resources held for the start.
+func runExecChild(child *exec.Cmd, release func()) error {
+	if err := platform.RunAsInvokingUser(child); err != nil {
+		release()
+		return err
+	}
+
+	// The terminal delivers Ctrl+C to the child directly; forward other
+	// termination signals and wait for it to exit.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	err := child.Start()
+	release()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", child.Args[0], err)
+	}
+	go func() {
+		for sig := range sigCh {
+			if sig != os.Interrupt {
+				child.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err = child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+func init() {
+	execCmd.Flags().BoolVar(&execBypass, "bypass", false, "Send the program's traffic around the tunnel")
+	execCmd.Flags().BoolVar(&execOnlyVPN, "only-vpn", false, "Only allow the program to use the tunnel")
+}
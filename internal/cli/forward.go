@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/voidvpn/voidvpn/internal/daemon"
+	"github.com/voidvpn/voidvpn/internal/ui"
+)
+
+var (
+	forwardReverse bool
+	forwardUDP     bool
+)
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "Manage port forwards through the tunnel",
+}
+
+var forwardAddCmd = &cobra.Command{
+	Use:   "add <local>:<remote>",
+	Short: "Forward a local port to a tunnel address, or expose one on the tunnel",
+	Long: `Forward a local port to an address inside the VPN, without adding routes.
+
+  voidvpn forward add 15432:10.20.0.5:5432
+
+makes 10.20.0.5:5432 reachable as localhost:15432. With --reverse the
+remote side is a port on the tunnel IP, so
+
+  voidvpn forward add --reverse 3000:8080
+
+exposes localhost:3000 to VPN peers as <tunnel-ip>:8080. The local side may
+include a host (127.0.0.1 by default). Works with kernel and userspace tunnels.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !daemon.IsConnected() {
+			return fmt.Errorf("not connected. Run 'voidvpn connect' first")
+		}
+		proto := "tcp"
+		if forwardUDP {
+			proto = "udp"
+		}
+		resp, err := daemon.SendIPCRequestArgs("forward-add", map[string]string{
+			"spec":    args[0],
+			"reverse": strconv.FormatBool(forwardReverse),
+			"proto":   proto,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to contact daemon: %w", err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("failed to add forward: %s", resp.Error)
+		}
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ Forward %s added, listening on %s", resp.Data["id"], resp.Data["listen"])))
+		return nil
+	},
+}
+
+var forwardRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Stop a port forward",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !daemon.IsConnected() {
+			return fmt.Errorf("not connected")
+		}
+		resp, err := daemon.SendIPCRequestArgs("forward-remove", map[string]string{"id": args[0]})
+		if err != nil {
+			return fmt.Errorf("failed to contact daemon: %w", err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("failed to remove forward: %s", resp.Error)
+		}
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ Forward %s removed", args[0])))
+		return nil
+	},
+}
+
+var forwardListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active port forwards",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !daemon.IsConnected() {
+			return fmt.Errorf("not connected")
+		}
+		resp, err := daemon.SendIPCRequest("status")
+		if err != nil {
+			return fmt.Errorf("failed to contact daemon: %w", err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("failed to get status: %s", resp.Error)
+		}
+		fmt.Println(ui.TitleStyle.Render("Port Forwards"))
+		fmt.Println()
+		fmt.Print(ui.RenderForwards(forwardRows(resp.State.Forwards)))
+		return nil
+	},
+}
+
+func forwardRows(forwards []daemon.ForwardInfo) []ui.ForwardRow {
+	var rows []ui.ForwardRow
+	for _, f := range forwards {
+		rows = append(rows, ui.ForwardRow{
+			ID:          f.ID,
+			Proto:       f.Proto,
+			Reverse:     f.Reverse,
+			Local:       f.Local,
+			Remote:      f.Remote,
+			Connections: f.Connections,
+		})
+	}
+	return rows
+}
+
+func init() {
+	forwardAddCmd.Flags().BoolVar(&forwardReverse, "reverse", false, "Expose a local port on the tunnel IP instead")
+	forwardAddCmd.Flags().BoolVar(&forwardUDP, "udp", false, "Forward UDP instead of TCP")
+
+	forwardCmd.AddCommand(forwardAddCmd)
+	forwardCmd.AddCommand(forwardRemoveCmd)
+	forwardCmd.AddCommand(forwardListCmd)
+}
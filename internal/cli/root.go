@@ -39,7 +39,11 @@ func init() {
 	rootCmd.AddCommand(disconnectCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(serversCmd)
+	rootCmd.AddCommand(certsCmd)
 	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(forwardCmd)
+	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(versionCmd)
 }
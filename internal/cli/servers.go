@@ -1,13 +1,22 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/voidvpn/voidvpn/internal/config"
 	"github.com/voidvpn/voidvpn/internal/keystore"
+	"github.com/voidvpn/voidvpn/internal/network"
+	"github.com/voidvpn/voidvpn/internal/openvpn"
+	"github.com/voidvpn/voidvpn/internal/proxy"
 	"github.com/voidvpn/voidvpn/internal/ui"
+	"golang.org/x/term"
 )
 
 var serversCmd = &cobra.Command{
@@ -49,6 +58,16 @@ var serversListCmd = &cobra.Command{
 		}
 
 		fmt.Println(ui.RenderTable(columns, rows))
+
+		warnDays, now := certWarnDays(), time.Now()
+		for _, s := range servers {
+			if s.Protocol != "openvpn" {
+				continue
+			}
+			for _, w := range certWarnings(s, warnDays, now) {
+				fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ %s: %s", s.Name, w)))
+			}
+		}
 		return nil
 	},
 }
@@ -68,6 +87,17 @@ var serversAddCmd = &cobra.Command{
 		publicKey, _ := cmd.Flags().GetString("public-key")
 		address, _ := cmd.Flags().GetString("address")
 		dns, _ := cmd.Flags().GetStringSlice("dns")
+		excludeIPs, _ := cmd.Flags().GetStringSlice("exclude-ips")
+		includeDomains, _ := cmd.Flags().GetStringSlice("include-domains")
+		excludeDomains, _ := cmd.Flags().GetStringSlice("exclude-domains")
+		routing, _ := cmd.Flags().GetString("routing")
+		socks, _ := cmd.Flags().GetString("socks")
+		socksUser, _ := cmd.Flags().GetString("socks-user")
+		socksPass, _ := cmd.Flags().GetString("socks-pass")
+		httpProxy, _ := cmd.Flags().GetString("http-proxy")
+		httpUser, _ := cmd.Flags().GetString("http-proxy-user")
+		httpPass, _ := cmd.Flags().GetString("http-proxy-pass")
+		mtu, _ := cmd.Flags().GetString("mtu")
 
 		if endpoint == "" || publicKey == "" || address == "" {
 			return fmt.Errorf("required flags: --endpoint, --public-key, --address")
@@ -81,6 +111,35 @@ var serversAddCmd = &cobra.Command{
 		if len(dns) > 0 {
 			server.DNS = dns
 		}
+		if len(excludeIPs) > 0 {
+			if _, err := network.ParsePrefixes(excludeIPs); err != nil {
+				return err
+			}
+			server.ExcludeIPs = excludeIPs
+		}
+		for _, d := range append(append([]string{}, includeDomains...), excludeDomains...) {
+			if err := network.ValidateDomainPattern(d); err != nil {
+				return err
+			}
+		}
+		server.IncludeDomains = includeDomains
+		server.ExcludeDomains = excludeDomains
+		if routing != "" {
+			if _, err := network.ParseRoutingStrategy(routing); err != nil {
+				return err
+			}
+			server.RoutingStrategy = routing
+		}
+		var err error
+		if server.SOCKSProxy, err = proxyConfig("--socks", socks, socksUser, socksPass); err != nil {
+			return err
+		}
+		if server.HTTPProxy, err = proxyConfig("--http-proxy", httpProxy, httpUser, httpPass); err != nil {
+			return err
+		}
+		if err := applyMTU(server, mtu); err != nil {
+			return err
+		}
 
 		if err := config.SaveServer(server); err != nil {
 			return fmt.Errorf("failed to save server: %w", err)
@@ -98,16 +157,164 @@ var serversRemoveCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
 
+		server, _ := config.LoadServer(name)
 		if err := config.RemoveServer(name); err != nil {
 			return err
 		}
+		removeServerSecrets(keystore.New(), name, server)
 
 		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ Server '%s' removed", name)))
 		return nil
 	},
 }
 
-var importName string
+var serversRoutesCmd = &cobra.Command{
+	Use:   "routes <name>",
+	Short: "Preview the routes a server will install",
+	Long:  "Show the route set computed from a server's allowed_ips minus its exclude_ips.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, err := config.LoadServer(args[0])
+		if err != nil {
+			return err
+		}
+
+		allowed, err := network.ComputeAllowedIPs(server.AllowedIPs, server.ExcludeIPs)
+		if err != nil {
+			return fmt.Errorf("failed to compute routes: %w", err)
+		}
+		strategy, err := network.ParseRoutingStrategy(server.RoutingStrategy)
+		if err != nil {
+			return err
+		}
+		routes := allowed
+		if strategy == network.RouteSplit {
+			routes = network.SplitDefaultRoutes(allowed)
+		}
+
+		fmt.Println(ui.TitleStyle.Render(fmt.Sprintf("Routes for '%s'", server.Name)))
+		fmt.Println()
+		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Strategy:"), ui.ValueStyle.Render(string(strategy)))
+		fmt.Printf("%s %s\n", ui.LabelStyle.Render("Allowed IPs:"), ui.ValueStyle.Render(strings.Join(server.AllowedIPs, ", ")))
+		if len(server.ExcludeIPs) > 0 {
+			fmt.Printf("%s %s\n", ui.LabelStyle.Render("Excluded IPs:"), ui.ValueStyle.Render(strings.Join(server.ExcludeIPs, ", ")))
+		}
+		if len(server.IncludeDomains) > 0 {
+			fmt.Printf("%s %s\n", ui.LabelStyle.Render("Include Domains:"), ui.ValueStyle.Render(strings.Join(server.IncludeDomains, ", ")))
+		}
+		if len(server.ExcludeDomains) > 0 {
+			fmt.Printf("%s %s\n", ui.LabelStyle.Render("Exclude Domains:"), ui.ValueStyle.Render(strings.Join(server.ExcludeDomains, ", ")))
+		}
+		fmt.Println()
+
+		columns := []ui.TableColumn{
+			{Header: "Route", Width: 43},
+			{Header: "Family", Width: 6},
+		}
+		var rows []ui.TableRow
+		for _, r := range routes {
+			family := "IPv4"
+			if r.Addr().Is6() {
+				family = "IPv6"
+			}
+			rows = append(rows, ui.TableRow{r.String(), family})
+		}
+		fmt.Println(ui.RenderTable(columns, rows))
+		if strategy == network.RoutePolicy {
+			fmt.Println(ui.DimStyle.Render(fmt.Sprintf("%d routes via tunnel in table %d, used by packets without fwmark %d", len(routes), network.PolicyRoutingMark, network.PolicyRoutingMark)))
+		} else {
+			fmt.Println(ui.DimStyle.Render(fmt.Sprintf("%d routes via tunnel, endpoint %s via default gateway", len(routes), network.ExtractEndpointHost(server.Endpoint))))
+		}
+		if len(server.IncludeDomains) > 0 || len(server.ExcludeDomains) > 0 {
+			fmt.Println(ui.DimStyle.Render("Domain host routes are added at connect time as names resolve."))
+		}
+		return nil
+	},
+}
+
+var serversShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a server's settings and certificates",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, err := config.LoadServer(args[0])
+		if err != nil {
+			return err
+		}
+
+		field := func(label, value string) {
+			if value != "" {
+				fmt.Printf("%s %s\n", ui.LabelStyle.Render(label+":"), ui.ValueStyle.Render(value))
+			}
+		}
+		fmt.Println(ui.TitleStyle.Render(fmt.Sprintf("Server '%s'", server.Name)))
+		fmt.Println()
+		field("Protocol", protocolLabel(server.Protocol))
+		field("Endpoint", server.Endpoint)
+		var remotes []string
+		for _, r := range server.Remotes {
+			remotes = append(remotes, net.JoinHostPort(r.Host, strconv.Itoa(r.Port)))
+		}
+		field("Remotes", strings.Join(remotes, ", "))
+		field("Address", server.Address)
+		field("DNS", strings.Join(server.DNS, ", "))
+		if server.Protocol != "openvpn" {
+			return nil
+		}
+
+		field("Transport", server.Proto)
+		if openvpn.NeedsCredentials(server) {
+			field("Username", server.Username)
+		}
+		field("Client key", clientKeyLocation(server))
+
+		certs, err := config.ServerCertificates(server)
+		if err != nil {
+			fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ %v", err)))
+		}
+		warnDays, now := certWarnDays(), time.Now()
+		var rows []ui.TableRow
+		for _, c := range certs {
+			rows = append(rows, ui.TableRow{
+				c.Role,
+				c.Subject,
+				c.NotBefore.Format("2006-01-02"),
+				c.NotAfter.Format("2006-01-02"),
+				certStatusText(c, c.Status(now, warnDays), now),
+			})
+		}
+		if len(rows) > 0 {
+			fmt.Println()
+			columns := []ui.TableColumn{
+				{Header: "Certificate", Width: 11},
+				{Header: "Subject", Width: 32},
+				{Header: "Valid From", Width: 10},
+				{Header: "Valid Until", Width: 11},
+				{Header: "Status", Width: 20},
+			}
+			fmt.Println(ui.RenderTable(columns, rows))
+		}
+		return nil
+	},
+}
+
+// clientKeyLocation describes where an OpenVPN server's client key is kept.
+func clientKeyLocation(server *config.ServerConfig) string {
+	switch {
+	case server.ClientKeyInKeystore:
+		return "keystore"
+	case openvpn.NeedsKeyPassphrase(server):
+		return "server file (encrypted)"
+	case server.ClientKey != "":
+		return "server file"
+	}
+	return "none"
+}
+
+var (
+	importName string
+	importP12  string
+)
 
 var serversImportCmd = &cobra.Command{
 	Use:   "import <file>",
@@ -163,7 +370,7 @@ func importWireGuard(path string) error {
 }
 
 func importOpenVPN(path string) error {
-	server, err := config.ImportOpenVPNConfig(path)
+	server, ignored, err := config.ImportOpenVPNConfig(path)
 	if err != nil {
 		return fmt.Errorf("failed to import config: %w", err)
 	}
@@ -176,6 +383,22 @@ func importOpenVPN(path string) error {
 		return fmt.Errorf("server '%s' already exists. Remove it first or rename the config file", server.Name)
 	}
 
+	if importP12 != "" {
+		if server.PKCS12, err = os.ReadFile(importP12); err != nil {
+			return fmt.Errorf("failed to read PKCS#12 bundle: %w", err)
+		}
+	}
+	if server.PKCS12 != nil {
+		if err := applyPKCS12(server); err != nil {
+			return err
+		}
+	}
+
+	// Secrets go to the keystore rather than the server file
+	if server.PKCS12 != nil || server.KeyPassphrase != "" || server.Password != "" {
+		storeImportedSecrets(keystore.New(), server)
+	}
+
 	if err := config.SaveServer(server); err != nil {
 		return fmt.Errorf("failed to save server: %w", err)
 	}
@@ -183,7 +406,119 @@ func importOpenVPN(path string) error {
 	fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ Imported OpenVPN server '%s'", server.Name)))
 	fmt.Printf("  %s %s\n", ui.LabelStyle.Render("Endpoint:"), server.Endpoint)
 	fmt.Printf("  %s %s\n", ui.LabelStyle.Render("Protocol:"), server.Proto)
+	if len(ignored) > 0 {
+		fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ Skipped unsupported directives: %s", strings.Join(ignored, ", "))))
+	}
+
+	return nil
+}
+
+// removeServerSecrets deletes the OpenVPN secrets kept in the keystore for a
+// removed server: the client key, its passphrase and the credentials, which
+// connect and import store whatever the server file says. server is nil if
+// the file could not be read, in which case they are deleted anyway.
+func removeServerSecrets(ks keystore.Keystore, name string, server *config.ServerConfig) {
+	if server != nil && server.Protocol != "openvpn" {
+		return
+	}
+	for _, key := range []string{clientKeyKey(name), keyPassphraseKey(name), credentialsKey(name)} {
+		_ = ks.Delete(key)
+	}
+}
 
+// storeImportedSecrets moves the client key of a PKCS#12 bundle, the askpass
+// passphrase and auth-user-pass credentials of an imported server to the
+// keystore. A client key that cannot be stored stays in the server file;
+// the passphrase and credentials are asked for at connect time instead.
+func storeImportedSecrets(ks keystore.Keystore, server *config.ServerConfig) {
+	if server.PKCS12 != nil {
+		if err := ks.Store(clientKeyKey(server.Name), server.ClientKey); err != nil {
+			fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ Failed to store client key, keeping it in the server file: %v", err)))
+		} else {
+			server.ClientKey = ""
+			server.ClientKeyInKeystore = true
+			fmt.Println(ui.SuccessStyle.Render("✓ Client key stored in keystore"))
+		}
+	}
+	if server.KeyPassphrase != "" {
+		if err := ks.Store(keyPassphraseKey(server.Name), server.KeyPassphrase); err != nil {
+			fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ Failed to store key passphrase: %v", err)))
+			fmt.Println(ui.DimStyle.Render("  It will be asked for at connect time"))
+		} else {
+			fmt.Println(ui.SuccessStyle.Render("✓ Key passphrase stored in keystore"))
+		}
+	}
+	if server.Password != "" {
+		if err := ks.Store(credentialsKey(server.Name), server.Username+"\n"+server.Password); err != nil {
+			fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("⚠ Failed to store credentials: %v", err)))
+			fmt.Println(ui.DimStyle.Render("  They will be asked for at connect time"))
+		} else {
+			fmt.Println(ui.SuccessStyle.Render("✓ Credentials stored in keystore"))
+		}
+		server.Username, server.Password = "", ""
+	}
+}
+
+// applyPKCS12 replaces the server's certificates and key with those of its
+// PKCS#12 bundle. Bundles without a password are decoded without asking.
+func applyPKCS12(server *config.ServerConfig) error {
+	bundle, err := config.DecodePKCS12(server.PKCS12, "")
+	if errors.Is(err, config.ErrPKCS12Password) {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("the PKCS#12 bundle is password protected. Import it in a terminal")
+		}
+		fmt.Print(ui.LabelStyle.Render("PKCS#12 password: "))
+		pass, readErr := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if readErr != nil {
+			return fmt.Errorf("failed to read password: %w", readErr)
+		}
+		bundle, err = config.DecodePKCS12(server.PKCS12, string(pass))
+	}
+	if err != nil {
+		return err
+	}
+
+	// A ca directive in the profile takes precedence over the bundle's chain
+	if server.CACert == "" {
+		server.CACert = bundle.CACert
+	}
+	server.ClientCert = bundle.ClientCert
+	server.ClientKey = bundle.ClientKey
+	return nil
+}
+
+// proxyConfig builds a proxy listener config from servers add flags, or nil
+// if the listener flag was not given.
+func proxyConfig(flag, listen, user, pass string) (*config.ProxyConfig, error) {
+	if listen == "" {
+		if user != "" {
+			return nil, fmt.Errorf("%s-user requires %s", flag, flag)
+		}
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		return nil, fmt.Errorf("invalid %s listen address %q: %w", flag, listen, err)
+	}
+	return &config.ProxyConfig{Listen: listen, Username: user, Password: pass}, nil
+}
+
+// applyMTU sets the server's MTU from a --mtu value: a number, "auto" to
+// probe the path on every connect, or "" to leave it unchanged.
+func applyMTU(server *config.ServerConfig, value string) error {
+	switch value {
+	case "":
+		return nil
+	case "auto":
+		server.AutoMTU = true
+		return nil
+	}
+	mtu, err := strconv.Atoi(value)
+	if err != nil || mtu < 576 || mtu > 65535 {
+		return fmt.Errorf("invalid --mtu %q: want auto or a number from 576 to 65535", value)
+	}
+	server.MTU = mtu
+	server.AutoMTU = false
 	return nil
 }
 
@@ -201,11 +536,27 @@ func init() {
 	serversAddCmd.Flags().String("public-key", "", "Server's WireGuard public key")
 	serversAddCmd.Flags().String("address", "", "Tunnel IP address (e.g., 10.0.0.2/24)")
 	serversAddCmd.Flags().StringSlice("dns", nil, "DNS servers (comma-separated)")
+	serversAddCmd.Flags().StringSlice("exclude-ips", nil, "CIDRs to keep outside the tunnel (comma-separated)")
+	serversAddCmd.Flags().StringSlice("include-domains", nil, "Domains to route through the tunnel, e.g. *.corp.example (comma-separated)")
+	serversAddCmd.Flags().StringSlice("exclude-domains", nil, "Domains to keep outside the tunnel (comma-separated)")
+	serversAddCmd.Flags().String("routing", "", "Routing strategy: split (default) or policy (fwmark + dedicated table, Linux)")
+	serversAddCmd.Flags().String("socks", "", "Run a SOCKS5 proxy through the tunnel on this address (default "+proxy.DefaultSOCKSAddr+")")
+	serversAddCmd.Flags().Lookup("socks").NoOptDefVal = proxy.DefaultSOCKSAddr
+	serversAddCmd.Flags().String("socks-user", "", "Require this SOCKS5 username")
+	serversAddCmd.Flags().String("socks-pass", "", "SOCKS5 password for --socks-user")
+	serversAddCmd.Flags().String("http-proxy", "", "Run an HTTP proxy through the tunnel on this address (default "+proxy.DefaultHTTPAddr+")")
+	serversAddCmd.Flags().Lookup("http-proxy").NoOptDefVal = proxy.DefaultHTTPAddr
+	serversAddCmd.Flags().String("http-proxy-user", "", "Require this HTTP proxy username")
+	serversAddCmd.Flags().String("http-proxy-pass", "", "HTTP proxy password for --http-proxy-user")
+	serversAddCmd.Flags().String("mtu", "", "Tunnel MTU, or auto to probe the path to the endpoint (default 1420)")
 
 	serversImportCmd.Flags().StringVar(&importName, "name", "", "Custom name for the imported server")
+	serversImportCmd.Flags().StringVar(&importP12, "p12", "", "PKCS#12 bundle with the OpenVPN client certificate and key")
 
 	serversCmd.AddCommand(serversListCmd)
 	serversCmd.AddCommand(serversAddCmd)
 	serversCmd.AddCommand(serversRemoveCmd)
 	serversCmd.AddCommand(serversImportCmd)
+	serversCmd.AddCommand(serversRoutesCmd)
+	serversCmd.AddCommand(serversShowCmd)
 }
@@ -69,15 +69,31 @@ func renderState(state *daemon.ConnectionState) error {
 	}
 
 	info := ui.StatusInfo{
-		Connected:   true,
-		Protocol:    state.Protocol,
-		ServerName:  state.Server,
-		Endpoint:    state.Endpoint,
-		TunnelIP:    state.TunnelIP,
-		ConnectedAt: state.ConnectedAt,
-		TxBytes:     state.TxBytes,
-		RxBytes:     state.RxBytes,
+		Connected:        true,
+		Protocol:         state.Protocol,
+		ServerName:       state.Server,
+		Endpoint:         state.Endpoint,
+		TunnelIP:         state.TunnelIP,
+		ConnectedAt:      state.ConnectedAt,
+		TxBytes:          state.TxBytes,
+		RxBytes:          state.RxBytes,
+		LastHandshake:    state.LastHandshake,
+		HandshakePending: state.HandshakePending,
+		Userspace:        state.Userspace,
+		Namespace:        state.Namespace,
+		SOCKSProxy:       state.SOCKSProxy,
+		HTTPProxy:        state.HTTPProxy,
 	}
+	for _, c := range state.ProxyConnections {
+		info.ProxyConns = append(info.ProxyConns, ui.ProxyConn{
+			Proxy:   c.Proxy,
+			Target:  c.Target,
+			Started: c.Started,
+			TxBytes: c.TxBytes,
+			RxBytes: c.RxBytes,
+		})
+	}
+	info.Forwards = forwardRows(state.Forwards)
 	fmt.Print(ui.RenderStatus(info))
 	return nil
 }
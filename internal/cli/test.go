@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/ui"
+	"github.com/voidvpn/voidvpn/internal/wireguard"
+)
+
+var (
+	testGateway string
+	testResolve string
+	testTimeout time.Duration
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test <server>",
+	Short: "Check a server profile without changing the host network",
+	Long: `Bring a WireGuard server up on a private userspace network stack and
+check that it works: the handshake completes, the tunnel gateway answers a
+ping, and a name resolves through the server's DNS. No routes, addresses or
+DNS settings are changed, and no root privileges are needed.
+
+The gateway defaults to the first address of the tunnel subnet, or the first
+DNS server for /32 addresses; override it with --gateway.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverCfg, err := config.LoadServer(args[0])
+		if err != nil {
+			return fmt.Errorf("server '%s' not found. Run 'voidvpn servers list' to see available servers", args[0])
+		}
+		if serverCfg.Protocol == "openvpn" {
+			return fmt.Errorf("test is only supported for WireGuard servers")
+		}
+		gateway, err := probeGateway(serverCfg, testGateway)
+		if err != nil {
+			return err
+		}
+		privateKey, err := loadPrivateKey(args[0])
+		if err != nil {
+			return err
+		}
+
+		tun := wireguard.NewUserspaceTunnel(serverCfg, privateKey)
+		steps := runProbe(tun, serverCfg, gateway)
+		tun.Disconnect()
+
+		fmt.Print(ui.RenderProbeReport(serverCfg.Name, steps))
+		for _, s := range steps {
+			if s.Err != nil {
+				return fmt.Errorf("connectivity test failed")
+			}
+		}
+		return nil
+	},
+}
+
+// runProbe connects tun and runs each check, skipping the rest once the
+// tunnel is down.
+func runProbe(tun *wireguard.Tunnel, server *config.ServerConfig, gateway netip.Addr) []ui.ProbeStep {
+	start := time.Now()
+	err := tun.Connect(context.Background())
+	handshake := ui.ProbeStep{Name: "Handshake", Duration: time.Since(start), Detail: server.Endpoint, Err: err}
+	var hsErr *wireguard.HandshakeError
+	if errors.As(err, &hsErr) {
+		handshake.Err = fmt.Errorf("%w. %s", err, hsErr.Hint())
+	}
+	if err != nil {
+		return []ui.ProbeStep{
+			handshake,
+			{Name: "Gateway RTT", Skipped: true, Detail: "tunnel is down"},
+			{Name: "DNS", Skipped: true, Detail: "tunnel is down"},
+		}
+	}
+	return []ui.ProbeStep{handshake, probePing(tun, gateway), probeDNS(tun, server)}
+}
+
+func probePing(tun *wireguard.Tunnel, gateway netip.Addr) ui.ProbeStep {
+	step := ui.ProbeStep{Name: "Gateway RTT", Detail: gateway.String()}
+	if !gateway.IsValid() {
+		step.Skipped = true
+		step.Detail = "no gateway known; use --gateway"
+		return step
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	step.Duration, step.Err = tun.Ping(ctx, gateway)
+	return step
+}
+
+func probeDNS(tun *wireguard.Tunnel, server *config.ServerConfig) ui.ProbeStep {
+	step := ui.ProbeStep{Name: "DNS"}
+	if len(server.DNS) == 0 {
+		step.Skipped = true
+		step.Detail = "no DNS servers configured"
+		return step
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	start := time.Now()
+	addrs, err := tun.LookupHost(ctx, testResolve)
+	step.Duration = time.Since(start)
+	if err != nil {
+		step.Err = fmt.Errorf("resolving %s via %s: %w", testResolve, strings.Join(server.DNS, ", "), err)
+		return step
+	}
+	step.Detail = fmt.Sprintf("%s → %s", testResolve, strings.Join(addrs, ", "))
+	return step
+}
+
+// probeGateway picks the address to ping: override if set, else the first
+// host of the tunnel subnet, else the first DNS server. The zero Addr means
+// none is known.
+func probeGateway(server *config.ServerConfig, override string) (netip.Addr, error) {
+	if override != "" {
+		addr, err := netip.ParseAddr(override)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid --gateway %q: %w", override, err)
+		}
+		return addr, nil
+	}
+	first, _, _ := strings.Cut(server.Address, ",")
+	if prefix, err := wireguard.ParseAddress(strings.TrimSpace(first)); err == nil && prefix.Bits() < prefix.Addr().BitLen()-1 {
+		if gw := prefix.Masked().Addr().Next(); gw != prefix.Addr() {
+			return gw, nil
+		}
+	}
+	for _, dns := range server.DNS {
+		if addr, err := netip.ParseAddr(dns); err == nil {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, nil
+}
+
+func init() {
+	testCmd.Flags().StringVar(&testGateway, "gateway", "", "Address to ping inside the tunnel")
+	testCmd.Flags().StringVar(&testResolve, "resolve", "example.com", "Name to resolve with the server's DNS")
+	testCmd.Flags().DurationVar(&testTimeout, "timeout", 5*time.Second, "Timeout for the ping and DNS checks")
+}
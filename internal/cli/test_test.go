@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+func TestProbeGateway(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		dns      []string
+		override string
+		want     string
+	}{
+		{"subnet", "10.0.0.2/24", nil, "", "10.0.0.1"},
+		{"dual stack", "10.8.0.5/16, fd00::5/64", nil, "", "10.8.0.1"},
+		{"host address uses DNS", "10.64.1.2/32", []string{"10.64.0.1"}, "", "10.64.0.1"},
+		{"own address is first host", "10.0.0.1/24", []string{"10.0.0.53"}, "", "10.0.0.53"},
+		{"override", "10.0.0.2/24", nil, "10.0.0.254", "10.0.0.254"},
+		{"unknown", "10.64.1.2/32", nil, "", "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeGateway(&config.ServerConfig{Address: tt.address, DNS: tt.dns}, tt.override)
+			if err != nil {
+				t.Fatalf("probeGateway() error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("probeGateway() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := probeGateway(&config.ServerConfig{}, "not-an-ip"); err == nil {
+		t.Error("probeGateway should reject an invalid override")
+	}
+}
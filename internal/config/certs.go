@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ErrPKCS12Password is returned when a PKCS#12 bundle cannot be decrypted
+// with the given password.
+var ErrPKCS12Password = errors.New("incorrect PKCS#12 password")
+
+// PKCS12Bundle is the content of a PKCS#12 (.p12/.pfx) file as PEM.
+type PKCS12Bundle struct {
+	CACert     string // CA certificates, if the bundle has any
+	ClientCert string
+	ClientKey  string // unencrypted PKCS#8
+}
+
+// DecodePKCS12 decodes a PKCS#12 bundle. The client certificate is the one
+// matching the private key; other certificates are taken as the CA chain.
+func DecodePKCS12(data []byte, password string) (*PKCS12Bundle, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		var notImplemented pkcs12.NotImplementedError
+		switch {
+		case errors.Is(err, pkcs12.ErrIncorrectPassword):
+			return nil, ErrPKCS12Password
+		case errors.As(err, &notImplemented):
+			// OpenSSL 3 encrypts with AES by default
+			return nil, fmt.Errorf("unsupported PKCS#12 bundle (%v); re-export it with 'openssl pkcs12 -export -legacy'", err)
+		}
+		return nil, fmt.Errorf("failed to decode PKCS#12 bundle: %w", err)
+	}
+	return bundleFromBlocks(blocks)
+}
+
+// bundleFromBlocks sorts the blocks pkcs12.ToPEM returns into a bundle. Its
+// key blocks are typed "PRIVATE KEY" but hold PKCS#1 or SEC 1 keys, so the key
+// is re-encoded as PKCS#8.
+func bundleFromBlocks(blocks []*pem.Block) (*PKCS12Bundle, error) {
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, b := range blocks {
+		switch b.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(b.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate in PKCS#12 bundle: %w", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			if key != nil {
+				return nil, fmt.Errorf("PKCS#12 bundle has more than one private key")
+			}
+			var err error
+			if key, err = parseBundleKey(b.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("PKCS#12 bundle has no private key")
+	}
+
+	bundle := &PKCS12Bundle{}
+	var ca []string
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if ok && bundle.ClientCert == "" && pub.Equal(key.Public()) {
+			bundle.ClientCert = encodePEM("CERTIFICATE", cert.Raw)
+			continue
+		}
+		ca = append(ca, encodePEM("CERTIFICATE", cert.Raw))
+	}
+	if bundle.ClientCert == "" {
+		return nil, fmt.Errorf("PKCS#12 bundle has no certificate for its private key")
+	}
+	bundle.CACert = strings.Join(ca, "\n")
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	bundle.ClientKey = encodePEM("PRIVATE KEY", der)
+	return bundle, nil
+}
+
+func parseBundleKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported private key in PKCS#12 bundle")
+}
+
+func encodePEM(typ string, der []byte) string {
+	return strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})))
+}
+
+// ParseCertificates parses the PEM certificates in data, skipping other
+// blocks.
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 && len(bytes.TrimSpace([]byte(data))) > 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// IsEncryptedKey reports whether a PEM private key is protected by a
+// passphrase, as PKCS#8 or with the traditional OpenSSL headers.
+func IsEncryptedKey(key string) bool {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return false
+	}
+	return block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED")
+}
+
+// DefaultCertWarnDays is how many days before it expires a certificate is
+// reported as expiring, unless cert_warn_days says otherwise.
+const DefaultCertWarnDays = 30
+
+// CertificateInfo describes one of a server's OpenVPN certificates.
+type CertificateInfo struct {
+	Role      string // "CA" or "Client"
+	Subject   string // common name, or the full subject without one
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// CertificateStatus is a certificate's validity at some point in time.
+type CertificateStatus int
+
+const (
+	CertValid CertificateStatus = iota
+	CertExpiring
+	CertExpired
+	CertNotYetValid
+)
+
+// Status returns the certificate's validity at now. A certificate that
+// expires within warnDays is CertExpiring.
+func (c CertificateInfo) Status(now time.Time, warnDays int) CertificateStatus {
+	switch {
+	case now.After(c.NotAfter):
+		return CertExpired
+	case now.Before(c.NotBefore):
+		return CertNotYetValid
+	case now.AddDate(0, 0, warnDays).After(c.NotAfter):
+		return CertExpiring
+	}
+	return CertValid
+}
+
+// DaysLeft returns the number of whole days until the certificate expires,
+// or 0 once it has.
+func (c CertificateInfo) DaysLeft(now time.Time) int {
+	if !now.Before(c.NotAfter) {
+		return 0
+	}
+	return int(c.NotAfter.Sub(now).Hours() / 24)
+}
+
+// ServerCertificates parses a server's CA and client certificates.
+func ServerCertificates(server *ServerConfig) ([]CertificateInfo, error) {
+	var infos []CertificateInfo
+	for _, c := range []struct{ role, pem string }{{"CA", server.CACert}, {"Client", server.ClientCert}} {
+		certs, err := ParseCertificates(c.pem)
+		if err != nil {
+			return nil, fmt.Errorf("%s certificate: %w", strings.ToLower(c.role), err)
+		}
+		for _, cert := range certs {
+			subject := cert.Subject.CommonName
+			if subject == "" {
+				subject = cert.Subject.String()
+			}
+			infos = append(infos, CertificateInfo{
+				Role:      c.role,
+				Subject:   subject,
+				NotBefore: cert.NotBefore,
+				NotAfter:  cert.NotAfter,
+			})
+		}
+	}
+	return infos, nil
+}
@@ -2,22 +2,31 @@ package config
 
 import (
 	"os"
+	"strconv"
 
 	"gopkg.in/yaml.v3"
 )
 
 type AppConfig struct {
-	LogLevel      string   `yaml:"log_level"`
-	DefaultServer string   `yaml:"default_server"`
-	AutoConnect   bool     `yaml:"auto_connect"`
-	DNSFallback   []string `yaml:"dns_fallback"`
-	KillSwitch    bool     `yaml:"kill_switch"`
+	LogLevel         string   `yaml:"log_level"`
+	DefaultServer    string   `yaml:"default_server"`
+	AutoConnect      bool     `yaml:"auto_connect"`
+	DNSFallback      []string `yaml:"dns_fallback"`
+	KillSwitch       bool     `yaml:"kill_switch"`
+	WireGuardBackend string   `yaml:"wireguard_backend,omitempty"` // "auto", "kernel" or "wireguard-go"
+	DisableUAPI      bool     `yaml:"disable_uapi,omitempty"`      // don't open the wireguard-go UAPI socket
+
+	// CertWarnDays is how many days ahead OpenVPN certificate expiry is
+	// warned about; 0 warns only about expired certificates.
+	CertWarnDays int `yaml:"cert_warn_days"`
 }
 
 func DefaultConfig() *AppConfig {
 	return &AppConfig{
-		LogLevel:    "info",
-		DNSFallback: []string{"1.1.1.1", "8.8.8.8"},
+		LogLevel:         "info",
+		DNSFallback:      []string{"1.1.1.1", "8.8.8.8"},
+		WireGuardBackend: "auto",
+		CertWarnDays:     DefaultCertWarnDays,
 	}
 }
 
@@ -66,6 +75,15 @@ func (c *AppConfig) Get(key string) string {
 			return "true"
 		}
 		return "false"
+	case "wireguard_backend":
+		return c.WireGuardBackend
+	case "disable_uapi":
+		if c.DisableUAPI {
+			return "true"
+		}
+		return "false"
+	case "cert_warn_days":
+		return strconv.Itoa(c.CertWarnDays)
 	default:
 		return ""
 	}
@@ -81,6 +99,16 @@ func (c *AppConfig) Set(key, value string) bool {
 		c.KillSwitch = value == "true"
 	case "auto_connect":
 		c.AutoConnect = value == "true"
+	case "wireguard_backend":
+		c.WireGuardBackend = value
+	case "disable_uapi":
+		c.DisableUAPI = value == "true"
+	case "cert_warn_days":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return false
+		}
+		c.CertWarnDays = n
 	default:
 		return false
 	}
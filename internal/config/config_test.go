@@ -31,6 +31,9 @@ func TestConfigGetSet(t *testing.T) {
 		{"default_server", "myserver", "myserver"},
 		{"kill_switch", "true", "true"},
 		{"auto_connect", "true", "true"},
+		{"wireguard_backend", "kernel", "kernel"},
+		{"disable_uapi", "true", "true"},
+		{"cert_warn_days", "14", "14"},
 	}
 
 	for _, tt := range tests {
@@ -46,6 +49,18 @@ func TestConfigGetSet(t *testing.T) {
 	}
 }
 
+func TestConfigSetCertWarnDaysInvalid(t *testing.T) {
+	cfg := DefaultConfig()
+	for _, bad := range []string{"soon", "-1"} {
+		if cfg.Set("cert_warn_days", bad) {
+			t.Errorf("Set(cert_warn_days, %q) should fail", bad)
+		}
+	}
+	if cfg.CertWarnDays != DefaultCertWarnDays {
+		t.Errorf("CertWarnDays = %d, want the default %d", cfg.CertWarnDays, DefaultCertWarnDays)
+	}
+}
+
 func TestConfigSetUnknownKey(t *testing.T) {
 	cfg := DefaultConfig()
 	if cfg.Set("nonexistent", "value") {
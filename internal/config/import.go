@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -90,14 +91,20 @@ func ImportWireGuardConfig(path string) (*ServerConfig, string, error) {
 }
 
 // ImportOpenVPNConfig parses an .ovpn config file and returns a ServerConfig.
-func ImportOpenVPNConfig(path string) (*ServerConfig, error) {
+// Keys and certificates the profile references by file are read relative to
+// it and stored inline; a PKCS#12 bundle and askpass passphrase are returned
+// in the unsaved PKCS12 and KeyPassphrase fields. Directives that are neither
+// modelled nor safe to pass through are skipped; their names are returned so
+// the caller can warn.
+func ImportOpenVPNConfig(path string) (*ServerConfig, []string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	directives, err := parseOVPN(string(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
-	content := string(data)
-	lines := strings.Split(content, "\n")
 
 	base := filepath.Base(path)
 	name := strings.TrimSuffix(base, filepath.Ext(base))
@@ -109,80 +116,205 @@ func ImportOpenVPNConfig(path string) (*ServerConfig, error) {
 		DNS:      []string{"1.1.1.1", "1.0.0.1"},
 	}
 
-	// Parse directives line by line
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
-			continue
+	var ignored []string
+	seen := make(map[string]bool)
+	ignore := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			ignored = append(ignored, name)
 		}
+	}
 
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
-			continue
+	// readKey returns the key or certificate a directive carries inline or
+	// names by file. Directives naming "[inline]" are followed by a block.
+	dir := filepath.Dir(path)
+	readKey := func(d ovpnDirective) (string, bool, error) {
+		if d.Inline {
+			return d.Args[0], true, nil
 		}
+		file := d.arg(0)
+		if file == "" || file == "[inline]" {
+			return "", false, nil
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("line %d: failed to read %s file: %w", d.Line, d.Name, err)
+		}
+		return strings.TrimSpace(string(data)), true, nil
+	}
 
-		switch fields[0] {
+	// Remote ports may be given later with "port"
+	type remote struct{ host, port, proto string }
+	var remotes []remote
+	defaultPort := "1194"
+	for _, d := range directives {
+		if d.Inline && !ovpnBlockDirectives[d.Name] {
+			ignore("<" + d.Name + ">")
+			continue
+		}
+		switch d.Name {
 		case "remote":
-			if len(fields) >= 2 {
-				host := fields[1]
-				port := "1194"
-				if len(fields) >= 3 {
-					port = fields[2]
-				}
-				server.Endpoint = host + ":" + port
-				if p, err := strconv.Atoi(port); err == nil {
-					server.RemotePort = p
-				}
+			if d.arg(0) != "" {
+				remotes = append(remotes, remote{host: d.arg(0), port: d.arg(1), proto: d.arg(2)})
+			}
+		case "remote-random":
+			server.RemoteRandom = true
+		case "server-poll-timeout":
+			if n, err := strconv.Atoi(d.arg(0)); err == nil {
+				server.ServerPollTimeout = n
 			}
+		case "port", "rport":
+			defaultPort = d.arg(0)
 		case "proto":
-			if len(fields) >= 2 {
-				server.Proto = fields[1]
+			if p := d.arg(0); p != "" {
+				server.Proto = p
 			}
 		case "cipher":
-			if len(fields) >= 2 {
-				server.Cipher = fields[1]
-			}
+			server.Cipher = d.arg(0)
+		case "data-ciphers", "ncp-ciphers":
+			server.DataCiphers = d.arg(0)
 		case "auth":
-			if len(fields) >= 2 {
-				server.Auth = fields[1]
-			}
+			server.Auth = d.arg(0)
 		case "comp-lzo":
 			server.CompLZO = true
+		case "ca", "cert", "key", "tls-auth", "tls-crypt", "tls-crypt-v2":
+			key, ok, err := readKey(d)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				continue
+			}
+			switch d.Name {
+			case "ca":
+				server.CACert = key
+			case "cert":
+				server.ClientCert = key
+			case "key":
+				server.ClientKey = key
+			case "tls-auth":
+				server.TLSAuth = key
+				if dir := d.arg(1); !d.Inline && dir != "" {
+					server.KeyDirection = dir
+				}
+			case "tls-crypt":
+				server.TLSCrypt = key
+			case "tls-crypt-v2":
+				server.TLSCryptV2 = key
+			}
+		case "pkcs12":
+			// The bundle is binary: inline blocks carry it base64 encoded
+			if d.Inline {
+				bundle, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(d.Args[0]), ""))
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: invalid inline pkcs12 block: %w", d.Line, err)
+				}
+				server.PKCS12 = bundle
+				continue
+			}
+			if file := d.arg(0); file != "" {
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(dir, file)
+				}
+				if server.PKCS12, err = os.ReadFile(file); err != nil {
+					return nil, nil, fmt.Errorf("line %d: failed to read pkcs12 file: %w", d.Line, err)
+				}
+			}
+		case "askpass":
+			pass, ok, err := readKey(d)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				server.KeyPassphrase, _, _ = strings.Cut(pass, "\n")
+			}
+		case "key-direction":
+			server.KeyDirection = d.arg(0)
+		case "verify-x509-name":
+			server.VerifyX509Name, server.VerifyX509Type = d.arg(0), d.arg(1)
+		case "remote-cert-tls":
+			server.RemoteCertTLS = d.arg(0)
+		case "tun-mtu":
+			if mtu, err := strconv.Atoi(d.arg(0)); err == nil {
+				server.TunMTU = mtu
+			}
+		case "route":
+			if len(d.Args) > 0 {
+				server.Routes = append(server.Routes, strings.Join(d.Args, " "))
+			}
+		case "route-nopull":
+			server.RouteNoPull = true
+		case "redirect-gateway":
+			server.RedirectGateway = true
+			server.RedirectGatewayFlags = d.Args
 		case "auth-user-pass":
-			// Credentials will be prompted at connect time
+			// Credentials come from the keystore or are prompted at connect
+			// time, unless the profile carries them.
+			server.AuthUserPass = true
+			creds, ok, err := readKey(d)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				user, pass, _ := strings.Cut(creds, "\n")
+				server.Username = strings.TrimSpace(user)
+				server.Password = strings.TrimSpace(pass)
+			}
+		case "static-challenge":
+			server.StaticChallenge = d.arg(0)
+			server.StaticChallengeEcho = d.arg(1) == "1"
+		case "auth-retry":
+			// VoidVPN answers retries over the management interface
+		case "dev":
+			if !strings.HasPrefix(d.arg(0), "tun") {
+				ignore("dev " + d.arg(0))
+			}
+		case "client", "dev-type", "nobind", "persist-key", "persist-tun", "resolv-retry", "verb":
+			// Always set by VoidVPN
+		default:
+			if !safeOVPNDirectives[d.Name] {
+				ignore(d.Name)
+				continue
+			}
+			args := make([]string, 0, len(d.Args)+1)
+			args = append(args, d.Name)
+			for _, a := range d.Args {
+				quoted, err := QuoteOVPNArg(a)
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: %w", d.Line, err)
+				}
+				args = append(args, quoted)
+			}
+			server.ExtraDirectives = append(server.ExtraDirectives, strings.Join(args, " "))
 		}
 	}
 
-	// Extract inline blocks
-	server.CACert = extractInlineBlock(content, "ca")
-	server.ClientCert = extractInlineBlock(content, "cert")
-	server.ClientKey = extractInlineBlock(content, "key")
-	server.TLSAuth = extractInlineBlock(content, "tls-auth")
-
-	if server.Endpoint == "" {
-		return nil, fmt.Errorf("no 'remote' directive found in config")
+	if len(remotes) == 0 {
+		return nil, nil, fmt.Errorf("no 'remote' directive found in config")
 	}
-
-	return server, nil
-}
-
-// extractInlineBlock extracts content between <tag> and </tag> markers.
-func extractInlineBlock(content, tag string) string {
-	start := "<" + tag + ">"
-	end := "</" + tag + ">"
-
-	startIdx := strings.Index(content, start)
-	if startIdx == -1 {
-		return ""
+	for i := range remotes {
+		if remotes[i].port == "" {
+			remotes[i].port = defaultPort
+		}
+		port, err := strconv.Atoi(remotes[i].port)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid port %q for remote %s", remotes[i].port, remotes[i].host)
+		}
+		if len(remotes) > 1 {
+			server.Remotes = append(server.Remotes, OpenVPNRemote{Host: remotes[i].host, Port: port, Proto: remotes[i].proto})
+		}
 	}
-	startIdx += len(start)
-
-	endIdx := strings.Index(content[startIdx:], end)
-	if endIdx == -1 {
-		return ""
+	first := remotes[0]
+	server.Endpoint = first.host + ":" + first.port
+	server.RemotePort, _ = strconv.Atoi(first.port)
+	if len(remotes) == 1 && first.proto != "" {
+		server.Proto = first.proto
 	}
 
-	return strings.TrimSpace(content[startIdx : startIdx+endIdx])
+	return server, ignored, nil
 }
 
 func splitAndTrim(s string) []string {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -125,7 +126,7 @@ faketlsauthkey
 		t.Fatalf("failed to write test config: %v", err)
 	}
 
-	server, err := ImportOpenVPNConfig(ovpnPath)
+	server, _, err := ImportOpenVPNConfig(ovpnPath)
 	if err != nil {
 		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
 	}
@@ -177,14 +178,14 @@ proto udp
 	ovpnPath := filepath.Join(tmpDir, "noremote.ovpn")
 	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
 
-	_, err := ImportOpenVPNConfig(ovpnPath)
+	_, _, err := ImportOpenVPNConfig(ovpnPath)
 	if err == nil {
 		t.Error("should error when remote directive is missing")
 	}
 }
 
 func TestImportOpenVPNInvalidFile(t *testing.T) {
-	_, err := ImportOpenVPNConfig("/nonexistent/path.ovpn")
+	_, _, err := ImportOpenVPNConfig("/nonexistent/path.ovpn")
 	if err == nil {
 		t.Error("should error for nonexistent file")
 	}
@@ -263,7 +264,7 @@ proto tcp
 	ovpnPath := filepath.Join(tmpDir, "tcp.ovpn")
 	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
 
-	server, err := ImportOpenVPNConfig(ovpnPath)
+	server, _, err := ImportOpenVPNConfig(ovpnPath)
 	if err != nil {
 		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
 	}
@@ -304,7 +305,7 @@ proto tcp
 	ovpnPath := filepath.Join(tmpDir, "minimal.ovpn")
 	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
 
-	server, err := ImportOpenVPNConfig(ovpnPath)
+	server, _, err := ImportOpenVPNConfig(ovpnPath)
 	if err != nil {
 		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
 	}
@@ -318,3 +319,205 @@ proto tcp
 		t.Error("CACert should be empty for minimal config")
 	}
 }
+
+func TestImportOpenVPNAuthUserPass(t *testing.T) {
+	tmpDir := t.TempDir()
+	ovpnPath := filepath.Join(tmpDir, "login.ovpn")
+	os.WriteFile(ovpnPath, []byte("remote vpn.example.com 1194\nauth-user-pass\nauth-retry nointeract\nstatic-challenge \"Enter OTP\" 1\n"), 0600)
+
+	server, ignored, err := ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	if !server.AuthUserPass {
+		t.Error("AuthUserPass should be set for auth-user-pass")
+	}
+	if server.StaticChallenge != "Enter OTP" || !server.StaticChallengeEcho {
+		t.Errorf("static challenge = %q echo %v, want Enter OTP with echo", server.StaticChallenge, server.StaticChallengeEcho)
+	}
+	if len(ignored) != 0 {
+		t.Errorf("ignored = %q, want none", ignored)
+	}
+}
+
+func TestImportOpenVPNDirectives(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "keys"), 0700)
+	os.WriteFile(filepath.Join(tmpDir, "keys", "ca.crt"), []byte("fake-ca\n"), 0600)
+	os.WriteFile(filepath.Join(tmpDir, "ta.key"), []byte("fake-tls-auth\n"), 0600)
+	os.WriteFile(filepath.Join(tmpDir, "creds.txt"), []byte("alice\ns3cret\n"), 0600)
+
+	ovpnContent := `client
+dev tun
+remote vpn.example.com
+port 443
+proto tcp-client
+ca keys/ca.crt
+tls-auth ta.key 1
+auth-user-pass creds.txt
+data-ciphers AES-256-GCM:AES-128-GCM
+verify-x509-name "vpn server" name ; the server's CN
+remote-cert-tls server
+tun-mtu 1400
+route 10.10.0.0 255.255.0.0
+route-nopull
+redirect-gateway def1 bypass-dhcp
+tls-version-min 1.2
+script-security 2
+up /etc/openvpn/update-resolv-conf
+<tls-crypt-v2>
+fake-tls-crypt-v2
+</tls-crypt-v2>
+<connection>
+remote backup.example.com
+</connection>
+`
+	ovpnPath := filepath.Join(tmpDir, "full.ovpn")
+	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
+
+	server, ignored, err := ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	if server.Endpoint != "vpn.example.com:443" || server.Proto != "tcp-client" {
+		t.Errorf("Endpoint, Proto = %q, %q, want vpn.example.com:443, tcp-client", server.Endpoint, server.Proto)
+	}
+	if server.CACert != "fake-ca" || server.TLSAuth != "fake-tls-auth" || server.KeyDirection != "1" {
+		t.Errorf("CA %q, tls-auth %q, key direction %q: referenced files should be read", server.CACert, server.TLSAuth, server.KeyDirection)
+	}
+	if server.TLSCryptV2 != "fake-tls-crypt-v2" {
+		t.Errorf("TLSCryptV2 = %q, want the inline block", server.TLSCryptV2)
+	}
+	if !server.AuthUserPass || server.Username != "alice" || server.Password != "s3cret" {
+		t.Errorf("credentials = %v %q %q, want them read from creds.txt", server.AuthUserPass, server.Username, server.Password)
+	}
+	if server.DataCiphers != "AES-256-GCM:AES-128-GCM" || server.RemoteCertTLS != "server" || server.TunMTU != 1400 {
+		t.Errorf("DataCiphers %q, RemoteCertTLS %q, TunMTU %d", server.DataCiphers, server.RemoteCertTLS, server.TunMTU)
+	}
+	if server.VerifyX509Name != "vpn server" || server.VerifyX509Type != "name" {
+		t.Errorf("verify-x509-name = %q %q, want \"vpn server\" name", server.VerifyX509Name, server.VerifyX509Type)
+	}
+	if len(server.Routes) != 1 || server.Routes[0] != "10.10.0.0 255.255.0.0" || !server.RouteNoPull {
+		t.Errorf("Routes = %q, RouteNoPull = %v", server.Routes, server.RouteNoPull)
+	}
+	if !server.RedirectGateway || strings.Join(server.RedirectGatewayFlags, " ") != "def1 bypass-dhcp" {
+		t.Errorf("redirect-gateway = %v %q", server.RedirectGateway, server.RedirectGatewayFlags)
+	}
+	if len(server.ExtraDirectives) != 1 || server.ExtraDirectives[0] != "tls-version-min 1.2" {
+		t.Errorf("ExtraDirectives = %q, want [tls-version-min 1.2]", server.ExtraDirectives)
+	}
+	if strings.Join(ignored, ",") != "script-security,up,<connection>" {
+		t.Errorf("ignored = %q, want script-security, up and connection", ignored)
+	}
+}
+
+func TestImportOpenVPNInlineScalarBlocks(t *testing.T) {
+	tmpDir := t.TempDir()
+	ovpnContent := `remote vpn.example.com 1194
+<cipher>
+AES-256-GCM
+script-security 2
+up /tmp/evil.sh
+</cipher>
+<verify-x509-name>
+vpn
+up /tmp/evil.sh
+</verify-x509-name>
+<remote>
+evil.example.com
+up /tmp/evil.sh
+</remote>
+<tls-version-min>
+1.2
+up /tmp/evil.sh
+</tls-version-min>
+`
+	ovpnPath := filepath.Join(tmpDir, "blocks.ovpn")
+	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
+
+	server, ignored, err := ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	if server.Cipher != "" || server.VerifyX509Name != "" || len(server.Remotes) != 0 || len(server.ExtraDirectives) != 0 {
+		t.Errorf("inline blocks of scalar directives should not be imported: %+v", server)
+	}
+	if strings.Join(ignored, ",") != "<cipher>,<verify-x509-name>,<remote>,<tls-version-min>" {
+		t.Errorf("ignored = %q, want the four blocks", ignored)
+	}
+}
+
+func TestImportOpenVPNMissingKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	ovpnPath := filepath.Join(tmpDir, "broken.ovpn")
+	os.WriteFile(ovpnPath, []byte("remote vpn.example.com 1194\nca missing.crt\n"), 0600)
+
+	if _, _, err := ImportOpenVPNConfig(ovpnPath); err == nil || !strings.Contains(err.Error(), "ca file") {
+		t.Errorf("ImportOpenVPNConfig() error = %v, want a failure to read the ca file", err)
+	}
+}
+
+func TestImportOpenVPNRemotes(t *testing.T) {
+	tmpDir := t.TempDir()
+	ovpnContent := `client
+proto udp
+remote vpn1.example.com
+remote vpn2.example.com 443 tcp-client
+remote 198.51.100.7 1195 udp
+port 1190
+remote-random
+server-poll-timeout 10
+`
+	ovpnPath := filepath.Join(tmpDir, "multi.ovpn")
+	os.WriteFile(ovpnPath, []byte(ovpnContent), 0600)
+
+	server, _, err := ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	want := []OpenVPNRemote{
+		{Host: "vpn1.example.com", Port: 1190},
+		{Host: "vpn2.example.com", Port: 443, Proto: "tcp-client"},
+		{Host: "198.51.100.7", Port: 1195, Proto: "udp"},
+	}
+	if !reflect.DeepEqual(server.Remotes, want) {
+		t.Errorf("Remotes = %+v, want %+v", server.Remotes, want)
+	}
+	if server.Endpoint != "vpn1.example.com:1190" || server.Proto != "udp" {
+		t.Errorf("Endpoint, Proto = %q, %q, want the first remote and the global proto", server.Endpoint, server.Proto)
+	}
+	if !server.RemoteRandom || server.ServerPollTimeout != 10 {
+		t.Errorf("RemoteRandom = %v, ServerPollTimeout = %d", server.RemoteRandom, server.ServerPollTimeout)
+	}
+}
+
+func TestImportOpenVPNPKCS12(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundle := []byte{0x30, 0x82, 0x00, 0x0a, '\n', ' '}
+	os.WriteFile(filepath.Join(tmpDir, "client.p12"), bundle, 0600)
+	os.WriteFile(filepath.Join(tmpDir, "pass.txt"), []byte("s3cret\n"), 0600)
+	ovpnPath := filepath.Join(tmpDir, "p12.ovpn")
+	os.WriteFile(ovpnPath, []byte("remote vpn.example.com 1194\npkcs12 client.p12\naskpass pass.txt\n"), 0600)
+
+	server, ignored, err := ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	if string(server.PKCS12) != string(bundle) {
+		t.Errorf("PKCS12 = %x, want the file's bytes unchanged", server.PKCS12)
+	}
+	if server.KeyPassphrase != "s3cret" {
+		t.Errorf("KeyPassphrase = %q, want s3cret", server.KeyPassphrase)
+	}
+	if len(ignored) != 0 {
+		t.Errorf("ignored = %q, want none", ignored)
+	}
+
+	os.WriteFile(ovpnPath, []byte("remote vpn.example.com 1194\n<pkcs12>\nMIIC\nAAo=\n</pkcs12>\n"), 0600)
+	if server, _, err = ImportOpenVPNConfig(ovpnPath); err != nil {
+		t.Fatalf("ImportOpenVPNConfig() inline error: %v", err)
+	}
+	if want := []byte{0x30, 0x82, 0x02, 0x00, 0x0a}; string(server.PKCS12) != string(want) {
+		t.Errorf("inline PKCS12 = %x, want %x", server.PKCS12, want)
+	}
+}
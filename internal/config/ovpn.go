@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ovpnDirective is one directive of an OpenVPN config: a line such as
+// "remote vpn.example.com 1194", or an inline <tag>...</tag> block, which is
+// the same as the directive with the block as its only argument.
+type ovpnDirective struct {
+	Name   string
+	Args   []string
+	Inline bool // Args[0] is the content of an inline block
+	Line   int
+}
+
+// arg returns the i-th argument, or "" if there are fewer.
+func (d ovpnDirective) arg(i int) string {
+	if i < len(d.Args) {
+		return d.Args[i]
+	}
+	return ""
+}
+
+// parseOVPN splits an OpenVPN config into directives, following OpenVPN's
+// rules for comments, quoting and inline blocks.
+func parseOVPN(content string) ([]ovpnDirective, error) {
+	var directives []ovpnDirective
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if tag, ok := inlineTag(line); ok {
+			end := "</" + tag + ">"
+			var body []string
+			j := i + 1
+			for ; j < len(lines) && strings.TrimSpace(lines[j]) != end; j++ {
+				body = append(body, lines[j])
+			}
+			if j == len(lines) {
+				return nil, fmt.Errorf("line %d: <%s> block is not closed", i+1, tag)
+			}
+			directives = append(directives, ovpnDirective{
+				Name:   tag,
+				Args:   []string{strings.TrimSpace(strings.Join(body, "\n"))},
+				Inline: true,
+				Line:   i + 1,
+			})
+			i = j
+			continue
+		}
+
+		fields, err := splitOVPNLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		// Options may be written with a leading "--" as on the command line
+		name := strings.TrimPrefix(fields[0], "--")
+		directives = append(directives, ovpnDirective{Name: name, Args: fields[1:], Line: i + 1})
+	}
+	return directives, nil
+}
+
+// inlineTag returns the tag of a line opening an inline block, e.g. "ca" for
+// "<ca>".
+func inlineTag(line string) (string, bool) {
+	if len(line) < 3 || line[0] != '<' || line[len(line)-1] != '>' || line[1] == '/' {
+		return "", false
+	}
+	tag := line[1 : len(line)-1]
+	if strings.ContainsAny(tag, " \t<>") {
+		return "", false
+	}
+	return tag, true
+}
+
+// splitOVPNLine splits a directive line into fields. Double quotes group
+// words and allow backslash escapes, single quotes group words verbatim, and
+// an unquoted # or ; starts a comment.
+func splitOVPNLine(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	inField := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		case (c == '#' || c == ';') && !inField:
+			return fields, nil
+		case c == '"' || c == '\'':
+			inField = true
+			j := i + 1
+			for ; j < len(line) && line[j] != c; j++ {
+				if c == '"' && line[j] == '\\' && j+1 < len(line) {
+					j++
+				}
+				cur.WriteByte(line[j])
+			}
+			if j == len(line) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			i = j
+		case c == '\\' && i+1 < len(line):
+			inField = true
+			i++
+			cur.WriteByte(line[i])
+		default:
+			inField = true
+			cur.WriteByte(c)
+		}
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+// QuoteOVPNArg quotes a directive argument if OpenVPN would otherwise split
+// or misread it. Line breaks cannot be quoted: they would end the directive
+// and start another.
+func QuoteOVPNArg(arg string) (string, error) {
+	if strings.ContainsAny(arg, "\r\n") {
+		return "", fmt.Errorf("argument %q contains a line break", arg)
+	}
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\#;") {
+		return arg, nil
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(arg) + `"`, nil
+}
+
+// ovpnBlockDirectives are the directives whose argument may be given as an
+// inline <tag>...</tag> block. Any other block spans several lines that
+// would be written out as directives of their own.
+var ovpnBlockDirectives = map[string]bool{
+	"askpass":        true,
+	"auth-user-pass": true,
+	"ca":             true,
+	"cert":           true,
+	"key":            true,
+	"pkcs12":         true,
+	"tls-auth":       true,
+	"tls-crypt":      true,
+	"tls-crypt-v2":   true,
+}
+
+// safeOVPNDirectives are directives passed through to OpenVPN unchanged.
+// They tune the connection but cannot run programs, read or write files, or
+// change how VoidVPN drives OpenVPN, so they are safe to keep from profiles
+// downloaded from a provider.
+var safeOVPNDirectives = map[string]bool{
+	"allow-compression":     true,
+	"auth-nocache":          true,
+	"block-ipv6":            true,
+	"compress":              true,
+	"connect-retry":         true,
+	"connect-retry-max":     true,
+	"connect-timeout":       true,
+	"data-ciphers-fallback": true,
+	"explicit-exit-notify":  true,
+	"float":                 true,
+	"fragment":              true,
+	"hand-window":           true,
+	"ifconfig-nowarn":       true,
+	"keepalive":             true,
+	"link-mtu":              true,
+	"mssfix":                true,
+	"mute":                  true,
+	"mute-replay-warnings":  true,
+	"ns-cert-type":          true,
+	"ping":                  true,
+	"ping-exit":             true,
+	"ping-restart":          true,
+	"pull":                  true,
+	"pull-filter":           true,
+	"rcvbuf":                true,
+	"reneg-bytes":           true,
+	"reneg-pkts":            true,
+	"reneg-sec":             true,
+	"replay-window":         true,
+	"route-delay":           true,
+	"route-ipv6":            true,
+	"route-metric":          true,
+	"sndbuf":                true,
+	"tls-cert-profile":      true,
+	"tls-cipher":            true,
+	"tls-ciphersuites":      true,
+	"tls-client":            true,
+	"tls-groups":            true,
+	"tls-timeout":           true,
+	"tls-version-max":       true,
+	"tls-version-min":       true,
+	"tun-mtu-extra":         true,
+}
+
+// IsSafeOVPNDirective reports whether an extra directive line may be passed
+// through to OpenVPN.
+func IsSafeOVPNDirective(line string) bool {
+	if strings.ContainsAny(line, "\r\n") {
+		return false
+	}
+	fields, err := splitOVPNLine(line)
+	if err != nil || len(fields) == 0 {
+		return false
+	}
+	return safeOVPNDirectives[fields[0]]
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitOVPNLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"remote vpn.example.com 1194", []string{"remote", "vpn.example.com", "1194"}},
+		{"remote  vpn.example.com\t1194 # primary", []string{"remote", "vpn.example.com", "1194"}},
+		{`verify-x509-name "vpn server" name`, []string{"verify-x509-name", "vpn server", "name"}},
+		{`verify-x509-name 'C=US, CN=vpn' subject`, []string{"verify-x509-name", "C=US, CN=vpn", "subject"}},
+		{`setenv FOO "a \"quoted\" \\ value"`, []string{"setenv", "FOO", `a "quoted" \ value`}},
+		{`ca my\ ca.crt`, []string{"ca", "my ca.crt"}},
+		{"route-nopull;comment", []string{"route-nopull;comment"}},
+		{"; whole line", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitOVPNLine(tt.line)
+		if err != nil {
+			t.Errorf("splitOVPNLine(%q) error: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitOVPNLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := splitOVPNLine(`verify-x509-name "vpn server`); err == nil {
+		t.Error("splitOVPNLine should reject an unterminated quote")
+	}
+}
+
+func TestParseOVPN(t *testing.T) {
+	content := "client\r\n# comment\r\n--proto tcp\r\n<ca>\r\nline1\r\nline2\r\n</ca>\r\nverb 3\r\n"
+	directives, err := parseOVPN(content)
+	if err != nil {
+		t.Fatalf("parseOVPN() error: %v", err)
+	}
+	want := []ovpnDirective{
+		{Name: "client", Args: []string{}, Line: 1},
+		{Name: "proto", Args: []string{"tcp"}, Line: 3},
+		{Name: "ca", Args: []string{"line1\nline2"}, Inline: true, Line: 4},
+		{Name: "verb", Args: []string{"3"}, Line: 8},
+	}
+	if !reflect.DeepEqual(directives, want) {
+		t.Errorf("parseOVPN() = %+v, want %+v", directives, want)
+	}
+
+	if _, err := parseOVPN("<ca>\nline1\n"); err == nil {
+		t.Error("parseOVPN should reject an unclosed block")
+	}
+}
+
+func TestQuoteOVPNArg(t *testing.T) {
+	tests := map[string]string{
+		"server":     "server",
+		"vpn server": `"vpn server"`,
+		`a"b`:        `"a\"b"`,
+		"":           `""`,
+	}
+	for arg, want := range tests {
+		got, err := QuoteOVPNArg(arg)
+		if err != nil || got != want {
+			t.Errorf("QuoteOVPNArg(%q) = %q, %v, want %q", arg, got, err, want)
+		}
+		if fields, _ := splitOVPNLine("x " + got); len(fields) != 2 || fields[1] != arg {
+			t.Errorf("QuoteOVPNArg(%q) does not round-trip: %q", arg, fields)
+		}
+	}
+	for _, arg := range []string{"a\nup /tmp/evil.sh", "a\rb"} {
+		if got, err := QuoteOVPNArg(arg); err == nil {
+			t.Errorf("QuoteOVPNArg(%q) = %q, want an error", arg, got)
+		}
+	}
+}
+
+func TestIsSafeOVPNDirective(t *testing.T) {
+	tests := map[string]bool{
+		"tls-version-min 1.2":     true,
+		"keepalive 10 60":         true,
+		"up /tmp/evil.sh":         false,
+		"script-security 2":       false,
+		"plugin /lib/evil.so":     false,
+		"mssfix 1400\nup /bin/sh": false,
+		"":                        false,
+	}
+	for line, want := range tests {
+		if got := IsSafeOVPNDirective(line); got != want {
+			t.Errorf("IsSafeOVPNDirective(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
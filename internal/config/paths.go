@@ -39,6 +39,17 @@ func StateFile() string {
 	return filepath.Join(StateDir(), "connection.json")
 }
 
+// RuntimeDir holds a private directory for each OpenVPN session with the
+// files handed to the openvpn process.
+func RuntimeDir() string {
+	return filepath.Join(StateDir(), "run")
+}
+
+// LogDir holds the OpenVPN logs of recent sessions.
+func LogDir() string {
+	return filepath.Join(StateDir(), "logs")
+}
+
 func EnsureDirs() error {
 	dirs := []string{ConfigDir(), ServersDir(), StateDir()}
 	for _, d := range dirs {
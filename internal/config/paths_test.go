@@ -50,6 +50,15 @@ func TestStateFile(t *testing.T) {
 	}
 }
 
+func TestRuntimeAndLogDirs(t *testing.T) {
+	if d := RuntimeDir(); filepath.Dir(d) != StateDir() {
+		t.Errorf("RuntimeDir() = %q, should be under %q", d, StateDir())
+	}
+	if d := LogDir(); filepath.Dir(d) != StateDir() {
+		t.Errorf("LogDir() = %q, should be under %q", d, StateDir())
+	}
+}
+
 func TestEnsureDirsCreatesDirectories(t *testing.T) {
 	origAppdata := os.Getenv("APPDATA")
 	tmp := t.TempDir()
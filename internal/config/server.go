@@ -18,11 +18,22 @@ type ServerConfig struct {
 	Endpoint            string   `yaml:"endpoint"`
 	PublicKey           string   `yaml:"public_key"`
 	AllowedIPs          []string `yaml:"allowed_ips"`
+	ExcludeIPs          []string `yaml:"exclude_ips,omitempty"`
+	IncludeDomains      []string `yaml:"include_domains,omitempty"`
+	ExcludeDomains      []string `yaml:"exclude_domains,omitempty"`
+	RoutingStrategy     string   `yaml:"routing_strategy,omitempty"` // "split" (default) or "policy"
 	DNS                 []string `yaml:"dns"`
 	Address             string   `yaml:"address"`
 	PresharedKey        string   `yaml:"preshared_key,omitempty"`
 	PersistentKeepalive int      `yaml:"persistent_keepalive"`
 	MTU                 int      `yaml:"mtu"`
+	AutoMTU             bool     `yaml:"auto_mtu,omitempty"`          // probe the path to the endpoint and override MTU
+	HandshakeTimeout    int      `yaml:"handshake_timeout,omitempty"` // seconds to wait for the first handshake; 0 uses the default
+	Namespace           bool     `yaml:"namespace,omitempty"`         // keep the tunnel in its own network namespace (Linux)
+
+	// SOCKSProxy and HTTPProxy run local proxies that egress through the tunnel
+	SOCKSProxy *ProxyConfig `yaml:"socks_proxy,omitempty"`
+	HTTPProxy  *ProxyConfig `yaml:"http_proxy,omitempty"`
 
 	// OpenVPN-specific fields
 	CACert     string `yaml:"ca_cert,omitempty"`
@@ -36,6 +47,63 @@ type ServerConfig struct {
 	RemotePort int    `yaml:"remote_port,omitempty"`
 	Username   string `yaml:"username,omitempty"`
 	Password   string `yaml:"password,omitempty"`
+
+	// AuthUserPass is set for OpenVPN servers that require a username and
+	// password. Credentials not in the file come from the keystore or a prompt.
+	AuthUserPass bool `yaml:"auth_user_pass,omitempty"`
+
+	// Further OpenVPN settings, mostly from imported profiles. Key material
+	// referenced by file in the profile is stored inline.
+	TLSCrypt             string   `yaml:"tls_crypt,omitempty"`
+	TLSCryptV2           string   `yaml:"tls_crypt_v2,omitempty"`
+	KeyDirection         string   `yaml:"key_direction,omitempty"` // for tls-auth; "1" if unset
+	DataCiphers          string   `yaml:"data_ciphers,omitempty"`
+	VerifyX509Name       string   `yaml:"verify_x509_name,omitempty"`
+	VerifyX509Type       string   `yaml:"verify_x509_type,omitempty"` // "subject", "name" or "name-prefix"
+	RemoteCertTLS        string   `yaml:"remote_cert_tls,omitempty"`
+	TunMTU               int      `yaml:"tun_mtu,omitempty"`
+	Routes               []string `yaml:"routes,omitempty"` // route arguments: network [netmask [gateway [metric]]]
+	RouteNoPull          bool     `yaml:"route_nopull,omitempty"`
+	RedirectGateway      bool     `yaml:"redirect_gateway,omitempty"`
+	RedirectGatewayFlags []string `yaml:"redirect_gateway_flags,omitempty"`
+	ExtraDirectives      []string `yaml:"extra_directives,omitempty"` // passed through when IsSafeOVPNDirective allows
+
+	// Remotes lists the OpenVPN servers to try in order, or in random order
+	// with RemoteRandom. Endpoint holds the first; it is used alone when the
+	// list is empty.
+	Remotes           []OpenVPNRemote `yaml:"remotes,omitempty"`
+	RemoteRandom      bool            `yaml:"remote_random,omitempty"`
+	ServerPollTimeout int             `yaml:"server_poll_timeout,omitempty"` // seconds per remote; OpenVPN's default if 0
+
+	// StaticChallenge is the prompt for a response, such as a one-time
+	// password, sent with the OpenVPN password (static-challenge).
+	StaticChallenge     string `yaml:"static_challenge,omitempty"`
+	StaticChallengeEcho bool   `yaml:"static_challenge_echo,omitempty"`
+
+	// ClientKeyInKeystore is set when the OpenVPN client key is kept in the
+	// keystore instead of ClientKey, as for keys imported from PKCS#12.
+	ClientKeyInKeystore bool `yaml:"client_key_in_keystore,omitempty"`
+
+	// PKCS12 and KeyPassphrase are never saved. The importer sets them from
+	// a profile's pkcs12 and askpass directives; KeyPassphrase is set again
+	// at connect time to unlock an encrypted ClientKey.
+	PKCS12        []byte `yaml:"-"`
+	KeyPassphrase string `yaml:"-"`
+}
+
+// OpenVPNRemote is one server of an OpenVPN profile with several remotes.
+type OpenVPNRemote struct {
+	Host  string `yaml:"host"`
+	Port  int    `yaml:"port"`
+	Proto string `yaml:"proto,omitempty"` // the server's Proto if empty
+}
+
+// ProxyConfig configures a local proxy listener. Authentication is enabled
+// when Username is set.
+type ProxyConfig struct {
+	Listen   string `yaml:"listen,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
 }
 
 func DefaultServerConfig() *ServerConfig {
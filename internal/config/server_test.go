@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func setupTestEnv(t *testing.T) func() {
@@ -233,3 +235,17 @@ func TestServerExistsFalse(t *testing.T) {
 		t.Error("ServerExists() should return false for missing server")
 	}
 }
+
+func TestServerConfigKeepsImportSecretsOutOfYAML(t *testing.T) {
+	server := &ServerConfig{Name: "p12", Protocol: "openvpn", PKCS12: []byte("bundle"), KeyPassphrase: "s3cret", ClientKeyInKeystore: true}
+	data, err := yaml.Marshal(server)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "bundle") {
+		t.Errorf("server YAML holds import secrets:\n%s", data)
+	}
+	if !strings.Contains(string(data), "client_key_in_keystore: true") {
+		t.Errorf("server YAML lacks client_key_in_keystore:\n%s", data)
+	}
+}
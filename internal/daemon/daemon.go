@@ -3,15 +3,23 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/netip"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/voidvpn/voidvpn/internal/config"
 	"github.com/voidvpn/voidvpn/internal/network"
+	"github.com/voidvpn/voidvpn/internal/proxy"
 	"github.com/voidvpn/voidvpn/internal/tunnel"
 )
 
@@ -20,19 +28,85 @@ type Daemon struct {
 	server    *config.ServerConfig
 	dns       network.DNSManager
 	routes    network.RouteManager
+	strategy  network.RoutingStrategy
+	domains   *network.DomainRouter
+	dnsProxy  *network.DNSProxy
+	socks     *proxy.SOCKS5
+	httpProxy *proxy.HTTP
+	forwards  map[int]*proxy.Forward
+	fwdMu     sync.Mutex // guards forwards and nextFwd
+	nextFwd   int
+	namespace network.NamespaceManager // nil unless the server runs in its own namespace
+	appSplit  network.AppSplitManager
+	appMu     sync.Mutex // serializes app split setup across IPC connections
+	iface     string
+	address   string // tunnel addresses, as reported by the tunnel
+	userspace bool
 	ipc       *IPCServer
+	uapi      io.Closer
 	cancel    context.CancelFunc
 	Connected chan struct{} // closed when tunnel is connected
+	UAPI      bool          // expose the WireGuard device on its UAPI socket
+}
+
+// uapiServer is implemented by tunnels whose device can be exposed to
+// standard WireGuard tooling over the UAPI socket.
+type uapiServer interface {
+	ServeUAPI() (io.Closer, error)
+}
+
+// dnsPusher is implemented by tunnels whose server pushes DNS settings the
+// daemon has to apply (OpenVPN dhcp-option).
+type dnsPusher interface {
+	PushedDNS() (servers, domains []string)
+}
+
+// prefixAllower is implemented by tunnels that must be told about extra
+// destinations before they carry traffic for them (WireGuard AllowedIPs).
+type prefixAllower interface {
+	AllowPrefix(prefix netip.Prefix) error
+	RemovePrefix(prefix netip.Prefix) error
+}
+
+// fwMarker is implemented by tunnels that can mark their own packets, which
+// policy routing needs to keep them out of the VPN table.
+type fwMarker interface {
+	SetFwMark(mark uint32)
 }
 
 func New(tun tunnel.Tunnel, server *config.ServerConfig) *Daemon {
-	return &Daemon{
+	routes, strategy := newRouteManager(server)
+	// Only mark the tunnel's packets if policy routing is actually in use
+	if marker, ok := tun.(fwMarker); ok && strategy == network.RoutePolicy {
+		marker.SetFwMark(network.PolicyRoutingMark)
+	}
+	d := &Daemon{
 		tunnel:    tun,
 		server:    server,
 		dns:       network.NewDNSManager(),
-		routes:    network.NewRouteManager(),
+		routes:    routes,
+		strategy:  strategy,
+		appSplit:  network.NewAppSplitManager(),
 		Connected: make(chan struct{}),
+		UAPI:      true,
 	}
+	if server.Namespace {
+		d.namespace = network.NewNamespaceManager(network.NamespaceName(server.Name))
+	}
+	return d
+}
+
+// newRouteManager returns the route manager for the server's routing
+// strategy, falling back to split routes where policy routing is unavailable.
+func newRouteManager(server *config.ServerConfig) (network.RouteManager, network.RoutingStrategy) {
+	if server.RoutingStrategy == string(network.RoutePolicy) && server.Protocol != "openvpn" {
+		routes, err := network.NewPolicyRouteManager(network.PolicyRoutingMark)
+		if err == nil {
+			return routes, network.RoutePolicy
+		}
+		slog.Warn("policy routing unavailable, using split routes", "error", err)
+	}
+	return network.NewRouteManager(), network.RouteSplit
 }
 
 func (d *Daemon) Run(ctx context.Context) error {
@@ -54,43 +128,94 @@ func (d *Daemon) Run(ctx context.Context) error {
 		return err
 	}
 
-	slog.Debug("tunnel device ready", "interface", status.InterfaceName)
+	slog.Debug("tunnel device ready", "interface", status.InterfaceName, "userspace", status.Userspace)
+	d.iface = status.InterfaceName
+	d.userspace = status.Userspace
+	// OpenVPN servers push the address; imported profiles have none of their own
+	d.address = d.server.Address
+	if status.TunnelIP != "" {
+		d.address = status.TunnelIP
+	}
+	endpoint := d.server.Endpoint
+	if status.Endpoint != "" {
+		endpoint = status.Endpoint
+	}
 
-	// OpenVPN handles IP/DNS/routing via its own process.
-	// For WireGuard, we must configure the network stack ourselves.
-	if d.server.Protocol != "openvpn" {
+	// OpenVPN handles IP and routing via its own process, and DNS only on
+	// Windows. For WireGuard, we must configure the network stack ourselves,
+	// unless it runs on a userspace stack that the host never routes into,
+	// or in its own namespace where the host's routes and DNS are left alone.
+	if d.namespace != nil {
+		if err := d.setupNamespace(status.InterfaceName); err != nil {
+			return err
+		}
+	} else if d.server.Protocol == "openvpn" {
+		if runtime.GOOS != "windows" {
+			d.setPushedDNS(status.InterfaceName)
+		}
+	} else if !d.userspace {
 		// Assign IP address to the tunnel interface
 		slog.Debug("assigning address", "interface", status.InterfaceName, "address", d.server.Address)
 		if err := network.AssignAddress(status.InterfaceName, d.server.Address); err != nil {
 			return fmt.Errorf("failed to assign address to tunnel interface: %w", err)
 		}
 
-		// Add VPN routes (0.0.0.0/1 + 128.0.0.0/1 via TUN interface, endpoint via default gw)
-		endpointHost := network.ExtractEndpointHost(d.server.Endpoint)
-		hasIPv6 := false
-		for _, aip := range d.server.AllowedIPs {
-			if strings.Contains(aip, ":") {
-				hasIPv6 = true
-				break
-			}
+		// Route AllowedIPs minus ExcludeIPs via TUN. Split routing turns /0 into
+		// two /1s and pins the endpoint to the default gw; policy routing keeps
+		// /0 in its own table and relies on the fwmark instead.
+		allowed, err := network.ComputeAllowedIPs(d.server.AllowedIPs, d.server.ExcludeIPs)
+		if err != nil {
+			return fmt.Errorf("failed to compute VPN routes: %w", err)
 		}
-		slog.Debug("adding VPN routes", "endpoint", endpointHost, "ipv6", hasIPv6)
-		if err := d.routes.AddVPNRoutes(status.InterfaceName, endpointHost, hasIPv6); err != nil {
+		routes := allowed
+		if d.strategy != network.RoutePolicy {
+			routes = network.SplitDefaultRoutes(allowed)
+		}
+		endpointHost := network.ExtractEndpointHost(d.server.Endpoint)
+		hasIPv6 := network.HasIPv6(routes)
+		slog.Debug("adding VPN routes", "endpoint", endpointHost, "routes", len(routes), "ipv6", hasIPv6)
+		if err := d.routes.AddVPNRoutes(status.InterfaceName, endpointHost, routes); err != nil {
 			return fmt.Errorf("failed to add VPN routes: %w", err)
 		}
-		slog.Info("routes configured", "interface", status.InterfaceName, "ipv6", hasIPv6)
+		slog.Info("routes configured", "interface", status.InterfaceName, "routes", len(routes), "ipv6", hasIPv6, "strategy", d.strategy)
+
+		// Domain-based split tunneling. When the DNS proxy is up, the system
+		// resolver points at it so answers are routed before clients see them.
+		dnsServers := d.server.DNS
+		if matcher := network.NewDomainMatcher(d.server.IncludeDomains, d.server.ExcludeDomains); !matcher.Empty() {
+			if proxyIP := d.startDomainRouting(ctx, matcher, status.InterfaceName); proxyIP != "" {
+				dnsServers = []string{proxyIP}
+			}
+		}
 
 		// Configure DNS
-		if len(d.server.DNS) > 0 {
-			slog.Debug("setting DNS", "interface", status.InterfaceName, "servers", d.server.DNS)
-			if err := d.dns.Set(status.InterfaceName, d.server.DNS); err != nil {
+		if len(dnsServers) > 0 {
+			slog.Debug("setting DNS", "interface", status.InterfaceName, "servers", dnsServers)
+			if err := d.dns.Set(status.InterfaceName, dnsServers); err != nil {
 				slog.Warn("failed to set DNS", "error", err)
 			} else {
-				slog.Info("DNS configured", "servers", d.server.DNS)
+				slog.Info("DNS configured", "servers", dnsServers)
 			}
 		}
 	}
 
+	if d.UAPI && !d.userspace {
+		d.startUAPI()
+	}
+
+	// Proxies dial from the host's namespace, which in namespace mode would
+	// bypass the tunnel
+	if d.namespace != nil && (d.server.SOCKSProxy != nil || d.server.HTTPProxy != nil) {
+		slog.Warn("SOCKS5 and HTTP proxies are not available in namespace mode")
+	} else {
+		if d.server.SOCKSProxy != nil {
+			d.startSOCKSProxy(d.server.SOCKSProxy)
+		}
+		if d.server.HTTPProxy != nil {
+			d.startHTTPProxy(d.server.HTTPProxy)
+		}
+	}
+
 	// Signal connected only AFTER network is fully configured (IP, routes, DNS).
 	// This ensures the spinner shows success only when traffic can actually flow.
 	close(d.Connected)
@@ -100,10 +225,21 @@ func (d *Daemon) Run(ctx context.Context) error {
 		Server:        d.server.Name,
 		ConnectedAt:   time.Now(),
 		InterfaceName: status.InterfaceName,
-		TunnelIP:      d.server.Address,
-		Endpoint:      d.server.Endpoint,
+		TunnelIP:      d.address,
+		Endpoint:      endpoint,
 		PID:           os.Getpid(),
 		Protocol:      d.server.Protocol,
+		Userspace:     d.userspace,
+		LastHandshake: status.LastHandshake,
+	}
+	if d.namespace != nil {
+		state.Namespace = d.namespace.Name()
+	}
+	if d.socks != nil {
+		state.SOCKSProxy = d.socks.Addr().String()
+	}
+	if d.httpProxy != nil {
+		state.HTTPProxy = d.httpProxy.Addr().String()
 	}
 	if err := SaveState(state); err != nil {
 		slog.Warn("failed to save state", "error", err)
@@ -119,7 +255,11 @@ func (d *Daemon) Run(ctx context.Context) error {
 		slog.Debug("IPC server started")
 	}
 
-	slog.Info("connected", "server", d.server.Name, "tunnel_ip", d.server.Address)
+	if src, ok := d.tunnel.(tunnel.EventSource); ok {
+		go d.watchEvents(ctx, src.Events())
+	}
+
+	slog.Info("connected", "server", d.server.Name, "interface", d.iface, "tunnel_ip", d.address)
 
 	// Wait for signal or IPC disconnect
 	sigCh := make(chan os.Signal, 1)
@@ -135,6 +275,184 @@ func (d *Daemon) Run(ctx context.Context) error {
 	return nil
 }
 
+// watchEvents logs what the tunnel reports while connected and disconnects
+// when it stops with a fatal error, so a dead tunnel is not left configured.
+func (d *Daemon) watchEvents(ctx context.Context, events <-chan tunnel.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			switch ev.Type {
+			case tunnel.EventState:
+				slog.Info("tunnel state changed", "state", ev.Message)
+			case tunnel.EventLog:
+				slog.Debug("tunnel log", "message", ev.Message)
+			case tunnel.EventFatal:
+				slog.Error("tunnel stopped", "error", ev.Message)
+				d.cancel()
+				return
+			}
+		}
+	}
+}
+
+// setPushedDNS points the system resolver at the DNS servers OpenVPN was
+// pushed, or at the server file's when none were. OpenVPN itself only hands
+// them to up scripts outside Windows.
+func (d *Daemon) setPushedDNS(iface string) {
+	var servers, domains []string
+	if dp, ok := d.tunnel.(dnsPusher); ok {
+		servers, domains = dp.PushedDNS()
+	}
+	if len(servers) == 0 {
+		servers, domains = d.server.DNS, nil
+	}
+	if len(servers) == 0 {
+		slog.Debug("no DNS servers pushed")
+		return
+	}
+	var err error
+	if sd, ok := d.dns.(network.SearchDomainSetter); ok {
+		err = sd.SetWithSearch(iface, servers, domains)
+	} else {
+		err = d.dns.Set(iface, servers)
+	}
+	if err != nil {
+		slog.Warn("failed to set DNS", "error", err)
+		return
+	}
+	slog.Info("DNS configured", "servers", servers, "domains", domains)
+}
+
+// setupNamespace moves the tunnel interface into the server's network
+// namespace and routes AllowedIPs minus ExcludeIPs through it there.
+func (d *Daemon) setupNamespace(iface string) error {
+	routes, err := network.ComputeAllowedIPs(d.server.AllowedIPs, d.server.ExcludeIPs)
+	if err != nil {
+		return fmt.Errorf("failed to compute VPN routes: %w", err)
+	}
+	if len(d.server.IncludeDomains) > 0 || len(d.server.ExcludeDomains) > 0 {
+		slog.Warn("domain-based split tunneling is not applied in namespace mode")
+	}
+	cfg := network.NamespaceConfig{Address: d.server.Address, Routes: routes, DNS: d.server.DNS}
+	if err := d.namespace.Setup(iface, cfg); err != nil {
+		return fmt.Errorf("failed to set up network namespace %s: %w", d.namespace.Name(), err)
+	}
+	slog.Info("network namespace configured", "namespace", d.namespace.Name(), "interface", iface, "routes", len(routes))
+	return nil
+}
+
+// startDomainRouting keeps host routes for the server's include/exclude
+// domains in sync with DNS. It returns the DNS proxy IP to use as the system
+// resolver, or "" if the proxy could not be started.
+func (d *Daemon) startDomainRouting(ctx context.Context, matcher *network.DomainMatcher, iface string) string {
+	resolve := network.SystemResolver
+	if len(d.server.DNS) > 0 {
+		resolve = network.NewDNSResolver(d.server.DNS)
+	}
+	d.domains = network.NewDomainRouter(matcher, d.routes, iface, resolve)
+	if pa, ok := d.tunnel.(prefixAllower); ok {
+		d.domains.AllowPrefix = pa.AllowPrefix
+		d.domains.RemovePrefix = pa.RemovePrefix
+	}
+	go d.domains.Run(ctx)
+	slog.Info("domain routing enabled", "include", d.server.IncludeDomains, "exclude", d.server.ExcludeDomains)
+
+	if len(d.server.DNS) == 0 {
+		slog.Warn("no DNS servers configured; wildcard domains will not be routed")
+		return ""
+	}
+	proxy, err := network.NewDNSProxy(network.DefaultDNSProxyAddr, d.server.DNS, d.domains.Observe)
+	if err != nil {
+		slog.Warn("failed to start DNS proxy; wildcard domains will not be routed", "error", err)
+		return ""
+	}
+	d.dnsProxy = proxy
+	go proxy.Serve()
+	slog.Debug("DNS proxy started", "addr", proxy.Addr(), "upstream", d.server.DNS)
+	return proxy.Addr().(*net.UDPAddr).IP.String()
+}
+
+// startUAPI lets `wg show` and friends see the tunnel. Tunnels without a
+// wireguard-go device (kernel backend, OpenVPN) are skipped.
+func (d *Daemon) startUAPI() {
+	us, ok := d.tunnel.(uapiServer)
+	if !ok {
+		return
+	}
+	uapi, err := us.ServeUAPI()
+	if err != nil {
+		slog.Warn("failed to open UAPI socket", "error", err)
+		return
+	}
+	d.uapi = uapi
+	slog.Debug("UAPI socket opened", "interface", d.iface)
+}
+
+// startSOCKSProxy serves SOCKS5 on the configured address, dialing through
+// the tunnel when it supports it and through the host stack otherwise.
+func (d *Daemon) startSOCKSProxy(cfg *config.ProxyConfig) {
+	listen, creds, dialer := d.proxySettings(cfg, proxy.DefaultSOCKSAddr)
+	socks, err := proxy.NewSOCKS5(listen, creds, dialer)
+	if err != nil {
+		slog.Warn("failed to start SOCKS5 proxy", "error", err)
+		return
+	}
+	warnOpenProxy("SOCKS5", socks.Addr(), creds)
+	d.socks = socks
+	go socks.Serve()
+	slog.Info("SOCKS5 proxy started", "addr", socks.Addr(), "auth", creds != nil)
+}
+
+// startHTTPProxy serves HTTP CONNECT and forward requests like startSOCKSProxy.
+func (d *Daemon) startHTTPProxy(cfg *config.ProxyConfig) {
+	listen, creds, dialer := d.proxySettings(cfg, proxy.DefaultHTTPAddr)
+	hp, err := proxy.NewHTTP(listen, creds, dialer)
+	if err != nil {
+		slog.Warn("failed to start HTTP proxy", "error", err)
+		return
+	}
+	warnOpenProxy("HTTP", hp.Addr(), creds)
+	d.httpProxy = hp
+	go hp.Serve()
+	slog.Info("HTTP proxy started", "addr", hp.Addr(), "auth", creds != nil)
+}
+
+func (d *Daemon) proxySettings(cfg *config.ProxyConfig, defaultAddr string) (string, *proxy.Credentials, tunnel.Dialer) {
+	listen := cfg.Listen
+	if listen == "" {
+		listen = defaultAddr
+	}
+	var creds *proxy.Credentials
+	if cfg.Username != "" {
+		creds = &proxy.Credentials{Username: cfg.Username, Password: cfg.Password}
+	}
+	dialer, ok := d.tunnel.(tunnel.Dialer)
+	if !ok {
+		dialer = &net.Dialer{}
+	}
+	return listen, creds, dialer
+}
+
+func warnOpenProxy(kind string, addr net.Addr, creds *proxy.Credentials) {
+	if tcp, ok := addr.(*net.TCPAddr); ok && !tcp.IP.IsLoopback() && creds == nil {
+		slog.Warn(kind+" proxy is reachable from other hosts without authentication", "addr", addr)
+	}
+}
+
+// proxyConnections lists the active sessions of all running proxies.
+func (d *Daemon) proxyConnections() []proxy.ConnStats {
+	var conns []proxy.ConnStats
+	if d.socks != nil {
+		conns = append(conns, d.socks.Connections()...)
+	}
+	if d.httpProxy != nil {
+		conns = append(conns, d.httpProxy.Connections()...)
+	}
+	return conns
+}
+
 func (d *Daemon) handleIPC(req *IPCRequest) *IPCResponse {
 	slog.Debug("IPC request", "command", req.Command)
 	switch req.Command {
@@ -146,21 +464,162 @@ func (d *Daemon) handleIPC(req *IPCRequest) *IPCResponse {
 		// Update traffic stats
 		if d.tunnel != nil {
 			if status, err := d.tunnel.Status(); err == nil {
+				// OpenVPN may be pushed a new address, or fail over to
+				// another remote, when it reconnects
+				if status.TunnelIP != "" {
+					state.TunnelIP = status.TunnelIP
+				}
+				if status.Endpoint != "" {
+					state.Endpoint = status.Endpoint
+				}
+				if status.InterfaceName != "" {
+					state.InterfaceName = status.InterfaceName
+				}
 				state.TxBytes = status.TxBytes
 				state.RxBytes = status.RxBytes
+				state.LastHandshake = status.LastHandshake
+				state.HandshakePending = status.HandshakePending
 			}
 		}
+		state.ProxyConnections = d.proxyConnections()
+		state.Forwards = d.forwardList()
 		return &IPCResponse{Success: true, State: state}
 	case "disconnect":
 		if d.cancel != nil {
 			d.cancel()
 		}
 		return &IPCResponse{Success: true}
+	case "app-split":
+		mode, err := network.ParseAppMode(req.Args["mode"])
+		if err != nil {
+			return &IPCResponse{Success: false, Error: err.Error()}
+		}
+		if d.userspace {
+			return &IPCResponse{Success: false, Error: "per-application split tunneling is not available in userspace mode"}
+		}
+		if d.namespace != nil {
+			return &IPCResponse{Success: false, Error: fmt.Sprintf("per-application split tunneling is not available in namespace mode; use 'voidvpn exec %s -- <command>'", d.server.Name)}
+		}
+		if d.appSplit == nil {
+			return &IPCResponse{Success: false, Error: "per-application split tunneling is not available"}
+		}
+		d.appMu.Lock()
+		err = d.appSplit.Enable(d.iface)
+		d.appMu.Unlock()
+		if err != nil {
+			return &IPCResponse{Success: false, Error: err.Error()}
+		}
+		return &IPCResponse{Success: true, Data: map[string]string{"cgroup": d.appSplit.CgroupDir(mode)}}
+	case "forward-add":
+		return d.addForward(req.Args)
+	case "forward-remove":
+		return d.removeForward(req.Args["id"])
 	default:
 		return &IPCResponse{Success: false, Error: "unknown command"}
 	}
 }
 
+// addForward starts a port forward. Forwards listen on the host and dial
+// through the tunnel; reverse forwards listen on the tunnel address and dial
+// the host.
+func (d *Daemon) addForward(args map[string]string) *IPCResponse {
+	// The host side of a forward is outside the namespace, where the tunnel
+	// can neither be dialed nor listened on
+	if d.namespace != nil {
+		return &IPCResponse{Success: false, Error: fmt.Sprintf("port forwards are not available in namespace mode; use 'voidvpn exec %s -- <command>'", d.server.Name)}
+	}
+	spec, err := proxy.ParseForwardSpec(args["spec"], args["reverse"] == "true", args["proto"])
+	if err != nil {
+		return &IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	var fwd *proxy.Forward
+	if spec.Reverse {
+		tunnelIP := d.tunnelIP()
+		if !tunnelIP.IsValid() {
+			return &IPCResponse{Success: false, Error: "tunnel address is unknown; reverse forwards need the server's address"}
+		}
+		_, port, _ := net.SplitHostPort(spec.Remote)
+		spec.Remote = net.JoinHostPort(tunnelIP.String(), port)
+		var ln tunnel.Listener = proxy.HostNetwork{}
+		if tl, ok := d.tunnel.(tunnel.Listener); ok {
+			ln = tl
+		}
+		fwd, err = proxy.NewForward(spec, ln, spec.Remote, proxy.HostNetwork{}, spec.Local)
+	} else {
+		var dialer tunnel.Dialer = proxy.HostNetwork{}
+		if td, ok := d.tunnel.(tunnel.Dialer); ok {
+			dialer = td
+		}
+		fwd, err = proxy.NewForward(spec, proxy.HostNetwork{}, spec.Local, dialer, spec.Remote)
+	}
+	if err != nil {
+		return &IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	d.fwdMu.Lock()
+	if d.forwards == nil {
+		d.forwards = make(map[int]*proxy.Forward)
+	}
+	d.nextFwd++
+	id := d.nextFwd
+	d.forwards[id] = fwd
+	d.fwdMu.Unlock()
+
+	go fwd.Serve()
+	slog.Info("port forward added", "id", id, "forward", spec)
+	return &IPCResponse{Success: true, Data: map[string]string{"id": strconv.Itoa(id), "listen": fwd.Addr().String()}}
+}
+
+func (d *Daemon) removeForward(idArg string) *IPCResponse {
+	id, err := strconv.Atoi(idArg)
+	if err != nil {
+		return &IPCResponse{Success: false, Error: fmt.Sprintf("invalid forward id %q", idArg)}
+	}
+	d.fwdMu.Lock()
+	fwd, ok := d.forwards[id]
+	delete(d.forwards, id)
+	d.fwdMu.Unlock()
+	if !ok {
+		return &IPCResponse{Success: false, Error: fmt.Sprintf("no forward with id %d", id)}
+	}
+	fwd.Close()
+	slog.Info("port forward removed", "id", id, "forward", fwd.Spec())
+	return &IPCResponse{Success: true}
+}
+
+// forwardList describes the active forwards, ordered by id.
+func (d *Daemon) forwardList() []ForwardInfo {
+	d.fwdMu.Lock()
+	defer d.fwdMu.Unlock()
+	var list []ForwardInfo
+	for id, fwd := range d.forwards {
+		list = append(list, ForwardInfo{
+			ID:          id,
+			ForwardSpec: fwd.Spec(),
+			Listen:      fwd.Addr().String(),
+			Connections: len(fwd.Connections()),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// tunnelIP returns the first address of the tunnel interface.
+func (d *Daemon) tunnelIP() netip.Addr {
+	address := d.address
+	if address == "" {
+		address = d.server.Address
+	}
+	first, _, _ := strings.Cut(address, ",")
+	first = strings.TrimSpace(first)
+	if prefix, err := netip.ParsePrefix(first); err == nil {
+		return prefix.Addr()
+	}
+	addr, _ := netip.ParseAddr(first)
+	return addr
+}
+
 func (d *Daemon) cleanup() {
 	slog.Info("cleaning up")
 
@@ -168,6 +627,35 @@ func (d *Daemon) cleanup() {
 		d.ipc.Close()
 	}
 
+	if d.socks != nil {
+		d.socks.Close()
+	}
+	if d.httpProxy != nil {
+		d.httpProxy.Close()
+	}
+	d.fwdMu.Lock()
+	for id, fwd := range d.forwards {
+		fwd.Close()
+		delete(d.forwards, id)
+	}
+	d.fwdMu.Unlock()
+
+	// Stop domain routing so no host routes are added while tearing down
+	if d.dnsProxy != nil {
+		d.dnsProxy.Close()
+	}
+	if d.domains != nil {
+		d.domains.Close()
+	}
+
+	if d.appSplit != nil {
+		d.appMu.Lock()
+		if err := d.appSplit.Disable(); err != nil {
+			slog.Warn("failed to remove application split rules", "error", err)
+		}
+		d.appMu.Unlock()
+	}
+
 	// Remove routes before disconnecting tunnel (routes reference the tunnel gateway)
 	if err := d.routes.RemoveVPNRoutes(); err != nil {
 		slog.Warn("failed to remove VPN routes", "error", err)
@@ -178,7 +666,16 @@ func (d *Daemon) cleanup() {
 	d.dns.Restore()
 	slog.Debug("DNS restored")
 
+	if d.uapi != nil {
+		d.uapi.Close()
+	}
 	d.tunnel.Disconnect()
+	// The interface is gone with the tunnel, so the namespace is empty now
+	if d.namespace != nil {
+		if err := d.namespace.Teardown(); err != nil {
+			slog.Warn("failed to remove network namespace", "error", err)
+		}
+	}
 	ClearState()
 
 	slog.Info("cleanup complete")
@@ -3,12 +3,18 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/network"
 	"github.com/voidvpn/voidvpn/internal/tunnel"
 )
 
@@ -74,7 +80,7 @@ type mockRoutes struct {
 	removed   bool
 }
 
-func (m *mockRoutes) AddVPNRoutes(iface string, endpoint string, ipv6 bool) error {
+func (m *mockRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
 	m.added = true
 	return m.addErr
 }
@@ -84,6 +90,18 @@ func (m *mockRoutes) RemoveVPNRoutes() error {
 	return m.removeErr
 }
 
+func (m *mockRoutes) AddRoute(prefix netip.Prefix, iface string) error {
+	return m.addErr
+}
+
+func (m *mockRoutes) AddBypassRoute(prefix netip.Prefix) error {
+	return m.addErr
+}
+
+func (m *mockRoutes) DeleteRoute(prefix netip.Prefix) error {
+	return m.removeErr
+}
+
 func setupDaemonTest(t *testing.T) func() {
 	t.Helper()
 	origAppdata := os.Getenv("APPDATA")
@@ -111,6 +129,17 @@ func TestNewDaemon(t *testing.T) {
 	if d.server != server {
 		t.Error("server not set correctly")
 	}
+	if !d.UAPI {
+		t.Error("UAPI socket should be enabled by default")
+	}
+	if d.namespace != nil {
+		t.Error("namespace mode should be off unless the server enables it")
+	}
+
+	d = New(tun, &config.ServerConfig{Name: "My Server", Namespace: true})
+	if d.namespace == nil || d.namespace.Name() != "voidvpn-my-server" {
+		t.Errorf("namespace = %v, want voidvpn-my-server", d.namespace)
+	}
 }
 
 func TestHandleIPCStatus(t *testing.T) {
@@ -231,6 +260,30 @@ func TestHandleIPCStatusUpdatesTraffic(t *testing.T) {
 	}
 }
 
+func TestHandleIPCStatusFollowsReconnect(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+
+	tun := &mockTunnel{
+		statusResp: &tunnel.TunnelStatus{
+			InterfaceName: "tun1",
+			TunnelIP:      "10.8.0.6",
+			Endpoint:      "vpn2.example.com:443",
+		},
+	}
+	d := &Daemon{tunnel: tun, server: &config.ServerConfig{Name: "test", Protocol: "openvpn"}}
+
+	SaveState(&ConnectionState{Server: "test", PID: os.Getpid(), InterfaceName: "tun0", TunnelIP: "10.8.0.2", Endpoint: "vpn1.example.com:1194"})
+
+	resp := d.handleIPC(&IPCRequest{Command: "status"})
+	if !resp.Success {
+		t.Fatalf("status failed: %s", resp.Error)
+	}
+	if resp.State.InterfaceName != "tun1" || resp.State.TunnelIP != "10.8.0.6" || resp.State.Endpoint != "vpn2.example.com:443" {
+		t.Errorf("state = %+v, want the tunnel's current interface, address and remote", resp.State)
+	}
+}
+
 func TestCleanupCallsAll(t *testing.T) {
 	cleanup := setupDaemonTest(t)
 	defer cleanup()
@@ -259,6 +312,65 @@ func TestCleanupCallsAll(t *testing.T) {
 	}
 }
 
+type mockAppSplit struct {
+	enabledIface string
+	disabled     bool
+}
+
+func (m *mockAppSplit) Enable(iface string) error {
+	m.enabledIface = iface
+	return nil
+}
+
+func (m *mockAppSplit) Disable() error {
+	m.disabled = true
+	return nil
+}
+
+func (m *mockAppSplit) CgroupDir(mode network.AppMode) string {
+	return "/sys/fs/cgroup/voidvpn/" + string(mode)
+}
+
+func TestHandleIPCAppSplit(t *testing.T) {
+	split := &mockAppSplit{}
+	d := &Daemon{appSplit: split, iface: "voidvpn0"}
+
+	resp := d.handleIPC(&IPCRequest{Command: "app-split", Args: map[string]string{"mode": "bypass"}})
+	if !resp.Success {
+		t.Fatalf("app-split failed: %s", resp.Error)
+	}
+	if split.enabledIface != "voidvpn0" {
+		t.Errorf("Enable called with %q, want voidvpn0", split.enabledIface)
+	}
+	if resp.Data["cgroup"] != "/sys/fs/cgroup/voidvpn/bypass" {
+		t.Errorf("cgroup = %q, want /sys/fs/cgroup/voidvpn/bypass", resp.Data["cgroup"])
+	}
+
+	resp = d.handleIPC(&IPCRequest{Command: "app-split", Args: map[string]string{"mode": "sideways"}})
+	if resp.Success {
+		t.Error("app-split with invalid mode should fail")
+	}
+}
+
+func TestCleanupDisablesAppSplit(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+
+	split := &mockAppSplit{}
+	d := &Daemon{
+		tunnel:   &mockTunnel{},
+		server:   &config.ServerConfig{Name: "test"},
+		dns:      &mockDNS{},
+		routes:   &mockRoutes{},
+		appSplit: split,
+	}
+	d.cleanup()
+
+	if !split.disabled {
+		t.Error("appSplit.Disable() not called")
+	}
+}
+
 func TestLoadStateInvalidJSON(t *testing.T) {
 	cleanup := setupDaemonTest(t)
 	defer cleanup()
@@ -301,3 +413,497 @@ func TestRunTunnelConnectError(t *testing.T) {
 		t.Errorf("error should contain 'connection refused': %v", err)
 	}
 }
+
+func TestRunUserspaceSkipsHostNetwork(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	tun := &mockTunnel{statusResp: &tunnel.TunnelStatus{InterfaceName: "go", Userspace: true}}
+	routes := &mockRoutes{}
+	dns := &mockDNS{}
+	// No address: assigning one would fail, so this also proves it is skipped
+	server := &config.ServerConfig{Name: "test", Protocol: "wireguard", DNS: []string{"10.0.0.1"}}
+	d := &Daemon{
+		tunnel:    tun,
+		server:    server,
+		dns:       dns,
+		routes:    routes,
+		Connected: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Run(ctx) }()
+
+	select {
+	case <-d.Connected:
+	case err := <-errCh:
+		t.Fatalf("Run() returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if routes.added {
+		t.Error("userspace mode should not add host routes")
+	}
+	if dns.setCalled {
+		t.Error("userspace mode should not change host DNS")
+	}
+	if resp := d.handleIPC(&IPCRequest{Command: "app-split", Args: map[string]string{"mode": "bypass"}}); resp.Success {
+		t.Error("app-split should be rejected in userspace mode")
+	}
+}
+
+// pushTunnel is a mockTunnel whose server pushed DNS settings.
+type pushTunnel struct {
+	mockTunnel
+	servers, domains []string
+}
+
+func (m *pushTunnel) PushedDNS() ([]string, []string) { return m.servers, m.domains }
+
+// searchDNS is a mockDNS that also takes search domains.
+type searchDNS struct {
+	mockDNS
+	servers, domains []string
+}
+
+func (m *searchDNS) SetWithSearch(iface string, servers, domains []string) error {
+	m.servers, m.domains = servers, domains
+	return m.Set(iface, servers)
+}
+
+func TestSetPushedDNS(t *testing.T) {
+	tun := &pushTunnel{servers: []string{"10.8.0.1"}, domains: []string{"corp.example"}}
+
+	dns := &searchDNS{}
+	d := &Daemon{tunnel: tun, server: &config.ServerConfig{Name: "test", Protocol: "openvpn"}, dns: dns}
+	d.setPushedDNS("tun0")
+	if !reflect.DeepEqual(dns.servers, tun.servers) || !reflect.DeepEqual(dns.domains, tun.domains) {
+		t.Errorf("DNS set to %q search %q, want the pushed %q search %q", dns.servers, dns.domains, tun.servers, tun.domains)
+	}
+
+	// Imported profiles get default DNS servers, which only stand in for
+	// pushed ones
+	ovpnPath := filepath.Join(t.TempDir(), "corp.ovpn")
+	if err := os.WriteFile(ovpnPath, []byte("client\nremote vpn.example.com 1194\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	imported, _, err := config.ImportOpenVPNConfig(ovpnPath)
+	if err != nil {
+		t.Fatalf("ImportOpenVPNConfig() error: %v", err)
+	}
+	dns = &searchDNS{}
+	d = &Daemon{tunnel: tun, server: imported, dns: dns}
+	d.setPushedDNS("tun0")
+	if !reflect.DeepEqual(dns.servers, tun.servers) || !reflect.DeepEqual(dns.domains, tun.domains) {
+		t.Errorf("DNS set to %q search %q, want the pushed %q search %q", dns.servers, dns.domains, tun.servers, tun.domains)
+	}
+
+	// Without pushed servers the server file's are used
+	dns = &searchDNS{}
+	d = &Daemon{tunnel: &pushTunnel{}, server: imported, dns: dns}
+	d.setPushedDNS("tun0")
+	if !reflect.DeepEqual(dns.servers, imported.DNS) || dns.domains != nil {
+		t.Errorf("DNS set to %q search %q, want %q without search domains", dns.servers, dns.domains, imported.DNS)
+	}
+
+	// Nothing pushed and nothing configured leaves DNS alone
+	dns = &searchDNS{}
+	d = &Daemon{tunnel: &pushTunnel{}, server: &config.ServerConfig{Name: "test", Protocol: "openvpn"}, dns: dns}
+	d.setPushedDNS("tun0")
+	if dns.setCalled {
+		t.Error("DNS should not be changed when no servers were pushed")
+	}
+}
+
+// waitForState returns the connection state, which Run saves just after
+// signalling Connected.
+func waitForState(t *testing.T) *ConnectionState {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, err := LoadState()
+		if err == nil {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("LoadState() error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// eventTunnel is a mockTunnel that reports events.
+type eventTunnel struct {
+	mockTunnel
+	events chan tunnel.Event
+}
+
+func (m *eventTunnel) Events() <-chan tunnel.Event { return m.events }
+
+func TestRunDisconnectsOnFatalEvent(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	tun := &eventTunnel{
+		mockTunnel: mockTunnel{statusResp: &tunnel.TunnelStatus{InterfaceName: "tun3", TunnelIP: "10.8.0.2", Endpoint: "1.2.3.4:1194"}},
+		events:     make(chan tunnel.Event, 2),
+	}
+	server := &config.ServerConfig{Name: "test", Protocol: "openvpn"}
+	d := &Daemon{
+		tunnel:    tun,
+		server:    server,
+		dns:       &mockDNS{},
+		routes:    &mockRoutes{},
+		Connected: make(chan struct{}),
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Run(context.Background()) }()
+
+	select {
+	case <-d.Connected:
+	case err := <-errCh:
+		t.Fatalf("Run() returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+	// The profile has no address or endpoint; both come from the tunnel
+	state := waitForState(t)
+	if state.InterfaceName != "tun3" || state.TunnelIP != "10.8.0.2" || state.Endpoint != "1.2.3.4:1194" {
+		t.Errorf("state = %+v, want the tunnel's interface, address and endpoint", state)
+	}
+	tun.events <- tunnel.Event{Time: time.Now(), Type: tunnel.EventState, Message: "RECONNECTING"}
+	tun.events <- tunnel.Event{Time: time.Now(), Type: tunnel.EventFatal, Message: "management interface closed"}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after a fatal event")
+	}
+	if !tun.disconnected {
+		t.Error("tunnel should be disconnected after a fatal event")
+	}
+}
+
+type mockNamespace struct {
+	iface    string
+	cfg      network.NamespaceConfig
+	tornDown bool
+}
+
+func (m *mockNamespace) Name() string { return "voidvpn-test" }
+
+func (m *mockNamespace) Setup(iface string, cfg network.NamespaceConfig) error {
+	m.iface, m.cfg = iface, cfg
+	return nil
+}
+
+func (m *mockNamespace) Teardown() error {
+	m.tornDown = true
+	return nil
+}
+
+func TestRunNamespaceSkipsHostNetwork(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	tun := &mockTunnel{statusResp: &tunnel.TunnelStatus{InterfaceName: "voidvpn0"}}
+	routes := &mockRoutes{}
+	dns := &mockDNS{}
+	ns := &mockNamespace{}
+	server := &config.ServerConfig{
+		Name:       "test",
+		Protocol:   "wireguard",
+		Address:    "10.0.0.2/32",
+		AllowedIPs: []string{"0.0.0.0/0"},
+		ExcludeIPs: []string{"192.168.0.0/16"},
+		DNS:        []string{"10.0.0.1"},
+		SOCKSProxy: &config.ProxyConfig{Listen: "127.0.0.1:0"},
+	}
+	d := &Daemon{
+		tunnel:    tun,
+		server:    server,
+		dns:       dns,
+		routes:    routes,
+		namespace: ns,
+		Connected: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Run(ctx) }()
+
+	select {
+	case <-d.Connected:
+	case err := <-errCh:
+		t.Fatalf("Run() returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+
+	if ns.iface != "voidvpn0" {
+		t.Errorf("namespace set up for %q, want voidvpn0", ns.iface)
+	}
+	if ns.cfg.Address != "10.0.0.2/32" || len(ns.cfg.DNS) != 1 {
+		t.Errorf("namespace config = %+v", ns.cfg)
+	}
+	for _, p := range ns.cfg.Routes {
+		if p.Contains(netip.MustParseAddr("192.168.1.1")) {
+			t.Errorf("namespace route %s covers an excluded address", p)
+		}
+	}
+	if state := waitForState(t); state.Namespace != "voidvpn-test" {
+		t.Errorf("state namespace = %q, want voidvpn-test", state.Namespace)
+	}
+	if resp := d.handleIPC(&IPCRequest{Command: "app-split", Args: map[string]string{"mode": "bypass"}}); resp.Success {
+		t.Error("app-split should be rejected in namespace mode")
+	}
+	if d.socks != nil {
+		t.Error("the SOCKS5 proxy would dial around the tunnel in namespace mode")
+	}
+	if resp := d.handleIPC(&IPCRequest{Command: "forward-add", Args: map[string]string{"spec": "127.0.0.1:18080:10.0.0.1:80"}}); resp.Success {
+		t.Error("port forwards should be rejected in namespace mode")
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if routes.added {
+		t.Error("namespace mode should not add host routes")
+	}
+	if dns.setCalled {
+		t.Error("namespace mode should not change host DNS")
+	}
+	if !ns.tornDown {
+		t.Error("namespace should be torn down on disconnect")
+	}
+}
+
+func TestStartSOCKSProxy(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+
+	d := &Daemon{
+		tunnel: &mockTunnel{},
+		server: &config.ServerConfig{Name: "test"},
+		dns:    &mockDNS{},
+		routes: &mockRoutes{},
+	}
+	d.startSOCKSProxy(&config.ProxyConfig{Listen: "127.0.0.1:0"})
+	if d.socks == nil {
+		t.Fatal("SOCKS5 proxy was not started")
+	}
+	addr := d.socks.Addr().String()
+	if c, err := net.Dial("tcp", addr); err != nil {
+		t.Fatalf("proxy not reachable: %v", err)
+	} else {
+		c.Close()
+	}
+
+	d.cleanup()
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Error("proxy still listening after cleanup")
+	}
+}
+
+type uapiTunnel struct {
+	mockTunnel
+	closed bool
+}
+
+func (u *uapiTunnel) ServeUAPI() (io.Closer, error) {
+	return closerFunc(func() error { u.closed = true; return nil }), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestStartUAPI(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+
+	tun := &uapiTunnel{}
+	d := &Daemon{
+		tunnel: tun,
+		server: &config.ServerConfig{Name: "test"},
+		dns:    &mockDNS{},
+		routes: &mockRoutes{},
+	}
+	d.startUAPI()
+	if d.uapi == nil {
+		t.Fatal("UAPI socket was not opened")
+	}
+	d.cleanup()
+	if !tun.closed {
+		t.Error("UAPI socket not closed on cleanup")
+	}
+
+	// Tunnels without a wireguard-go device are left alone
+	d = &Daemon{tunnel: &mockTunnel{}}
+	d.startUAPI()
+	if d.uapi != nil {
+		t.Error("UAPI opened for a tunnel that does not support it")
+	}
+}
+
+func TestHandleIPCStatusProxyConnections(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+	if err := SaveState(&ConnectionState{Server: "test"}); err != nil {
+		t.Fatalf("SaveState error: %v", err)
+	}
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		if c, err := echo.Accept(); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	d := &Daemon{
+		tunnel: &mockTunnel{},
+		server: &config.ServerConfig{Name: "test"},
+		dns:    &mockDNS{},
+		routes: &mockRoutes{},
+	}
+	d.startHTTPProxy(&config.ProxyConfig{Listen: "127.0.0.1:0"})
+	if d.httpProxy == nil {
+		t.Fatal("HTTP proxy was not started")
+	}
+	defer d.httpProxy.Close()
+
+	c, err := net.Dial("tcp", d.httpProxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	fmt.Fprintf(c, "CONNECT %s HTTP/1.1\r\n\r\n", echo.Addr())
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 64)); err != nil {
+		t.Fatalf("CONNECT reply error: %v", err)
+	}
+
+	resp := d.handleIPC(&IPCRequest{Command: "status"})
+	if !resp.Success {
+		t.Fatalf("status failed: %s", resp.Error)
+	}
+	conns := resp.State.ProxyConnections
+	if len(conns) != 1 || conns[0].Target != echo.Addr().String() {
+		t.Errorf("ProxyConnections = %+v, want the CONNECT session", conns)
+	}
+}
+
+func TestHandleIPCForward(t *testing.T) {
+	cleanup := setupDaemonTest(t)
+	defer cleanup()
+	if err := SaveState(&ConnectionState{Server: "test"}); err != nil {
+		t.Fatalf("SaveState error: %v", err)
+	}
+
+	d := &Daemon{
+		tunnel: &mockTunnel{},
+		// The mock tunnel has no listener, so reverse forwards bind the host
+		server: &config.ServerConfig{Name: "test", Address: "127.0.0.1/8"},
+		dns:    &mockDNS{},
+		routes: &mockRoutes{},
+	}
+	defer d.cleanup()
+
+	resp := d.handleIPC(&IPCRequest{Command: "forward-add", Args: map[string]string{"spec": "0:10.20.0.5:5432"}})
+	if resp.Success {
+		t.Error("forward-add should reject port 0")
+	}
+
+	resp = d.handleIPC(&IPCRequest{Command: "forward-add", Args: map[string]string{"spec": "127.0.0.1:0:10.20.0.5:5432"}})
+	if resp.Success {
+		t.Error("forward-add should reject port 0 with an explicit host")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	resp = d.handleIPC(&IPCRequest{Command: "forward-add", Args: map[string]string{
+		"spec": "3000:" + port, "reverse": "true", "proto": "udp",
+	}})
+	if !resp.Success {
+		t.Fatalf("forward-add failed: %s", resp.Error)
+	}
+	if want := "127.0.0.1:" + port; resp.Data["listen"] != want {
+		t.Errorf("listen = %q, want %q", resp.Data["listen"], want)
+	}
+
+	status := d.handleIPC(&IPCRequest{Command: "status"})
+	if fw := status.State.Forwards; len(fw) != 1 || fw[0].Remote != "127.0.0.1:"+port || !fw[0].Reverse {
+		t.Errorf("Forwards = %+v, want the reverse forward", fw)
+	}
+
+	if resp := d.handleIPC(&IPCRequest{Command: "forward-remove", Args: map[string]string{"id": resp.Data["id"]}}); !resp.Success {
+		t.Errorf("forward-remove failed: %s", resp.Error)
+	}
+	if resp := d.handleIPC(&IPCRequest{Command: "forward-remove", Args: map[string]string{"id": "42"}}); resp.Success {
+		t.Error("forward-remove should fail for unknown ids")
+	}
+	if status := d.handleIPC(&IPCRequest{Command: "status"}); len(status.State.Forwards) != 0 {
+		t.Errorf("Forwards = %+v after remove, want none", status.State.Forwards)
+	}
+}
+
+type markingTunnel struct {
+	mockTunnel
+	mark uint32
+}
+
+func (m *markingTunnel) SetFwMark(mark uint32) {
+	m.mark = mark
+}
+
+func TestNewSetsFwMarkOnlyForPolicyRouting(t *testing.T) {
+	tun := &markingTunnel{}
+	d := New(tun, &config.ServerConfig{Name: "test", Protocol: "wireguard", RoutingStrategy: string(network.RoutePolicy)})
+	want := uint32(0)
+	if d.strategy == network.RoutePolicy {
+		want = network.PolicyRoutingMark
+	}
+	if tun.mark != want {
+		t.Errorf("mark = %d with strategy %q, want %d", tun.mark, d.strategy, want)
+	}
+
+	// OpenVPN always falls back to split routes
+	tun = &markingTunnel{}
+	New(tun, &config.ServerConfig{Name: "test", Protocol: "openvpn", RoutingStrategy: string(network.RoutePolicy)})
+	if tun.mark != 0 {
+		t.Errorf("mark = %d after falling back to split routes, want 0", tun.mark)
+	}
+
+	tun = &markingTunnel{}
+	New(tun, &config.ServerConfig{Name: "test", Protocol: "wireguard"})
+	if tun.mark != 0 {
+		t.Errorf("mark = %d with split routing, want 0", tun.mark)
+	}
+}
@@ -6,13 +6,29 @@ import (
 )
 
 type IPCRequest struct {
-	Command string `json:"command"` // "status", "disconnect"
+	Command string            `json:"command"` // "status", "disconnect", "app-split"
+	Args    map[string]string `json:"args,omitempty"`
 }
 
 type IPCResponse struct {
-	Success bool             `json:"success"`
-	Error   string           `json:"error,omitempty"`
-	State   *ConnectionState `json:"state,omitempty"`
+	Success bool              `json:"success"`
+	Error   string            `json:"error,omitempty"`
+	State   *ConnectionState  `json:"state,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// SendIPCRequest sends a command without arguments to the running daemon.
+func SendIPCRequest(cmd string) (*IPCResponse, error) {
+	return SendIPCRequestArgs(cmd, nil)
+}
+
+// SendIPCRequestArgs sends a command with arguments to the running daemon.
+func SendIPCRequestArgs(cmd string, args map[string]string) (*IPCResponse, error) {
+	reqData, err := json.Marshal(&IPCRequest{Command: cmd, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	return sendIPC(reqData)
 }
 
 func MarshalRequest(cmd string) ([]byte, error) {
@@ -89,7 +89,7 @@ func (s *IPCServer) Close() error {
 	return s.listener.Close()
 }
 
-func SendIPCRequest(cmd string) (*IPCResponse, error) {
+func sendIPC(reqData []byte) (*IPCResponse, error) {
 	sockPath := getSocketPath()
 	conn, err := net.DialTimeout("unix", sockPath, 3*time.Second)
 	if err != nil {
@@ -97,11 +97,6 @@ func SendIPCRequest(cmd string) (*IPCResponse, error) {
 	}
 	defer conn.Close()
 
-	reqData, err := MarshalRequest(cmd)
-	if err != nil {
-		return nil, err
-	}
-
 	conn.SetDeadline(time.Now().Add(5 * time.Second))
 	if _, err := conn.Write(append(reqData, '\n')); err != nil {
 		return nil, err
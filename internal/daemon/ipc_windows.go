@@ -115,7 +115,7 @@ func (s *IPCServer) Close() error {
 	return s.listener.Close()
 }
 
-func SendIPCRequest(cmd string) (*IPCResponse, error) {
+func sendIPC(reqData []byte) (*IPCResponse, error) {
 	// Read auth token
 	tokenData, err := os.ReadFile(ipcTokenPath())
 	if err != nil {
@@ -137,10 +137,6 @@ func SendIPCRequest(cmd string) (*IPCResponse, error) {
 	}
 
 	// Send command
-	reqData, err := MarshalRequest(cmd)
-	if err != nil {
-		return nil, err
-	}
 	if _, err := conn.Write(append(reqData, '\n')); err != nil {
 		return nil, err
 	}
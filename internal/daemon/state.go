@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/proxy"
 )
 
 type ConnectionState struct {
@@ -18,7 +19,27 @@ type ConnectionState struct {
 	PID           int       `json:"pid"`
 	TxBytes       int64     `json:"tx_bytes"`
 	RxBytes       int64     `json:"rx_bytes"`
+	LastHandshake time.Time `json:"last_handshake"`
 	Protocol      string    `json:"protocol"`
+	Userspace     bool      `json:"userspace,omitempty"`
+	Namespace     string    `json:"namespace,omitempty"`
+	SOCKSProxy    string    `json:"socks_proxy,omitempty"`
+	HTTPProxy     string    `json:"http_proxy,omitempty"`
+
+	// HandshakePending is set while the tunnel has no live WireGuard session
+	HandshakePending bool `json:"handshake_pending,omitempty"`
+
+	// Live proxy sessions and port forwards; only filled in over IPC
+	ProxyConnections []proxy.ConnStats `json:"proxy_connections,omitempty"`
+	Forwards         []ForwardInfo     `json:"forwards,omitempty"`
+}
+
+// ForwardInfo describes an active port forward.
+type ForwardInfo struct {
+	ID int `json:"id"`
+	proxy.ForwardSpec
+	Listen      string `json:"listen"`
+	Connections int    `json:"connections"`
 }
 
 func SaveState(state *ConnectionState) error {
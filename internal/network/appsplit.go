@@ -0,0 +1,42 @@
+package network
+
+import "fmt"
+
+// AppMode selects how traffic from an application launched with
+// `voidvpn exec` is routed relative to the tunnel.
+type AppMode string
+
+const (
+	// AppBypass sends the application's traffic around the tunnel.
+	AppBypass AppMode = "bypass"
+	// AppOnlyVPN forces the application's traffic into the tunnel and blocks
+	// it when the tunnel is down.
+	AppOnlyVPN AppMode = "vpn"
+)
+
+// ParseAppMode validates an application routing mode.
+func ParseAppMode(s string) (AppMode, error) {
+	switch AppMode(s) {
+	case AppBypass, AppOnlyVPN:
+		return AppMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid application mode %q", s)
+	}
+}
+
+// AppSplitManager steers traffic of processes placed in dedicated cgroups
+// into or around the tunnel using packet marks and policy routing.
+type AppSplitManager interface {
+	// Enable sets up cgroups, packet marking and routing rules for iface.
+	// Calling it again while enabled is a no-op.
+	Enable(iface string) error
+	// Disable removes everything Enable set up. It is a no-op if not enabled.
+	Disable() error
+	// CgroupDir returns the cgroup directory for processes in the given mode.
+	CgroupDir(mode AppMode) string
+}
+
+// NewAppSplitManager returns a platform-appropriate application split manager.
+func NewAppSplitManager() AppSplitManager {
+	return newAppSplitManager()
+}
@@ -0,0 +1,345 @@
+//go:build linux
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	appCgroupRoot   = "/sys/fs/cgroup"
+	appCgroupParent = "voidvpn"
+	appNftTable     = "voidvpn"
+
+	// Packet marks double as routing table numbers for readability in `ip rule`.
+	appBypassMark  = 0x7601
+	appOnlyVPNMark = 0x7602
+
+	srcValidMarkPath = "/proc/sys/net/ipv4/conf/all/src_valid_mark"
+)
+
+type linuxAppSplit struct {
+	iface        string
+	enabled      bool
+	undo         [][]string // commands that revert each applied step, in order
+	srcValidMark []byte     // original sysctl value, nil if untouched
+}
+
+func newAppSplitManager() AppSplitManager {
+	return &linuxAppSplit{}
+}
+
+// CgroupDir returns the cgroup v2 directory for processes in the given mode.
+func (a *linuxAppSplit) CgroupDir(mode AppMode) string {
+	return filepath.Join(appCgroupRoot, appCgroupParent, string(mode))
+}
+
+func (a *linuxAppSplit) Enable(iface string) error {
+	if a.enabled {
+		return nil
+	}
+	if !validIfaceName.MatchString(iface) {
+		return fmt.Errorf("invalid interface name: %q", iface)
+	}
+	if _, err := os.Stat(filepath.Join(appCgroupRoot, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s: %w", appCgroupRoot, err)
+	}
+	a.iface = iface
+
+	for _, mode := range []AppMode{AppBypass, AppOnlyVPN} {
+		if err := os.MkdirAll(a.CgroupDir(mode), 0755); err != nil {
+			return fmt.Errorf("failed to create cgroup: %w", err)
+		}
+	}
+
+	if err := a.setup(); err != nil {
+		a.teardown()
+		return err
+	}
+	a.enabled = true
+	return nil
+}
+
+func (a *linuxAppSplit) Disable() error {
+	if !a.enabled {
+		return nil
+	}
+	a.enabled = false
+	return a.teardown()
+}
+
+func (a *linuxAppSplit) setup() error {
+	// Mark packets by the cgroup of the sending socket, then masquerade so the
+	// source address matches the interface chosen after re-routing.
+	if err := runNft(a.nftRuleset()); err != nil {
+		return fmt.Errorf("failed to install nftables rules: %w", err)
+	}
+	a.undo = append(a.undo, []string{"nft", "delete", "table", "inet", appNftTable})
+
+	// Let reverse-path filtering take the fwmark into account
+	if orig, err := os.ReadFile(srcValidMarkPath); err == nil && strings.TrimSpace(string(orig)) != "1" {
+		if err := os.WriteFile(srcValidMarkPath, []byte("1"), 0644); err == nil {
+			a.srcValidMark = orig
+		}
+	}
+
+	// Bypass: a table of its own with the physical default route and the
+	// on-link routes of the other interfaces, for both families. Main can't
+	// be used, as the tunnel's routes there are as specific as the traffic
+	// they catch (exclude_ips complements, /32 domain routes).
+	bypassTable := strconv.Itoa(appBypassMark)
+	for _, family := range [][]string{nil, {"-6"}} {
+		if err := a.addBypassRoutes(family, bypassTable); err != nil {
+			return err
+		}
+	}
+
+	// Only-VPN: the tunnel is the only way out. The unreachable fallback keeps
+	// traffic from leaking if the interface disappears.
+	vpnTable := strconv.Itoa(appOnlyVPNMark)
+	for _, family := range [][]string{nil, {"-6"}} {
+		routeArgs := append(append([]string{"ip"}, family...), "route", "replace", "default", "dev", a.iface, "table", vpnTable)
+		flushArgs := append(append([]string{"ip"}, family...), "route", "flush", "table", vpnTable)
+		if err := a.apply(routeArgs, flushArgs); err != nil {
+			if family != nil {
+				slog.Debug("IPv6 only-vpn route unavailable", "error", err)
+				continue
+			}
+			return err
+		}
+		unreachable := append(append([]string{"ip"}, family...), "route", "replace", "unreachable", "default", "metric", "4096", "table", vpnTable)
+		if err := a.apply(unreachable, nil); err != nil {
+			return err
+		}
+		if err := a.addRule(family, appOnlyVPNMark, vpnTable, appOnlyVPNMark); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("per-application split tunneling enabled", "interface", a.iface)
+	return nil
+}
+
+func (a *linuxAppSplit) teardown() error {
+	var lastErr error
+	for i := len(a.undo) - 1; i >= 0; i-- {
+		args := a.undo[i]
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			lastErr = fmt.Errorf("%s: %s: %w", strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+		}
+	}
+	a.undo = nil
+
+	if a.srcValidMark != nil {
+		if err := os.WriteFile(srcValidMarkPath, a.srcValidMark, 0644); err != nil {
+			lastErr = err
+		}
+		a.srcValidMark = nil
+	}
+
+	// Processes that outlive the tunnel go back to the root cgroup so the
+	// directories can be removed.
+	for _, mode := range []AppMode{AppBypass, AppOnlyVPN} {
+		dir := a.CgroupDir(mode)
+		if n := migrateCgroupProcs(dir, appCgroupRoot); n > 0 {
+			slog.Warn("applications still running after disconnect now use normal routing", "mode", mode, "count", n)
+		}
+		os.Remove(dir)
+	}
+	os.Remove(filepath.Join(appCgroupRoot, appCgroupParent))
+	return lastErr
+}
+
+// addBypassRoutes fills the bypass table for family (nil for IPv4, or
+// {"-6"}) from the main table, and adds the rule that selects it.
+func (a *linuxAppSplit) addBypassRoutes(family []string, table string) error {
+	nlFamily := netlink.FAMILY_V4
+	if family != nil {
+		nlFamily = netlink.FAMILY_V6
+	}
+	routes, err := netlink.RouteList(nil, nlFamily)
+	if err != nil {
+		return fmt.Errorf("failed to list routes: %w", err)
+	}
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	names := make(map[int]string, len(links))
+	for _, link := range links {
+		names[link.Attrs().Index] = link.Attrs().Name
+	}
+	defaultRoute, linkRoutes := bypassRoutes(routes, names, a.iface)
+	if defaultRoute == nil && family == nil {
+		return fmt.Errorf("no IPv4 default route; bypass mode is unavailable")
+	}
+
+	ip := func(args ...string) []string {
+		return append(append([]string{"ip"}, family...), args...)
+	}
+	// The unreachable fallback keeps bypassed traffic from taking the
+	// tunnel's routes in main when there is no default route, as is common
+	// for IPv6.
+	unreachable := ip("route", "replace", "unreachable", "default", "metric", "4096", "table", table)
+	if err := a.apply(unreachable, ip("route", "flush", "table", table)); err != nil {
+		if family != nil {
+			slog.Debug("IPv6 bypass route unavailable", "error", err)
+			return nil
+		}
+		return err
+	}
+	if defaultRoute != nil {
+		if err := a.apply(ip(append(append([]string{"route", "replace"}, defaultRoute...), "table", table)...), nil); err != nil {
+			return err
+		}
+	}
+	for _, route := range linkRoutes {
+		if err := a.apply(ip(append(append([]string{"route", "replace"}, route...), "table", table)...), nil); err != nil {
+			slog.Debug("skipping on-link route for bypass", "route", route, "error", err)
+		}
+	}
+	return a.addRule(family, appBypassMark, table, appBypassMark)
+}
+
+// bypassRoutes picks, from the main table routes of one family, the default
+// route with the lowest metric and the on-link routes, leaving out those on
+// the tunnel interface. They are returned as `ip route replace` arguments
+// without the table; defaultRoute is nil if there is no default route.
+func bypassRoutes(routes []netlink.Route, links map[int]string, iface string) (defaultRoute []string, linkRoutes [][]string) {
+	bestMetric := -1
+	for _, rt := range routes {
+		if rt.Type != 0 && rt.Type != syscall.RTN_UNICAST {
+			continue
+		}
+		gw, index := rt.Gw, rt.LinkIndex
+		if gw == nil && len(rt.MultiPath) > 0 {
+			gw, index = rt.MultiPath[0].Gw, rt.MultiPath[0].LinkIndex
+		}
+		dev := links[index]
+		if dev == "" || dev == iface {
+			continue
+		}
+
+		if rt.Dst == nil || isDefaultDst(rt.Dst) {
+			if bestMetric >= 0 && rt.Priority >= bestMetric {
+				continue
+			}
+			bestMetric = rt.Priority
+			defaultRoute = []string{"default", "dev", dev}
+			if gw != nil {
+				defaultRoute = []string{"default", "via", gw.String(), "dev", dev}
+			}
+			continue
+		}
+		if gw != nil {
+			continue
+		}
+		route := []string{rt.Dst.String(), "dev", dev}
+		if rt.Src != nil {
+			route = append(route, "src", rt.Src.String())
+		}
+		linkRoutes = append(linkRoutes, route)
+	}
+	return defaultRoute, linkRoutes
+}
+
+func isDefaultDst(dst *net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+// apply runs an iproute2 command and records its undo command on success.
+func (a *linuxAppSplit) apply(args, undo []string) error {
+	if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s: %w", strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+	}
+	if undo != nil {
+		a.undo = append(a.undo, undo)
+	}
+	return nil
+}
+
+func (a *linuxAppSplit) addRule(family []string, mark int, table string, priority int, extra ...string) error {
+	rule := []string{"fwmark", fmt.Sprintf("0x%x", mark), "lookup", table}
+	rule = append(rule, extra...)
+	rule = append(rule, "priority", strconv.Itoa(priority))
+	add := append(append(append([]string{"ip"}, family...), "rule", "add"), rule...)
+	del := append(append(append([]string{"ip"}, family...), "rule", "del"), rule...)
+	return a.apply(add, del)
+}
+
+func (a *linuxAppSplit) nftRuleset() string {
+	var sb strings.Builder
+	// Declaring then deleting the table makes the load idempotent
+	sb.WriteString(fmt.Sprintf("table inet %s {}\n", appNftTable))
+	sb.WriteString(fmt.Sprintf("delete table inet %s\n", appNftTable))
+	sb.WriteString(fmt.Sprintf("table inet %s {\n", appNftTable))
+	sb.WriteString("\tchain output {\n")
+	sb.WriteString("\t\ttype route hook output priority mangle; policy accept;\n")
+	sb.WriteString(fmt.Sprintf("\t\tsocket cgroupv2 level 2 \"%s/%s\" meta mark set 0x%x\n", appCgroupParent, AppBypass, appBypassMark))
+	sb.WriteString(fmt.Sprintf("\t\tsocket cgroupv2 level 2 \"%s/%s\" meta mark set 0x%x\n", appCgroupParent, AppOnlyVPN, appOnlyVPNMark))
+	sb.WriteString("\t}\n")
+	sb.WriteString("\tchain postrouting {\n")
+	sb.WriteString("\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+	sb.WriteString(fmt.Sprintf("\t\tmeta mark 0x%x oifname != \"%s\" masquerade\n", appBypassMark, a.iface))
+	sb.WriteString(fmt.Sprintf("\t\tmeta mark 0x%x oifname \"%s\" masquerade\n", appOnlyVPNMark, a.iface))
+	sb.WriteString("\t}\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func runNft(ruleset string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(ruleset)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// migrateCgroupProcs moves every process in from into to and returns how
+// many were moved.
+func migrateCgroupProcs(from, to string) int {
+	data, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return 0
+	}
+	moved := 0
+	for _, pid := range bytes.Fields(data) {
+		if err := os.WriteFile(filepath.Join(to, "cgroup.procs"), pid, 0644); err == nil {
+			moved++
+		}
+	}
+	return moved
+}
+
+// PrepareAppCommand makes cmd start directly inside cgroupDir, so the new
+// process never sends a packet with the wrong routing mark. It returns a
+// function that releases the cgroup handle once the process has started.
+func PrepareAppCommand(cmd *exec.Cmd, cgroupDir string) (func(), error) {
+	parent := filepath.Join(appCgroupRoot, appCgroupParent) + string(filepath.Separator)
+	if !strings.HasPrefix(filepath.Clean(cgroupDir), parent) {
+		return nil, fmt.Errorf("invalid application cgroup %q", cgroupDir)
+	}
+	fd, err := syscall.Open(cgroupDir, syscall.O_DIRECTORY|syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", cgroupDir, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return func() { syscall.Close(fd) }, nil
+}
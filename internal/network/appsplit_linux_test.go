@@ -0,0 +1,104 @@
+//go:build linux
+
+package network
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestAppSplitCgroupDir(t *testing.T) {
+	a := &linuxAppSplit{}
+	if got := a.CgroupDir(AppBypass); got != "/sys/fs/cgroup/voidvpn/bypass" {
+		t.Errorf("CgroupDir(bypass) = %q", got)
+	}
+	if got := a.CgroupDir(AppOnlyVPN); got != "/sys/fs/cgroup/voidvpn/vpn" {
+		t.Errorf("CgroupDir(vpn) = %q", got)
+	}
+}
+
+func TestAppSplitNftRuleset(t *testing.T) {
+	a := &linuxAppSplit{iface: "voidvpn0"}
+	rules := a.nftRuleset()
+	for _, want := range []string{
+		`socket cgroupv2 level 2 "voidvpn/bypass" meta mark set 0x7601`,
+		`socket cgroupv2 level 2 "voidvpn/vpn" meta mark set 0x7602`,
+		`meta mark 0x7601 oifname != "voidvpn0" masquerade`,
+		`meta mark 0x7602 oifname "voidvpn0" masquerade`,
+		"type route hook output priority mangle",
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("ruleset missing %q:\n%s", want, rules)
+		}
+	}
+}
+
+func TestBypassRoutes(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, n, _ := net.ParseCIDR(s)
+		return n
+	}
+	links := map[int]string{1: "lo", 2: "eth0", 3: "docker0", 4: "voidvpn0", 5: "wlan0"}
+	routes := []netlink.Route{
+		{Gw: net.ParseIP("192.168.1.1"), LinkIndex: 5, Priority: 600},
+		{Gw: net.ParseIP("192.168.1.1"), LinkIndex: 2, Priority: 100},
+		{Dst: cidr("0.0.0.0/1"), LinkIndex: 4},
+		{Dst: cidr("10.0.0.0/8"), LinkIndex: 4},
+		{Dst: cidr("172.17.0.0/16"), LinkIndex: 3, Src: net.ParseIP("172.17.0.1")},
+		{Dst: cidr("192.168.1.0/24"), LinkIndex: 2, Src: net.ParseIP("192.168.1.5")},
+		{Dst: cidr("10.9.0.0/16"), Gw: net.ParseIP("192.168.1.254"), LinkIndex: 2},
+		{Dst: cidr("198.51.100.0/24"), LinkIndex: 2, Type: syscall.RTN_BLACKHOLE},
+	}
+	def, onLink := bypassRoutes(routes, links, "voidvpn0")
+	if got, want := strings.Join(def, " "), "default via 192.168.1.1 dev eth0"; got != want {
+		t.Errorf("default route = %q, want %q", got, want)
+	}
+	want := []string{
+		"172.17.0.0/16 dev docker0 src 172.17.0.1",
+		"192.168.1.0/24 dev eth0 src 192.168.1.5",
+	}
+	if len(onLink) != len(want) {
+		t.Fatalf("on-link routes = %q, want %q", onLink, want)
+	}
+	for i := range want {
+		if strings.Join(onLink[i], " ") != want[i] {
+			t.Errorf("route %d = %q, want %q", i, strings.Join(onLink[i], " "), want[i])
+		}
+	}
+
+	// IPv6 through the tunnel only: no default route for bypassed traffic
+	def, onLink = bypassRoutes([]netlink.Route{
+		{Dst: cidr("::/1"), LinkIndex: 4},
+		{Dst: cidr("8000::/1"), LinkIndex: 4},
+		{Dst: cidr("fe80::/64"), LinkIndex: 2},
+	}, links, "voidvpn0")
+	if def != nil {
+		t.Errorf("default route = %q, want none", def)
+	}
+	if len(onLink) != 1 || strings.Join(onLink[0], " ") != "fe80::/64 dev eth0" {
+		t.Errorf("on-link routes = %q, want fe80::/64 on eth0", onLink)
+	}
+}
+
+func TestAppSplitEnableInvalidIface(t *testing.T) {
+	a := &linuxAppSplit{}
+	if err := a.Enable("bad;iface"); err == nil {
+		t.Error("Enable should reject invalid interface names")
+	}
+	if err := a.Disable(); err != nil {
+		t.Errorf("Disable when not enabled should be a no-op, got %v", err)
+	}
+}
+
+func TestPrepareAppCommandRejectsForeignCgroup(t *testing.T) {
+	for _, dir := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/voidvpn/../system.slice", "/tmp"} {
+		if _, err := PrepareAppCommand(exec.Command("true"), dir); err == nil {
+			t.Errorf("PrepareAppCommand(%q) should fail", dir)
+		}
+	}
+}
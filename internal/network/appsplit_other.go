@@ -0,0 +1,27 @@
+//go:build !linux
+
+package network
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errAppSplitUnsupported = errors.New("per-application split tunneling is only supported on Linux")
+
+type unsupportedAppSplit struct{}
+
+func newAppSplitManager() AppSplitManager {
+	return unsupportedAppSplit{}
+}
+
+func (unsupportedAppSplit) Enable(iface string) error { return errAppSplitUnsupported }
+
+func (unsupportedAppSplit) Disable() error { return nil }
+
+func (unsupportedAppSplit) CgroupDir(mode AppMode) string { return "" }
+
+// PrepareAppCommand is only supported on Linux.
+func PrepareAppCommand(cmd *exec.Cmd, cgroupDir string) (func(), error) {
+	return nil, errAppSplitUnsupported
+}
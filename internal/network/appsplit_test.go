@@ -0,0 +1,25 @@
+package network
+
+import "testing"
+
+func TestParseAppMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    AppMode
+		wantErr bool
+	}{
+		{"bypass", AppBypass, false},
+		{"vpn", AppOnlyVPN, false},
+		{"", "", true},
+		{"only-vpn", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAppMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAppMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseAppMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
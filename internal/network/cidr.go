@@ -0,0 +1,151 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ParsePrefixes parses a list of CIDR strings. Bare addresses are treated as
+// host routes (/32 for IPv4, /128 for IPv6).
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			addr, err2 := netip.ParseAddr(c)
+			if err2 != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", c, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ComputeAllowedIPs returns the allowed set with every excluded range removed.
+// IPv4 and IPv6 are handled independently; the result is sorted and free of
+// overlapping entries.
+func ComputeAllowedIPs(allowed, exclude []string) ([]netip.Prefix, error) {
+	include, err := ParsePrefixes(allowed)
+	if err != nil {
+		return nil, fmt.Errorf("allowed IPs: %w", err)
+	}
+	excl, err := ParsePrefixes(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("excluded IPs: %w", err)
+	}
+	return SubtractPrefixes(include, excl), nil
+}
+
+// SubtractPrefixes removes every range in exclude from include.
+func SubtractPrefixes(include, exclude []netip.Prefix) []netip.Prefix {
+	result := normalizePrefixes(include)
+	for _, e := range exclude {
+		e = e.Masked()
+		var next []netip.Prefix
+		for _, p := range result {
+			next = append(next, subtractPrefix(p, e)...)
+		}
+		result = next
+	}
+	return normalizePrefixes(result)
+}
+
+// SplitDefaultRoutes replaces 0.0.0.0/0 and ::/0 with their two /1 halves so
+// the tunnel routes take precedence without replacing the system default route.
+func SplitDefaultRoutes(prefixes []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range prefixes {
+		if p.Bits() == 0 {
+			lo, hi := splitPrefix(p)
+			out = append(out, lo, hi)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// HasIPv6 reports whether any prefix in the set is an IPv6 range.
+func HasIPv6(prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Addr().Is6() {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixStrings converts prefixes back to their CIDR notation.
+func PrefixStrings(prefixes []netip.Prefix) []string {
+	out := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+// subtractPrefix returns p minus e as a list of disjoint prefixes.
+func subtractPrefix(p, e netip.Prefix) []netip.Prefix {
+	if p.Addr().Is4() != e.Addr().Is4() || !p.Overlaps(e) {
+		return []netip.Prefix{p}
+	}
+	if e.Bits() <= p.Bits() {
+		// e covers all of p
+		return nil
+	}
+	lo, hi := splitPrefix(p)
+	var out []netip.Prefix
+	out = append(out, subtractPrefix(lo, e)...)
+	out = append(out, subtractPrefix(hi, e)...)
+	return out
+}
+
+// splitPrefix divides p into its two halves one bit longer.
+func splitPrefix(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	lo := netip.PrefixFrom(p.Addr(), bits).Masked()
+
+	b := lo.Addr().AsSlice()
+	idx := p.Bits() / 8
+	b[idx] |= 0x80 >> (p.Bits() % 8)
+	hiAddr, _ := netip.AddrFromSlice(b)
+	hi := netip.PrefixFrom(hiAddr, bits)
+	return lo, hi
+}
+
+// normalizePrefixes sorts prefixes (IPv4 first), drops duplicates and any
+// prefix already covered by a shorter one in the set.
+func normalizePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Addr().Is4() != b.Addr().Is4() {
+			return a.Addr().Is4()
+		}
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+
+	var out []netip.Prefix
+	for _, p := range sorted {
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if last.Addr().Is4() == p.Addr().Is4() && last.Bits() <= p.Bits() && last.Contains(p.Addr()) {
+				continue
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package network
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes([]string{"10.0.0.1/8", "1.2.3.4", " fd00::1 ", ""})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() error: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "1.2.3.4/32", "fd00::1/128"}
+	if strings.Join(PrefixStrings(got), ",") != strings.Join(want, ",") {
+		t.Errorf("ParsePrefixes() = %v, want %v", got, want)
+	}
+}
+
+func TestParsePrefixesInvalid(t *testing.T) {
+	_, err := ParsePrefixes([]string{"not-a-cidr"})
+	if err == nil {
+		t.Error("ParsePrefixes should error for invalid input")
+	}
+}
+
+func TestComputeAllowedIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name:    "no exclusions",
+			allowed: []string{"0.0.0.0/0", "::/0"},
+			want:    []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name:    "exclude half",
+			allowed: []string{"0.0.0.0/0"},
+			exclude: []string{"128.0.0.0/1"},
+			want:    []string{"0.0.0.0/1"},
+		},
+		{
+			name:    "exclude lan",
+			allowed: []string{"192.168.0.0/16"},
+			exclude: []string{"192.168.0.0/18"},
+			want:    []string{"192.168.64.0/18", "192.168.128.0/17"},
+		},
+		{
+			name:    "exclude covers everything",
+			allowed: []string{"10.1.0.0/16"},
+			exclude: []string{"10.0.0.0/8"},
+			want:    []string{},
+		},
+		{
+			name:    "exclusion outside allowed set",
+			allowed: []string{"10.0.0.0/8"},
+			exclude: []string{"192.168.49.0/24"},
+			want:    []string{"10.0.0.0/8"},
+		},
+		{
+			name:    "ipv6 exclusion leaves ipv4 alone",
+			allowed: []string{"10.0.0.0/8", "fd00::/8"},
+			exclude: []string{"fd00::/9"},
+			want:    []string{"10.0.0.0/8", "fd80::/9"},
+		},
+		{
+			name:    "overlapping allowed entries collapse",
+			allowed: []string{"10.0.0.0/8", "10.1.0.0/16", "10.0.0.0/8"},
+			want:    []string{"10.0.0.0/8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeAllowedIPs(tt.allowed, tt.exclude)
+			if err != nil {
+				t.Fatalf("ComputeAllowedIPs() error: %v", err)
+			}
+			if strings.Join(PrefixStrings(got), ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ComputeAllowedIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeAllowedIPsExcludesHost(t *testing.T) {
+	got, err := ComputeAllowedIPs([]string{"0.0.0.0/0"}, []string{"192.168.49.7"})
+	if err != nil {
+		t.Fatalf("ComputeAllowedIPs() error: %v", err)
+	}
+	if len(got) != 32 {
+		t.Fatalf("len = %d, want 32 prefixes for a /0 minus a /32", len(got))
+	}
+	host := netip.MustParseAddr("192.168.49.7")
+	neighbour := netip.MustParseAddr("192.168.49.6")
+	covered := false
+	for _, p := range got {
+		if p.Contains(host) {
+			t.Errorf("%s should not contain excluded host", p)
+		}
+		if p.Contains(neighbour) {
+			covered = true
+		}
+	}
+	if !covered {
+		t.Error("neighbouring address should still be routed through the tunnel")
+	}
+}
+
+func TestComputeAllowedIPsInvalidExclude(t *testing.T) {
+	_, err := ComputeAllowedIPs([]string{"0.0.0.0/0"}, []string{"bogus"})
+	if err == nil {
+		t.Fatal("ComputeAllowedIPs should error for invalid exclusion")
+	}
+	if !strings.Contains(err.Error(), "excluded IPs") {
+		t.Errorf("error = %q, want mention of excluded IPs", err.Error())
+	}
+}
+
+func TestSplitDefaultRoutes(t *testing.T) {
+	in := []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/0"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::/0"),
+	}
+	got := PrefixStrings(SplitDefaultRoutes(in))
+	want := []string{"0.0.0.0/1", "128.0.0.0/1", "10.0.0.0/8", "::/1", "8000::/1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("SplitDefaultRoutes() = %v, want %v", got, want)
+	}
+}
+
+func TestHasIPv6(t *testing.T) {
+	v4 := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	if HasIPv6(v4) {
+		t.Error("HasIPv6 should be false for IPv4-only set")
+	}
+	if !HasIPv6(append(v4, netip.MustParsePrefix("::/1"))) {
+		t.Error("HasIPv6 should be true when an IPv6 prefix is present")
+	}
+}
@@ -7,6 +7,12 @@ type DNSManager interface {
 	Restore() error
 }
 
+// SearchDomainSetter is implemented by DNS managers that can also set the
+// resolver's search domains.
+type SearchDomainSetter interface {
+	SetWithSearch(iface string, servers, domains []string) error
+}
+
 // NewDNSManager returns a platform-appropriate DNS manager.
 func NewDNSManager() DNSManager {
 	return newDNSManager()
@@ -17,7 +17,12 @@ func newDNSManager() DNSManager {
 	return &unixDNS{}
 }
 
-func (d *unixDNS) Set(_ string, servers []string) error {
+func (d *unixDNS) Set(iface string, servers []string) error {
+	return d.SetWithSearch(iface, servers, nil)
+}
+
+// SetWithSearch writes servers and a search line for domains.
+func (d *unixDNS) SetWithSearch(_ string, servers, domains []string) error {
 	if len(servers) == 0 {
 		return nil
 	}
@@ -38,6 +43,14 @@ func (d *unixDNS) Set(_ string, servers []string) error {
 	// Write new resolv.conf
 	var sb strings.Builder
 	sb.WriteString("# Generated by VoidVPN\n")
+	if len(domains) > 0 {
+		for _, domain := range domains {
+			if strings.ContainsAny(domain, " \t\r\n") {
+				return fmt.Errorf("invalid DNS search domain: %q", domain)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("search %s\n", strings.Join(domains, " ")))
+	}
 	for _, server := range servers {
 		sb.WriteString(fmt.Sprintf("nameserver %s\n", server))
 	}
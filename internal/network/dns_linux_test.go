@@ -33,3 +33,14 @@ func TestUnixDNSRestoreNilOriginal(t *testing.T) {
 		t.Errorf("Restore() with nil origResolvConf should return nil, got %v", err)
 	}
 }
+
+func TestUnixDNSSetWithSearchInvalidDomain(t *testing.T) {
+	d := &unixDNS{}
+	err := d.SetWithSearch("", []string{"10.8.0.1"}, []string{"corp example"})
+	if err == nil {
+		t.Fatal("SetWithSearch() should error for a domain containing spaces")
+	}
+	if !strings.Contains(err.Error(), "search domain") {
+		t.Errorf("error = %q, want mention of the search domain", err.Error())
+	}
+}
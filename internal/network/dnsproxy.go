@@ -0,0 +1,360 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSProxyAddr is where the split-tunnel DNS proxy listens.
+const DefaultDNSProxyAddr = "127.0.0.1:53"
+
+const dnsExchangeTimeout = 3 * time.Second
+
+// AnswerFunc receives the question name, the A/AAAA addresses and the lowest
+// TTL of every answer relayed by the proxy.
+type AnswerFunc func(name string, addrs []netip.Addr, ttl time.Duration)
+
+// dnsTCPIdleTimeout closes TCP clients that send no further query.
+const dnsTCPIdleTimeout = 10 * time.Second
+
+// DNSProxy is a DNS forwarder that reports answers before relaying them,
+// so routes for a name exist by the time the client sees its addresses.
+// Queries arriving over UDP are forwarded over UDP, and those over TCP
+// (typically retries of truncated answers) over TCP.
+type DNSProxy struct {
+	conn     net.PacketConn
+	listener net.Listener
+	upstream []string
+	onAnswer AnswerFunc
+}
+
+// NewDNSProxy listens on addr and forwards queries to the upstream servers.
+func NewDNSProxy(addr string, upstream []string, onAnswer AnswerFunc) (*DNSProxy, error) {
+	if len(upstream) == 0 {
+		return nil, fmt.Errorf("DNS proxy needs at least one upstream server")
+	}
+	for _, server := range upstream {
+		if _, err := netip.ParseAddrPort(dnsServerAddr(server)); err != nil {
+			return nil, fmt.Errorf("invalid DNS server address: %q", server)
+		}
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start DNS proxy: %w", err)
+	}
+	// Same port over TCP, also when addr asked for any free one
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start DNS proxy: %w", err)
+	}
+	return &DNSProxy{conn: conn, listener: listener, upstream: upstream, onAnswer: onAnswer}, nil
+}
+
+// Addr returns the address the proxy is listening on.
+func (p *DNSProxy) Addr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+// Serve relays queries until the proxy is closed.
+func (p *DNSProxy) Serve() {
+	go p.serveTCP()
+
+	buf := make([]byte, 65535)
+	for {
+		n, client, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go p.handle(query, client)
+	}
+}
+
+// Close stops the proxy.
+func (p *DNSProxy) Close() error {
+	p.listener.Close()
+	return p.conn.Close()
+}
+
+func (p *DNSProxy) handle(query []byte, client net.Addr) {
+	if resp, ok := p.exchange("udp", query); ok {
+		p.conn.WriteTo(resp, client)
+	}
+}
+
+// serveTCP relays length-prefixed queries from TCP clients until the proxy
+// is closed.
+func (p *DNSProxy) serveTCP() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handleTCP(conn)
+	}
+}
+
+// handleTCP answers the queries of one TCP client in order.
+func (p *DNSProxy) handleTCP(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(dnsTCPIdleTimeout))
+		query, err := readDNSTCP(conn)
+		if err != nil {
+			return
+		}
+		resp, ok := p.exchange("tcp", query)
+		if !ok {
+			return
+		}
+		if err := writeDNSTCP(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// exchange forwards query upstream over network and reports the answer
+// before it is relayed.
+func (p *DNSProxy) exchange(network string, query []byte) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsExchangeTimeout)
+	defer cancel()
+
+	resp, err := exchangeDNS(ctx, network, p.upstream, query)
+	if err != nil {
+		slog.Debug("DNS proxy upstream failed", "network", network, "error", err)
+		return nil, false
+	}
+	if p.onAnswer != nil {
+		if name, addrs, ttl, err := ParseDNSAnswer(resp); err == nil && len(addrs) > 0 {
+			p.onAnswer(name, addrs, ttl)
+		}
+	}
+	return resp, true
+}
+
+// ExchangeDNS sends a raw DNS query to each server in turn over UDP and
+// returns the first response whose ID matches.
+func ExchangeDNS(ctx context.Context, servers []string, query []byte) ([]byte, error) {
+	return exchangeDNS(ctx, "udp", servers, query)
+}
+
+// exchangeDNS is ExchangeDNS over network, "udp" or "tcp".
+func exchangeDNS(ctx context.Context, network string, servers []string, query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, fmt.Errorf("DNS query too short")
+	}
+	var lastErr error
+	for _, server := range servers {
+		resp, err := exchangeOne(ctx, network, dnsServerAddr(server), query)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all DNS servers failed: %w", lastErr)
+}
+
+// dnsServerAddr appends the default port to a bare server IP.
+func dnsServerAddr(server string) string {
+	if net.ParseIP(server) != nil {
+		return net.JoinHostPort(server, "53")
+	}
+	return server
+}
+
+func exchangeOne(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(dnsExchangeTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		if err := writeDNSTCP(conn, query); err != nil {
+			return nil, err
+		}
+		resp, err := readDNSTCP(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) < 2 || resp[0] != query[0] || resp[1] != query[1] {
+			return nil, fmt.Errorf("DNS response ID does not match the query")
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray packets that don't answer our query
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return append([]byte(nil), buf[:n]...), nil
+		}
+	}
+}
+
+// readDNSTCP reads one DNS message with its two-byte length prefix.
+func readDNSTCP(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeDNSTCP writes msg with its two-byte length prefix.
+func writeDNSTCP(w io.Writer, msg []byte) error {
+	if len(msg) > 0xffff {
+		return fmt.Errorf("DNS message too long")
+	}
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+// ParseDNSAnswer extracts the question name, all A/AAAA records and the
+// lowest TTL from a DNS response. CNAME chains are followed implicitly since
+// every address in the answer section belongs to the original question.
+func ParseDNSAnswer(resp []byte) (string, []netip.Addr, time.Duration, error) {
+	var parser dnsmessage.Parser
+	hdr, err := parser.Start(resp)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if !hdr.Response || hdr.RCode != dnsmessage.RCodeSuccess {
+		return "", nil, 0, fmt.Errorf("DNS response code %v", hdr.RCode)
+	}
+	q, err := parser.Question()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return "", nil, 0, err
+	}
+
+	var addrs []netip.Addr
+	var ttl uint32
+	for {
+		h, err := parser.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return "", nil, 0, err
+		}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			r, err := parser.AResource()
+			if err != nil {
+				return "", nil, 0, err
+			}
+			addrs = append(addrs, netip.AddrFrom4(r.A))
+		case dnsmessage.TypeAAAA:
+			r, err := parser.AAAAResource()
+			if err != nil {
+				return "", nil, 0, err
+			}
+			addrs = append(addrs, netip.AddrFrom16(r.AAAA))
+		default:
+			if err := parser.SkipAnswer(); err != nil {
+				return "", nil, 0, err
+			}
+			continue
+		}
+		if ttl == 0 || h.TTL < ttl {
+			ttl = h.TTL
+		}
+	}
+	return canonicalDomain(q.Name.String()), addrs, time.Duration(ttl) * time.Second, nil
+}
+
+// NewDNSResolver returns a ResolveFunc that queries servers directly for A
+// and AAAA records, so answer TTLs are available.
+func NewDNSResolver(servers []string) ResolveFunc {
+	return func(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+		var all []netip.Addr
+		var minTTL time.Duration
+		var lastErr error
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			query, err := buildDNSQuery(name, qtype)
+			if err != nil {
+				return nil, 0, err
+			}
+			resp, err := ExchangeDNS(ctx, servers, query)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			_, addrs, ttl, err := ParseDNSAnswer(resp)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if len(addrs) > 0 && (minTTL == 0 || ttl < minTTL) {
+				minTTL = ttl
+			}
+			all = append(all, addrs...)
+		}
+		if len(all) == 0 {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("no addresses for %s", name)
+			}
+			return nil, 0, lastErr
+		}
+		return all, minTTL, nil
+	}
+}
+
+// SystemResolver resolves through the OS resolver. TTLs are not exposed
+// there, so answers are treated as living for the minimum domain TTL.
+func SystemResolver(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return addrs, minDomainTTL, nil
+}
+
+func buildDNSQuery(name string, qtype dnsmessage.Type) ([]byte, error) {
+	fqdn, err := dnsmessage.NewName(canonicalDomain(name) + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain %q: %w", name, err)
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  fqdn,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
@@ -0,0 +1,222 @@
+package network
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSReply answers an A query with addr and an AAAA query with no
+// records, using the given TTL. It returns nil for anything else.
+func fakeDNSReply(query []byte, addr netip.Addr, ttl uint32) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(query); err != nil || len(req.Questions) == 0 {
+		return nil
+	}
+	q := req.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: req.ID, Response: true, RecursionAvailable: true},
+		Questions: req.Questions,
+	}
+	if q.Type == dnsmessage.TypeA {
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: addr.As4()},
+		}}
+	}
+	out, _ := resp.Pack()
+	return out
+}
+
+// startFakeDNS answers every A query with addr and every AAAA query with no
+// records, using the given TTL.
+func startFakeDNS(t *testing.T, addr netip.Addr, ttl uint32) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if out := fakeDNSReply(buf[:n], addr, ttl); out != nil {
+				conn.WriteTo(out, client)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestParseDNSAnswer(t *testing.T) {
+	name := dnsmessage.MustNewName("git.corp.example.")
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1, Response: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+		Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 10},
+				Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("lb.corp.example.")},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("lb.corp.example."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.AResource{A: [4]byte{203, 0, 113, 10}},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("lb.corp.example."), Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: 120},
+				Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::10").As16()},
+			},
+		},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack error: %v", err)
+	}
+
+	gotName, addrs, ttl, err := ParseDNSAnswer(packed)
+	if err != nil {
+		t.Fatalf("ParseDNSAnswer() error: %v", err)
+	}
+	if gotName != "git.corp.example" {
+		t.Errorf("name = %q, want %q", gotName, "git.corp.example")
+	}
+	if len(addrs) != 2 || addrs[0] != netip.MustParseAddr("203.0.113.10") || addrs[1] != netip.MustParseAddr("2001:db8::10") {
+		t.Errorf("addrs = %v, want [203.0.113.10 2001:db8::10]", addrs)
+	}
+	if ttl != 120*time.Second {
+		t.Errorf("ttl = %v, want 2m0s (lowest address TTL)", ttl)
+	}
+}
+
+func TestParseDNSAnswerNXDomain(t *testing.T) {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeNameError},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("nope.example."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	packed, _ := msg.Pack()
+	if _, _, _, err := ParseDNSAnswer(packed); err == nil {
+		t.Error("ParseDNSAnswer should error on NXDOMAIN")
+	}
+}
+
+func TestNewDNSProxyRequiresUpstream(t *testing.T) {
+	if _, err := NewDNSProxy("127.0.0.1:0", nil, nil); err == nil {
+		t.Error("NewDNSProxy should error without upstream servers")
+	}
+	if _, err := NewDNSProxy("127.0.0.1:0", []string{"bogus"}, nil); err == nil {
+		t.Error("NewDNSProxy should error for invalid upstream")
+	}
+}
+
+func TestDNSProxyObservesBeforeReply(t *testing.T) {
+	upstream := startFakeDNS(t, netip.MustParseAddr("203.0.113.10"), 60)
+
+	observed := make(chan string, 1)
+	proxy, err := NewDNSProxy("127.0.0.1:0", []string{upstream}, func(name string, addrs []netip.Addr, ttl time.Duration) {
+		if len(addrs) == 1 && ttl == time.Minute {
+			observed <- name
+		}
+	})
+	if err != nil {
+		t.Fatalf("NewDNSProxy() error: %v", err)
+	}
+	defer proxy.Close()
+	go proxy.Serve()
+
+	addrs, ttl, err := NewDNSResolver([]string{proxy.Addr().String()})(context.Background(), "git.corp.example")
+	if err != nil {
+		t.Fatalf("resolve via proxy error: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != netip.MustParseAddr("203.0.113.10") {
+		t.Errorf("addrs = %v, want [203.0.113.10]", addrs)
+	}
+	if ttl != time.Minute {
+		t.Errorf("ttl = %v, want 1m0s", ttl)
+	}
+
+	// The answer callback must have run before the reply was relayed
+	select {
+	case name := <-observed:
+		if name != "git.corp.example" {
+			t.Errorf("observed name = %q, want git.corp.example", name)
+		}
+	default:
+		t.Error("answer was relayed before the proxy reported it")
+	}
+}
+
+// startFakeDNSTCP is startFakeDNS over TCP.
+func startFakeDNSTCP(t *testing.T, addr netip.Addr, ttl uint32) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					query, err := readDNSTCP(conn)
+					if err != nil {
+						return
+					}
+					writeDNSTCP(conn, fakeDNSReply(query, addr, ttl))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDNSProxyTCP(t *testing.T) {
+	upstream := startFakeDNSTCP(t, netip.MustParseAddr("203.0.113.20"), 60)
+
+	observed := make(chan string, 1)
+	proxy, err := NewDNSProxy("127.0.0.1:0", []string{upstream}, func(name string, addrs []netip.Addr, ttl time.Duration) {
+		observed <- name
+	})
+	if err != nil {
+		t.Fatalf("NewDNSProxy() error: %v", err)
+	}
+	defer proxy.Close()
+	go proxy.Serve()
+
+	query, err := buildDNSQuery("big.corp.example", dnsmessage.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	resp, err := exchangeDNS(ctx, "tcp", []string{proxy.Addr().String()}, query)
+	if err != nil {
+		t.Fatalf("TCP query via proxy error: %v", err)
+	}
+	_, addrs, _, err := ParseDNSAnswer(resp)
+	if err != nil || len(addrs) != 1 || addrs[0] != netip.MustParseAddr("203.0.113.20") {
+		t.Errorf("answer = %v, %v, want [203.0.113.20]", addrs, err)
+	}
+	select {
+	case name := <-observed:
+		if name != "big.corp.example" {
+			t.Errorf("observed name = %q, want big.corp.example", name)
+		}
+	default:
+		t.Error("answer was relayed before the proxy reported it")
+	}
+}
@@ -0,0 +1,299 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var validDomainPattern = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?$`)
+
+const (
+	// minDomainTTL keeps very short DNS TTLs from causing route churn.
+	minDomainTTL = 30 * time.Second
+	// domainRouteGrace keeps a route alive after its TTL so connections opened
+	// just before expiry are not cut off.
+	domainRouteGrace = 2 * time.Minute
+)
+
+// DomainAction says how traffic to a resolved domain should be routed.
+type DomainAction int
+
+const (
+	DomainNone DomainAction = iota
+	DomainInclude
+	DomainExclude
+)
+
+// ValidateDomainPattern checks a split-tunnel domain pattern. A leading "*."
+// matches any subdomain; otherwise the name must match exactly.
+func ValidateDomainPattern(pattern string) error {
+	if !validDomainPattern.MatchString(pattern) {
+		return fmt.Errorf("invalid domain pattern %q", pattern)
+	}
+	return nil
+}
+
+// DomainMatcher maps DNS names to include/exclude actions.
+type DomainMatcher struct {
+	include []string
+	exclude []string
+}
+
+// NewDomainMatcher builds a matcher from include and exclude patterns.
+func NewDomainMatcher(include, exclude []string) *DomainMatcher {
+	return &DomainMatcher{
+		include: normalizeDomains(include),
+		exclude: normalizeDomains(exclude),
+	}
+}
+
+// Empty reports whether no patterns are configured.
+func (m *DomainMatcher) Empty() bool {
+	return len(m.include) == 0 && len(m.exclude) == 0
+}
+
+// Match returns the action for name. The longest matching pattern wins;
+// on a tie, exclusion takes precedence.
+func (m *DomainMatcher) Match(name string) DomainAction {
+	name = canonicalDomain(name)
+	best, action := -1, DomainNone
+	for _, p := range m.exclude {
+		if domainMatches(p, name) && len(p) > best {
+			best, action = len(p), DomainExclude
+		}
+	}
+	for _, p := range m.include {
+		if domainMatches(p, name) && len(p) > best {
+			best, action = len(p), DomainInclude
+		}
+	}
+	return action
+}
+
+// StaticNames returns the exact (non-wildcard) names that can be resolved
+// up front. Wildcards are only learnt from DNS answers.
+func (m *DomainMatcher) StaticNames() []string {
+	var names []string
+	for _, p := range append(append([]string{}, m.include...), m.exclude...) {
+		if !strings.HasPrefix(p, "*.") {
+			names = append(names, p)
+		}
+	}
+	return names
+}
+
+func domainMatches(pattern, name string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(name, suffix) && len(name) > len(suffix)
+	}
+	return pattern == name
+}
+
+func canonicalDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func normalizeDomains(patterns []string) []string {
+	var out []string
+	for _, p := range patterns {
+		if p = canonicalDomain(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ResolveFunc resolves a name and returns its addresses and the answer TTL.
+type ResolveFunc func(ctx context.Context, name string) ([]netip.Addr, time.Duration, error)
+
+type domainRoute struct {
+	action  DomainAction
+	expires time.Time
+}
+
+// DomainRouter keeps host routes in sync with the DNS answers for the
+// configured include/exclude domains, honouring answer TTLs.
+type DomainRouter struct {
+	matcher *DomainMatcher
+	routes  RouteManager
+	iface   string
+	resolve ResolveFunc
+
+	// AllowPrefix, when set, is called before an include route is added so
+	// the tunnel can accept traffic for the new prefix. RemovePrefix undoes
+	// it when the route goes away.
+	AllowPrefix  func(netip.Prefix) error
+	RemovePrefix func(netip.Prefix) error
+
+	mu      sync.Mutex
+	closed  bool
+	entries map[netip.Prefix]*domainRoute
+	refresh map[string]time.Time
+	now     func() time.Time
+}
+
+// NewDomainRouter creates a router that installs host routes through routes.
+func NewDomainRouter(matcher *DomainMatcher, routes RouteManager, iface string, resolve ResolveFunc) *DomainRouter {
+	return &DomainRouter{
+		matcher: matcher,
+		routes:  routes,
+		iface:   iface,
+		resolve: resolve,
+		entries: make(map[netip.Prefix]*domainRoute),
+		refresh: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Observe applies a DNS answer. Matching names get a host route per address
+// that lives for the answer TTL plus a grace period.
+func (r *DomainRouter) Observe(name string, addrs []netip.Addr, ttl time.Duration) {
+	action := r.matcher.Match(name)
+	if action == DomainNone || len(addrs) == 0 {
+		return
+	}
+	if ttl < minDomainTTL {
+		ttl = minDomainTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	expires := r.now().Add(ttl + domainRouteGrace)
+	for _, addr := range addrs {
+		prefix := netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		if e, ok := r.entries[prefix]; ok {
+			if e.action == action {
+				if expires.After(e.expires) {
+					e.expires = expires
+				}
+				continue
+			}
+			// Same address now answers for the other list; re-route it.
+			r.deleteLocked(prefix)
+		}
+		if err := r.addLocked(prefix, action); err != nil {
+			slog.Warn("failed to add domain route", "domain", name, "prefix", prefix, "error", err)
+			continue
+		}
+		r.entries[prefix] = &domainRoute{action: action, expires: expires}
+		slog.Debug("domain route added", "domain", name, "prefix", prefix, "bypass", action == DomainExclude, "ttl", ttl)
+	}
+}
+
+// Run resolves the static names up front and then refreshes them as their
+// TTLs run out, expiring stale routes, until ctx is cancelled.
+func (r *DomainRouter) Run(ctx context.Context) {
+	r.refreshNames(ctx)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refreshNames(ctx)
+			r.expire()
+		}
+	}
+}
+
+// Close stops the router from installing further routes. Routes already in
+// place stay tracked by the RouteManager and go away with RemoveVPNRoutes.
+func (r *DomainRouter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// Len returns the number of host routes currently installed.
+func (r *DomainRouter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+func (r *DomainRouter) refreshNames(ctx context.Context) {
+	if r.resolve == nil {
+		return
+	}
+	for _, name := range r.matcher.StaticNames() {
+		r.mu.Lock()
+		due := r.refresh[name]
+		r.mu.Unlock()
+		if r.now().Before(due) {
+			continue
+		}
+
+		addrs, ttl, err := r.resolve(ctx, name)
+		if err != nil {
+			slog.Debug("domain resolve failed", "domain", name, "error", err)
+			ttl = minDomainTTL
+		} else {
+			r.Observe(name, addrs, ttl)
+		}
+		if ttl < minDomainTTL {
+			ttl = minDomainTTL
+		}
+		r.mu.Lock()
+		r.refresh[name] = r.now().Add(ttl)
+		r.mu.Unlock()
+	}
+}
+
+func (r *DomainRouter) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	now := r.now()
+	for prefix, e := range r.entries {
+		if now.After(e.expires) {
+			r.deleteLocked(prefix)
+			slog.Debug("domain route expired", "prefix", prefix)
+		}
+	}
+}
+
+func (r *DomainRouter) addLocked(prefix netip.Prefix, action DomainAction) error {
+	if action == DomainExclude {
+		return r.routes.AddBypassRoute(prefix)
+	}
+	if r.AllowPrefix != nil {
+		if err := r.AllowPrefix(prefix); err != nil {
+			return err
+		}
+	}
+	if err := r.routes.AddRoute(prefix, r.iface); err != nil {
+		// Nothing records the prefix, so nothing would remove it later
+		if r.AllowPrefix != nil && r.RemovePrefix != nil {
+			if err := r.RemovePrefix(prefix); err != nil {
+				slog.Debug("failed to remove domain prefix from the tunnel", "prefix", prefix, "error", err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *DomainRouter) deleteLocked(prefix netip.Prefix) {
+	if err := r.routes.DeleteRoute(prefix); err != nil {
+		slog.Debug("failed to delete domain route", "prefix", prefix, "error", err)
+	}
+	if e := r.entries[prefix]; e != nil && e.action == DomainInclude && r.RemovePrefix != nil {
+		if err := r.RemovePrefix(prefix); err != nil {
+			slog.Debug("failed to remove domain prefix from the tunnel", "prefix", prefix, "error", err)
+		}
+	}
+	delete(r.entries, prefix)
+}
@@ -0,0 +1,262 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type fakeRoutes struct {
+	included map[netip.Prefix]string
+	bypassed map[netip.Prefix]bool
+	deleted  []netip.Prefix
+	addErr   error // returned by AddRoute
+}
+
+func newFakeRoutes() *fakeRoutes {
+	return &fakeRoutes{
+		included: make(map[netip.Prefix]string),
+		bypassed: make(map[netip.Prefix]bool),
+	}
+}
+
+func (f *fakeRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
+	return nil
+}
+
+func (f *fakeRoutes) RemoveVPNRoutes() error { return nil }
+
+func (f *fakeRoutes) AddRoute(prefix netip.Prefix, iface string) error {
+	if f.addErr != nil {
+		return f.addErr
+	}
+	f.included[prefix] = iface
+	return nil
+}
+
+func (f *fakeRoutes) AddBypassRoute(prefix netip.Prefix) error {
+	f.bypassed[prefix] = true
+	return nil
+}
+
+func (f *fakeRoutes) DeleteRoute(prefix netip.Prefix) error {
+	delete(f.included, prefix)
+	delete(f.bypassed, prefix)
+	f.deleted = append(f.deleted, prefix)
+	return nil
+}
+
+func TestValidateDomainPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"corp.example", true},
+		{"*.corp.example", true},
+		{"localhost", true},
+		{"", false},
+		{"*", false},
+		{"foo.*.example", false},
+		{"has space.example", false},
+		{"-bad.example", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := ValidateDomainPattern(tt.pattern)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateDomainPattern(%q) error = %v, want valid=%v", tt.pattern, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDomainMatcherMatch(t *testing.T) {
+	m := NewDomainMatcher(
+		[]string{"*.corp.example", "intranet.example"},
+		[]string{"*.netflix.com", "public.corp.example"},
+	)
+	tests := []struct {
+		name string
+		want DomainAction
+	}{
+		{"git.corp.example", DomainInclude},
+		{"a.b.corp.example.", DomainInclude},
+		{"GIT.Corp.Example", DomainInclude},
+		{"corp.example", DomainNone},
+		{"intranet.example", DomainInclude},
+		{"www.intranet.example", DomainNone},
+		{"www.netflix.com", DomainExclude},
+		{"public.corp.example", DomainExclude},
+		{"example.org", DomainNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Match(tt.name); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainMatcherStaticNames(t *testing.T) {
+	m := NewDomainMatcher([]string{"*.corp.example", "Intranet.Example."}, []string{"video.example"})
+	got := m.StaticNames()
+	if len(got) != 2 || got[0] != "intranet.example" || got[1] != "video.example" {
+		t.Errorf("StaticNames() = %v, want [intranet.example video.example]", got)
+	}
+	if !NewDomainMatcher(nil, nil).Empty() {
+		t.Error("matcher without patterns should be empty")
+	}
+}
+
+func TestDomainRouterObserve(t *testing.T) {
+	routes := newFakeRoutes()
+	m := NewDomainMatcher([]string{"*.corp.example"}, []string{"*.netflix.com"})
+	r := NewDomainRouter(m, routes, "voidvpn0", nil)
+
+	var allowed []netip.Prefix
+	r.AllowPrefix = func(p netip.Prefix) error {
+		allowed = append(allowed, p)
+		return nil
+	}
+
+	r.Observe("git.corp.example", []netip.Addr{netip.MustParseAddr("203.0.113.10"), netip.MustParseAddr("2001:db8::10")}, time.Minute)
+	r.Observe("www.netflix.com", []netip.Addr{netip.MustParseAddr("198.51.100.7")}, time.Minute)
+	r.Observe("example.org", []netip.Addr{netip.MustParseAddr("192.0.2.1")}, time.Minute)
+
+	if routes.included[netip.MustParsePrefix("203.0.113.10/32")] != "voidvpn0" {
+		t.Error("include domain should be routed through the tunnel")
+	}
+	if routes.included[netip.MustParsePrefix("2001:db8::10/128")] != "voidvpn0" {
+		t.Error("IPv6 answer for include domain should be routed through the tunnel")
+	}
+	if !routes.bypassed[netip.MustParsePrefix("198.51.100.7/32")] {
+		t.Error("exclude domain should get a bypass route")
+	}
+	if len(allowed) != 2 {
+		t.Errorf("AllowPrefix called %d times, want 2 (include routes only)", len(allowed))
+	}
+	if r.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", r.Len())
+	}
+}
+
+func TestDomainRouterExpiresAfterTTL(t *testing.T) {
+	routes := newFakeRoutes()
+	r := NewDomainRouter(NewDomainMatcher([]string{"*.corp.example"}, nil), routes, "voidvpn0", nil)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	addr := []netip.Addr{netip.MustParseAddr("203.0.113.10")}
+	r.Observe("git.corp.example", addr, 10*time.Second)
+
+	// TTL below the floor is raised to minDomainTTL
+	now = now.Add(minDomainTTL + domainRouteGrace - time.Second)
+	r.expire()
+	if r.Len() != 1 {
+		t.Fatal("route should survive until TTL plus grace")
+	}
+
+	// A fresh answer extends the lifetime
+	r.Observe("git.corp.example", addr, time.Hour)
+	now = now.Add(time.Minute)
+	r.expire()
+	if r.Len() != 1 {
+		t.Fatal("refreshed route should not expire")
+	}
+
+	now = now.Add(time.Hour + domainRouteGrace)
+	r.expire()
+	if r.Len() != 0 {
+		t.Error("route should expire once TTL and grace have passed")
+	}
+	if len(routes.deleted) != 1 {
+		t.Errorf("DeleteRoute called %d times, want 1", len(routes.deleted))
+	}
+}
+
+func TestDomainRouterRemovesExpiredPrefixes(t *testing.T) {
+	routes := newFakeRoutes()
+	r := NewDomainRouter(NewDomainMatcher([]string{"*.corp.example"}, []string{"*.netflix.com"}), routes, "voidvpn0", nil)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	allowed := make(map[netip.Prefix]bool)
+	r.AllowPrefix = func(p netip.Prefix) error { allowed[p] = true; return nil }
+	r.RemovePrefix = func(p netip.Prefix) error { delete(allowed, p); return nil }
+
+	r.Observe("git.corp.example", []netip.Addr{netip.MustParseAddr("203.0.113.10")}, time.Minute)
+	r.Observe("www.netflix.com", []netip.Addr{netip.MustParseAddr("198.51.100.7")}, time.Minute)
+	if len(allowed) != 1 {
+		t.Fatalf("allowed = %v, want the include prefix", allowed)
+	}
+
+	now = now.Add(time.Minute + domainRouteGrace + time.Second)
+	r.expire()
+	if len(allowed) != 0 {
+		t.Errorf("allowed = %v, want the expired prefix removed from the tunnel", allowed)
+	}
+}
+
+func TestDomainRouterRemovesPrefixWhenRouteFails(t *testing.T) {
+	routes := newFakeRoutes()
+	routes.addErr = fmt.Errorf("file exists")
+	r := NewDomainRouter(NewDomainMatcher([]string{"*.corp.example"}, nil), routes, "voidvpn0", nil)
+	allowed := make(map[netip.Prefix]bool)
+	r.AllowPrefix = func(p netip.Prefix) error { allowed[p] = true; return nil }
+	r.RemovePrefix = func(p netip.Prefix) error { delete(allowed, p); return nil }
+
+	r.Observe("git.corp.example", []netip.Addr{netip.MustParseAddr("203.0.113.10")}, time.Minute)
+	if len(allowed) != 0 {
+		t.Errorf("allowed = %v, want the prefix removed after AddRoute failed", allowed)
+	}
+	if len(r.entries) != 0 {
+		t.Errorf("entries = %v, want none", r.entries)
+	}
+}
+
+func TestDomainRouterRefreshStaticNames(t *testing.T) {
+	routes := newFakeRoutes()
+	calls := 0
+	resolve := func(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+		calls++
+		if name != "intranet.example" {
+			return nil, 0, fmt.Errorf("unexpected name %q", name)
+		}
+		return []netip.Addr{netip.MustParseAddr("10.20.0.5")}, 5 * time.Minute, nil
+	}
+	r := NewDomainRouter(NewDomainMatcher([]string{"intranet.example", "*.corp.example"}, nil), routes, "voidvpn0", resolve)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.refreshNames(context.Background())
+	if calls != 1 {
+		t.Fatalf("resolve called %d times, want 1 (wildcards are not resolved)", calls)
+	}
+	if _, ok := routes.included[netip.MustParsePrefix("10.20.0.5/32")]; !ok {
+		t.Error("static include name should be routed after refresh")
+	}
+
+	// Not due again until the TTL runs out
+	now = now.Add(time.Minute)
+	r.refreshNames(context.Background())
+	if calls != 1 {
+		t.Errorf("resolve called %d times before TTL expiry, want 1", calls)
+	}
+	now = now.Add(5 * time.Minute)
+	r.refreshNames(context.Background())
+	if calls != 2 {
+		t.Errorf("resolve called %d times after TTL expiry, want 2", calls)
+	}
+}
+
+func TestDomainRouterClosed(t *testing.T) {
+	routes := newFakeRoutes()
+	r := NewDomainRouter(NewDomainMatcher([]string{"*.corp.example"}, nil), routes, "voidvpn0", nil)
+	r.Close()
+	r.Observe("git.corp.example", []netip.Addr{netip.MustParseAddr("203.0.113.10")}, time.Minute)
+	if len(routes.included) != 0 {
+		t.Error("closed router should not add routes")
+	}
+}
@@ -1,31 +1,31 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
 	"os/exec"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
+// nativeAssignAddress, when set by a platform file, configures the address
+// and brings the link up without external tools. It returns
+// errNativeUnavailable to fall back to the ip command.
+var nativeAssignAddress func(iface string, prefix netip.Prefix) error
+
+var errNativeUnavailable = errors.New("native network configuration unavailable")
+
 // AssignAddress assigns an IP address to a network interface.
 func AssignAddress(iface string, address string) error {
 	if address == "" {
 		return fmt.Errorf("tunnel address is empty — check server config")
 	}
 
-	prefix, err := netip.ParsePrefix(address)
+	prefix, err := parseTunnelAddress(address)
 	if err != nil {
-		if addr, err2 := netip.ParseAddr(address); err2 == nil {
-			// Use /32 for IPv4, /128 for IPv6
-			bits := 32
-			if addr.Is6() {
-				bits = 128
-			}
-			prefix = netip.PrefixFrom(addr, bits)
-		} else {
-			return fmt.Errorf("invalid address %q: %w", address, err)
-		}
+		return err
 	}
 
 	switch runtime.GOOS {
@@ -36,6 +36,21 @@ func AssignAddress(iface string, address string) error {
 	}
 }
 
+// parseTunnelAddress parses a tunnel address in CIDR notation. A bare
+// address is treated as a host prefix.
+func parseTunnelAddress(address string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(address)
+	if err != nil {
+		addr, err2 := netip.ParseAddr(address)
+		if err2 != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		// Use /32 for IPv4, /128 for IPv6
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return prefix, nil
+}
+
 func assignAddressWindows(iface string, prefix netip.Prefix) error {
 	addr := prefix.Addr().String()
 	mask := prefixToMask(prefix.Bits())
@@ -49,20 +64,51 @@ func assignAddressWindows(iface string, prefix netip.Prefix) error {
 }
 
 func assignAddressLinux(iface string, prefix netip.Prefix) error {
+	if nativeAssignAddress != nil {
+		if err := nativeAssignAddress(iface, prefix); !errors.Is(err, errNativeUnavailable) {
+			return err
+		}
+	}
+
 	cmd := exec.Command("ip", "addr", "add", prefix.String(), "dev", iface)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("ip addr add failed: %s: %w", string(out), err)
+		return &RouteError{Op: "add address", Target: prefix.String(), Err: ipCommandError(out, err)}
 	}
 
 	// Bring interface up
 	linkCmd := exec.Command("ip", "link", "set", iface, "up")
 	if out, err := linkCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ip link set up failed: %s: %w", string(out), err)
+		return &RouteError{Op: "set link up", Target: iface, Err: ipCommandError(out, err)}
 	}
 	return nil
 }
 
+// ipCommandError converts iproute2 output into the matching syscall.Errno so
+// the exec fallback reports the same errors as the netlink backend.
+func ipCommandError(out []byte, err error) error {
+	msg := strings.TrimSpace(string(out))
+	for text, errno := range ipErrnoMessages {
+		if strings.Contains(msg, text) {
+			return errno
+		}
+	}
+	if msg == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+var ipErrnoMessages = map[string]syscall.Errno{
+	"File exists":             syscall.EEXIST,
+	"Network is unreachable":  syscall.ENETUNREACH,
+	"No such process":         syscall.ESRCH,
+	"Cannot find device":      syscall.ENODEV,
+	"No such device":          syscall.ENODEV,
+	"Operation not permitted": syscall.EPERM,
+	"Invalid argument":        syscall.EINVAL,
+}
+
 func prefixToMask(bits int) string {
 	mask := uint32(0xFFFFFFFF) << (32 - bits)
 	return fmt.Sprintf("%d.%d.%d.%d",
@@ -1,7 +1,9 @@
 package network
 
 import (
+	"errors"
 	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -175,3 +177,25 @@ func TestPrefixToMaskEdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestIPCommandError(t *testing.T) {
+	tests := []struct {
+		out  string
+		want error
+	}{
+		{"RTNETLINK answers: File exists", syscall.EEXIST},
+		{"RTNETLINK answers: Network is unreachable", syscall.ENETUNREACH},
+		{"Cannot find device \"voidvpn0\"", syscall.ENODEV},
+	}
+	for _, tt := range tests {
+		err := &RouteError{Op: "add route", Target: "10.0.0.0/8", Err: ipCommandError([]byte(tt.out), errors.New("exit status 2"))}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("ipCommandError(%q) = %v, want errors.Is %v", tt.out, err, tt.want)
+		}
+	}
+
+	err := ipCommandError([]byte("something odd"), errors.New("exit status 1"))
+	if !strings.Contains(err.Error(), "something odd") {
+		t.Errorf("unknown output should be kept in the error, got %v", err)
+	}
+}
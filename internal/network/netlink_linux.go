@@ -0,0 +1,232 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// netlinkRoutes manages routes over rtnetlink, so it works on minimal systems
+// without iproute2. Kernel errors surface as syscall.Errno inside RouteError.
+type netlinkRoutes struct {
+	added     []netlink.Route
+	defaultGW net.IP
+	gwLink    int // link index of the default route
+}
+
+func init() {
+	nativeAssignAddress = assignAddressNetlink
+}
+
+func newNetlinkRoutes() RouteManager {
+	return &netlinkRoutes{}
+}
+
+// netlinkAvailable reports whether an rtnetlink socket can be opened. Some
+// sandboxes block netlink, in which case the iproute2 backend is used.
+func netlinkAvailable() bool {
+	h, err := netlink.NewHandle(syscall.NETLINK_ROUTE)
+	if err != nil {
+		return false
+	}
+	h.Close()
+	return true
+}
+
+func (r *netlinkRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+
+	endpointAddr, err := resolveEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	gw, gwLink, err := netlinkDefaultRoute()
+	if err != nil {
+		return &RouteError{Op: "read default route", Target: "IPv4", Err: err}
+	}
+	r.defaultGW, r.gwLink = gw, gwLink
+
+	// Route VPN endpoint via current default gateway
+	if gw != nil && endpointAddr.Is4() {
+		host := netip.PrefixFrom(endpointAddr, 32)
+		route := netlink.Route{Dst: prefixToIPNet(host), Gw: gw, LinkIndex: gwLink}
+		if err := r.add(route, host); err != nil {
+			return err
+		}
+	}
+
+	// Route each prefix through the tunnel interface
+	for _, prefix := range routes {
+		route := netlink.Route{Dst: prefixToIPNet(prefix), LinkIndex: link.Attrs().Index, Scope: netlink.SCOPE_LINK}
+		if err := r.add(route, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *netlinkRoutes) RemoveVPNRoutes() error {
+	var lastErr error
+	for i := len(r.added) - 1; i >= 0; i-- {
+		route := r.added[i]
+		if err := netlink.RouteDel(&route); err != nil {
+			lastErr = &RouteError{Op: "delete route", Target: route.Dst.String(), Err: err}
+		}
+	}
+	r.added = nil
+	return lastErr
+}
+
+func (r *netlinkRoutes) AddRoute(prefix netip.Prefix, iface string) error {
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+	route := netlink.Route{Dst: prefixToIPNet(prefix), LinkIndex: link.Attrs().Index, Scope: netlink.SCOPE_LINK}
+	return r.add(route, prefix)
+}
+
+func (r *netlinkRoutes) AddBypassRoute(prefix netip.Prefix) error {
+	if prefix.Addr().Is6() {
+		return fmt.Errorf("bypass route %s: IPv6 bypass is not supported", prefix)
+	}
+	if r.defaultGW == nil {
+		return fmt.Errorf("bypass route %s: no default gateway known", prefix)
+	}
+	route := netlink.Route{Dst: prefixToIPNet(prefix), Gw: r.defaultGW, LinkIndex: r.gwLink}
+	return r.add(route, prefix)
+}
+
+func (r *netlinkRoutes) DeleteRoute(prefix netip.Prefix) error {
+	dst := prefixToIPNet(prefix).String()
+	for i, route := range r.added {
+		if route.Dst.String() != dst {
+			continue
+		}
+		r.added = append(r.added[:i], r.added[i+1:]...)
+		if err := netlink.RouteDel(&route); err != nil {
+			return &RouteError{Op: "delete route", Target: prefix.String(), Err: err}
+		}
+		return nil
+	}
+	return fmt.Errorf("route %s was not added by VoidVPN", prefix)
+}
+
+func (r *netlinkRoutes) add(route netlink.Route, prefix netip.Prefix) error {
+	if err := netlink.RouteAdd(&route); err != nil {
+		return &RouteError{Op: "add route", Target: prefix.String(), Err: err}
+	}
+	r.added = append(r.added, route)
+	return nil
+}
+
+// netlinkDefaultRoute returns the gateway and link index of the IPv4 default
+// route in the main table with the lowest metric. The gateway is nil for
+// point-to-point default routes; the link index is 0 if there is no default.
+func netlinkDefaultRoute() (net.IP, int, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, 0, err
+	}
+	var best *netlink.Route
+	for i := range routes {
+		rt := &routes[i]
+		if rt.Dst != nil {
+			if ones, _ := rt.Dst.Mask.Size(); ones != 0 {
+				continue
+			}
+		}
+		if best == nil || rt.Priority < best.Priority {
+			best = rt
+		}
+	}
+	if best == nil {
+		return nil, 0, nil
+	}
+	if best.Gw == nil && len(best.MultiPath) > 0 {
+		return best.MultiPath[0].Gw, best.MultiPath[0].LinkIndex, nil
+	}
+	return best.Gw, best.LinkIndex, nil
+}
+
+// defaultRouteNetlink is the netlink flavour of defaultRoute.
+func defaultRouteNetlink() (gw, dev string, err error) {
+	ip, index, err := netlinkDefaultRoute()
+	if err != nil || index == 0 {
+		return "", "", err
+	}
+	link, err := netlink.LinkByIndex(index)
+	if err != nil {
+		return "", "", err
+	}
+	if ip != nil {
+		gw = ip.String()
+	}
+	return gw, link.Attrs().Name, nil
+}
+
+// assignAddressNetlink adds prefix to iface and brings the link up.
+func assignAddressNetlink(iface string, prefix netip.Prefix) error {
+	if !netlinkAvailable() {
+		return errNativeUnavailable
+	}
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+	addr := &netlink.Addr{IPNet: &net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}}
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		return &RouteError{Op: "add address", Target: prefix.String(), Err: err}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &RouteError{Op: "set link up", Target: iface, Err: err}
+	}
+	return nil
+}
+
+func lookupLink(iface string) (netlink.Link, error) {
+	if !validIfaceName.MatchString(iface) {
+		return nil, fmt.Errorf("invalid interface name: %q", iface)
+	}
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			err = syscall.ENODEV
+		}
+		return nil, &RouteError{Op: "find interface", Target: iface, Err: err}
+	}
+	return link, nil
+}
+
+// resolveEndpoint parses an endpoint host, resolving names if necessary.
+func resolveEndpoint(endpoint string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(endpoint); err == nil {
+		return addr.Unmap(), nil
+	}
+	ips, err := net.LookupIP(endpoint)
+	if err != nil || len(ips) == 0 {
+		return netip.Addr{}, fmt.Errorf("failed to resolve endpoint %q: %w", endpoint, err)
+	}
+	addr, _ := netip.AddrFromSlice(ips[0])
+	return addr.Unmap(), nil
+}
+
+func prefixToIPNet(prefix netip.Prefix) *net.IPNet {
+	prefix = prefix.Masked()
+	return &net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}
+}
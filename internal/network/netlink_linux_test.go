@@ -0,0 +1,52 @@
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"net/netip"
+	"syscall"
+	"testing"
+)
+
+func TestPrefixToIPNet(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"10.0.0.7/24", "10.0.0.0/24"},
+		{"0.0.0.0/0", "0.0.0.0/0"},
+		{"2001:db8::1/64", "2001:db8::/64"},
+	}
+	for _, tt := range tests {
+		if got := prefixToIPNet(netip.MustParsePrefix(tt.prefix)).String(); got != tt.want {
+			t.Errorf("prefixToIPNet(%s) = %s, want %s", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestLookupLinkInvalidName(t *testing.T) {
+	if _, err := lookupLink("bad iface!"); err == nil {
+		t.Error("lookupLink should reject invalid interface names")
+	}
+}
+
+func TestLookupLinkMissing(t *testing.T) {
+	if !netlinkAvailable() {
+		t.Skip("netlink unavailable")
+	}
+	_, err := lookupLink("voidvpn-nope9")
+	if !errors.Is(err, syscall.ENODEV) {
+		t.Errorf("lookupLink(missing) error = %v, want ENODEV", err)
+	}
+}
+
+func TestNetlinkDeleteUnknownRoute(t *testing.T) {
+	r := &netlinkRoutes{}
+	if err := r.DeleteRoute(netip.MustParsePrefix("203.0.113.0/24")); err == nil {
+		t.Error("DeleteRoute should error for routes it did not add")
+	}
+	if err := r.RemoveVPNRoutes(); err != nil {
+		t.Errorf("RemoveVPNRoutes() on empty should return nil, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// namespacePrefix starts the name of every network namespace VoidVPN creates.
+const namespacePrefix = "voidvpn-"
+
+// NamespaceConfig is the network configured inside a tunnel namespace.
+type NamespaceConfig struct {
+	Address string         // tunnel address, as in the server config
+	Routes  []netip.Prefix // destinations routed through the tunnel
+	DNS     []string       // nameservers for programs in the namespace
+}
+
+// NamespaceManager keeps a tunnel interface in a dedicated, named network
+// namespace. Only programs started in the namespace use the tunnel; the
+// host's addresses, routes and DNS are left untouched.
+type NamespaceManager interface {
+	// Name returns the namespace name, as shown by `ip netns list`.
+	Name() string
+	// Setup creates the namespace unless it already exists, moves iface into
+	// it and configures the address, routes and DNS there.
+	Setup(iface string, cfg NamespaceConfig) error
+	// Teardown removes what Setup created. It is a no-op if nothing was set up.
+	Teardown() error
+}
+
+// NewNamespaceManager returns a platform-appropriate namespace manager for
+// the named namespace.
+func NewNamespaceManager(name string) NamespaceManager {
+	return newNamespaceManager(name)
+}
+
+// NamespaceName returns the network namespace used for a server. Server
+// names are already restricted to letters, digits, hyphens, underscores and
+// spaces; spaces become hyphens as in server file names.
+func NamespaceName(server string) string {
+	return namespacePrefix + strings.ReplaceAll(strings.ToLower(server), " ", "-")
+}
+
+// namespaceResolvConf renders the resolv.conf used inside a namespace.
+func namespaceResolvConf(servers []string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("# Generated by VoidVPN\n")
+	for _, server := range servers {
+		if _, err := netip.ParseAddr(server); err != nil {
+			return "", fmt.Errorf("invalid DNS server address: %q", server)
+		}
+		sb.WriteString(fmt.Sprintf("nameserver %s\n", server))
+	}
+	return sb.String(), nil
+}
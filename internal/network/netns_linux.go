@@ -0,0 +1,205 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// namespaceEtcDir holds per-namespace files that `ip netns exec` bind-mounts
+// over /etc; VoidVPN follows the same convention for resolv.conf.
+const namespaceEtcDir = "/etc/netns"
+
+type linuxNamespace struct {
+	name       string
+	created    bool   // the namespace did not exist before Setup
+	resolvConf string // written resolv.conf, removed on teardown
+}
+
+func newNamespaceManager(name string) NamespaceManager {
+	return &linuxNamespace{name: name}
+}
+
+func (n *linuxNamespace) Name() string {
+	return n.name
+}
+
+// Setup moves iface into the namespace. The interface keeps the sockets it
+// was created with, so WireGuard's UDP socket stays in the host namespace and
+// reaches the endpoint over the host's network while the interface, its
+// address and routes are only visible inside the namespace.
+func (n *linuxNamespace) Setup(iface string, cfg NamespaceConfig) error {
+	prefix, err := parseTunnelAddress(cfg.Address)
+	if err != nil {
+		return err
+	}
+	resolvConf, err := namespaceResolvConf(cfg.DNS)
+	if err != nil {
+		return err
+	}
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+
+	ns, err := n.open()
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	if err := netlink.LinkSetNsFd(link, int(ns)); err != nil {
+		return &RouteError{Op: "move interface", Target: iface, Err: err}
+	}
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink in namespace %s: %w", n.name, err)
+	}
+	defer h.Close()
+	if err := n.configure(h, iface, prefix, cfg.Routes); err != nil {
+		return err
+	}
+
+	if len(cfg.DNS) > 0 {
+		dir := filepath.Join(namespaceEtcDir, n.name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		path := filepath.Join(dir, "resolv.conf")
+		if err := os.WriteFile(path, []byte(resolvConf), 0644); err != nil {
+			return fmt.Errorf("failed to write namespace DNS config: %w", err)
+		}
+		n.resolvConf = path
+	}
+	return nil
+}
+
+// configure brings up loopback and the tunnel inside the namespace and routes
+// cfg.Routes through it. No endpoint route is needed: the tunnel's own
+// traffic never enters the namespace.
+func (n *linuxNamespace) configure(h *netlink.Handle, iface string, prefix netip.Prefix, routes []netip.Prefix) error {
+	if lo, err := h.LinkByName("lo"); err == nil {
+		if err := h.LinkSetUp(lo); err != nil {
+			return &RouteError{Op: "set link up", Target: "lo", Err: err}
+		}
+	}
+
+	link, err := h.LinkByName(iface)
+	if err != nil {
+		return &RouteError{Op: "find interface", Target: iface, Err: err}
+	}
+	addr := &netlink.Addr{IPNet: &net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}}
+	if err := h.AddrAdd(link, addr); err != nil {
+		return &RouteError{Op: "add address", Target: prefix.String(), Err: err}
+	}
+	if err := h.LinkSetUp(link); err != nil {
+		return &RouteError{Op: "set link up", Target: iface, Err: err}
+	}
+
+	for _, p := range routes {
+		route := &netlink.Route{Dst: prefixToIPNet(p), LinkIndex: link.Attrs().Index, Scope: netlink.SCOPE_LINK}
+		if err := h.RouteAdd(route); err != nil {
+			if p.Addr().Is6() && prefix.Addr().Is4() {
+				slog.Debug("IPv6 route unavailable in namespace", "route", p, "error", err)
+				continue
+			}
+			return &RouteError{Op: "add route", Target: p.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// open returns the named namespace, creating it if needed. It is persistent
+// like one made with `ip netns add`, so other processes can join it by name.
+func (n *linuxNamespace) open() (netns.NsHandle, error) {
+	if ns, err := netns.GetFromName(n.name); err == nil {
+		slog.Debug("reusing network namespace", "namespace", n.name)
+		return ns, nil
+	}
+
+	// NewNamed switches the calling thread into the new namespace, so it is
+	// done on a locked thread that is switched back afterwards.
+	runtime.LockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return netns.None(), fmt.Errorf("failed to open current network namespace: %w", err)
+	}
+	defer orig.Close()
+	ns, err := netns.NewNamed(n.name)
+	// If switching back fails the thread stays locked and is discarded when
+	// the goroutine exits, rather than running other code in the namespace.
+	if restoreErr := netns.Set(orig); restoreErr == nil {
+		runtime.UnlockOSThread()
+	}
+	if err != nil {
+		return netns.None(), fmt.Errorf("failed to create network namespace %s: %w", n.name, err)
+	}
+	n.created = true
+	return ns, nil
+}
+
+func (n *linuxNamespace) Teardown() error {
+	var lastErr error
+	if n.resolvConf != "" {
+		if err := os.Remove(n.resolvConf); err != nil && !os.IsNotExist(err) {
+			lastErr = err
+		}
+		os.Remove(filepath.Dir(n.resolvConf))
+		n.resolvConf = ""
+	}
+	// Programs still running in the namespace keep it alive until they exit;
+	// only the name goes away here.
+	if n.created {
+		if err := netns.DeleteNamed(n.name); err != nil {
+			lastErr = fmt.Errorf("failed to delete network namespace %s: %w", n.name, err)
+		}
+		n.created = false
+	}
+	return lastErr
+}
+
+// EnterNamespace moves the calling goroutine's thread into the named network
+// namespace, with the namespace's resolv.conf bind-mounted over
+// /etc/resolv.conf in a private mount namespace as `ip netns exec` does.
+// Processes started from the goroutine afterwards run inside it. The
+// goroutine stays locked to the thread, which is discarded when it exits.
+func EnterNamespace(name string) error {
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return fmt.Errorf("network namespace %s not found: %w", name, err)
+	}
+	defer ns.Close()
+
+	runtime.LockOSThread()
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("failed to create mount namespace: %w", err)
+	}
+	// Keep the bind mount below from propagating back to the host
+	if err := unix.Mount("", "/", "", unix.MS_SLAVE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	resolvConf := filepath.Join(namespaceEtcDir, name, "resolv.conf")
+	if _, err := os.Stat(resolvConf); err == nil {
+		if err := unix.Mount(resolvConf, "/etc/resolv.conf", "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount %s: %w", resolvConf, err)
+		}
+	}
+	if err := netns.Set(ns); err != nil {
+		return fmt.Errorf("failed to enter network namespace %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+func TestNamespaceSetup(t *testing.T) {
+	dev, err := tun.CreateTUN("voidvpnns0", 1420)
+	if err != nil {
+		t.Skipf("cannot create TUN device: %v", err)
+	}
+	defer dev.Close()
+
+	name := NamespaceName(fmt.Sprintf("test-%d", os.Getpid()))
+	n := newNamespaceManager(name).(*linuxNamespace)
+	cfg := NamespaceConfig{
+		Address: "10.66.0.2/32",
+		Routes:  []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")},
+		DNS:     []string{"10.66.0.1"},
+	}
+	if err := n.Setup("voidvpnns0", cfg); err != nil {
+		n.Teardown()
+		t.Skipf("cannot set up network namespace: %v", err)
+	}
+
+	if _, err := netlink.LinkByName("voidvpnns0"); err == nil {
+		t.Error("interface should no longer be in the host namespace")
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		t.Fatalf("namespace %s not found: %v", name, err)
+	}
+	h, err := netlink.NewHandleAt(ns)
+	ns.Close()
+	if err != nil {
+		t.Fatalf("NewHandleAt: %v", err)
+	}
+	defer h.Close()
+	link, err := h.LinkByName("voidvpnns0")
+	if err != nil {
+		t.Fatalf("interface not in namespace: %v", err)
+	}
+	routes, err := h.RouteList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatalf("RouteList: %v", err)
+	}
+	hasDefault := false
+	for _, r := range routes {
+		if r.Dst != nil && r.Dst.String() == "0.0.0.0/0" {
+			hasDefault = true
+		}
+	}
+	if !hasDefault {
+		t.Errorf("namespace routes %v lack the default route", routes)
+	}
+	if data, err := os.ReadFile(filepath.Join(namespaceEtcDir, name, "resolv.conf")); err != nil {
+		t.Errorf("namespace resolv.conf: %v", err)
+	} else if string(data) != "# Generated by VoidVPN\nnameserver 10.66.0.1\n" {
+		t.Errorf("namespace resolv.conf = %q", data)
+	}
+
+	// A program started after EnterNamespace sees the namespace's interfaces
+	// and resolv.conf. The goroutine's thread is discarded when it exits.
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		if err := EnterNamespace(name); err != nil {
+			done <- result{err: err}
+			return
+		}
+		out, err := exec.Command("cat", "/proc/self/net/dev", "/etc/resolv.conf").Output()
+		done <- result{out, err}
+	}()
+	if r := <-done; r.err != nil {
+		t.Errorf("running in namespace: %v", r.err)
+	} else {
+		for _, want := range []string{"voidvpnns0:", "nameserver 10.66.0.1"} {
+			if !strings.Contains(string(r.out), want) {
+				t.Errorf("namespace view missing %q:\n%s", want, r.out)
+			}
+		}
+	}
+
+	if err := n.Teardown(); err != nil {
+		t.Fatalf("Teardown: %v", err)
+	}
+	if ns, err := netns.GetFromName(name); err == nil {
+		ns.Close()
+		t.Errorf("namespace %s still exists after teardown", name)
+	}
+	if _, err := os.Stat(filepath.Join(namespaceEtcDir, name)); !os.IsNotExist(err) {
+		t.Errorf("namespace config dir still exists after teardown")
+	}
+}
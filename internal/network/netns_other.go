@@ -0,0 +1,26 @@
+//go:build !linux
+
+package network
+
+import "errors"
+
+var errNamespaceUnsupported = errors.New("network namespace mode is only supported on Linux")
+
+type unsupportedNamespace struct{ name string }
+
+func newNamespaceManager(name string) NamespaceManager {
+	return unsupportedNamespace{name: name}
+}
+
+func (n unsupportedNamespace) Name() string { return n.name }
+
+func (unsupportedNamespace) Setup(iface string, cfg NamespaceConfig) error {
+	return errNamespaceUnsupported
+}
+
+func (unsupportedNamespace) Teardown() error { return nil }
+
+// EnterNamespace is only supported on Linux.
+func EnterNamespace(name string) error {
+	return errNamespaceUnsupported
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNamespaceName(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"work", "voidvpn-work"},
+		{"My Server", "voidvpn-my-server"},
+		{"de_fra-1", "voidvpn-de_fra-1"},
+	}
+	for _, tt := range tests {
+		if got := NamespaceName(tt.server); got != tt.want {
+			t.Errorf("NamespaceName(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaceResolvConf(t *testing.T) {
+	got, err := namespaceResolvConf([]string{"10.0.0.1", "fd00::1"})
+	if err != nil {
+		t.Fatalf("namespaceResolvConf: %v", err)
+	}
+	for _, want := range []string{"nameserver 10.0.0.1\n", "nameserver fd00::1\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("resolv.conf missing %q:\n%s", want, got)
+		}
+	}
+	if _, err := namespaceResolvConf([]string{"1.1.1.1\nsearch evil"}); err == nil {
+		t.Error("namespaceResolvConf should reject invalid addresses")
+	}
+}
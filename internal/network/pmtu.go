@@ -0,0 +1,62 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+const (
+	// DefaultTunnelMTU is the WireGuard MTU that fits a 1500-byte path over
+	// either IPv4 or IPv6.
+	DefaultTunnelMTU = 1420
+
+	// wireGuardOverhead is the UDP header plus WireGuard's data message
+	// header (type, receiver index, counter) and Poly1305 tag.
+	wireGuardOverhead = 8 + 16 + 16
+
+	minTunnelMTU = 576
+)
+
+// TunnelMTU returns the largest tunnel MTU whose encrypted packets fit in
+// pathMTU, for IPv4 or IPv6 transport to the endpoint.
+func TunnelMTU(pathMTU int, ipv6 bool) int {
+	ipHeader := 20
+	if ipv6 {
+		ipHeader = 40
+	}
+	mtu := pathMTU - ipHeader - wireGuardOverhead
+	if mtu < minTunnelMTU {
+		return minTunnelMTU
+	}
+	return mtu
+}
+
+// ProbeTunnelMTU measures the path MTU to endpoint (host:port) with DF-set
+// UDP probes and returns the tunnel MTU that fits it. fwmark, if non-zero,
+// marks the probes like the tunnel's own packets so policy routing sends
+// them the same way.
+func ProbeTunnelMTU(endpoint string, fwmark uint32) (int, error) {
+	udp, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve endpoint %q: %w", endpoint, err)
+	}
+	ap := udp.AddrPort()
+	ap = netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+	pathMTU, lowered, err := probePathMTU(ap, fwmark)
+	if err != nil {
+		return 0, err
+	}
+	return probedTunnelMTU(pathMTU, ap.Addr().Is6(), lowered), nil
+}
+
+// probedTunnelMTU is TunnelMTU for a probed path. Unless ICMP lowered the
+// estimate, the probe only saw the local link, and a path that drops ICMP
+// may be narrower still, so the result is capped at DefaultTunnelMTU.
+func probedTunnelMTU(pathMTU int, ipv6, lowered bool) int {
+	mtu := TunnelMTU(pathMTU, ipv6)
+	if !lowered && mtu > DefaultTunnelMTU {
+		return DefaultTunnelMTU
+	}
+	return mtu
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	pmtuProbeRounds = 4
+	pmtuProbeWait   = 150 * time.Millisecond
+)
+
+// probePathMTU sends datagrams the size of the kernel's current path MTU
+// estimate with DF set. A router that cannot forward one answers with ICMP
+// "fragmentation needed", which lowers the estimate; probing stops once a
+// round leaves it unchanged. It reports whether ICMP lowered the estimate
+// while probing. Probes are not valid WireGuard messages, so the server
+// drops them.
+func probePathMTU(ap netip.AddrPort, fwmark uint32) (int, bool, error) {
+	family, level, discover, mtuOpt := unix.AF_INET, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_MTU
+	var sa unix.Sockaddr = &unix.SockaddrInet4{Port: int(ap.Port()), Addr: ap.Addr().As4()}
+	ipHeader := 20
+	if ap.Addr().Is6() {
+		family, level, discover, mtuOpt = unix.AF_INET6, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_MTU
+		sa = &unix.SockaddrInet6{Port: int(ap.Port()), Addr: ap.Addr().As16()}
+		ipHeader = 40
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open probe socket: %w", err)
+	}
+	defer unix.Close(fd)
+	// IP_PMTUDISC_DO and IPV6_PMTUDISC_DO share a value
+	if err := unix.SetsockoptInt(fd, level, discover, unix.IP_PMTUDISC_DO); err != nil {
+		return 0, false, fmt.Errorf("failed to set DF on probe socket: %w", err)
+	}
+	if fwmark != 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_MARK, int(fwmark)); err != nil {
+			return 0, false, fmt.Errorf("failed to mark probe socket: %w", err)
+		}
+	}
+	if err := unix.Connect(fd, sa); err != nil {
+		return 0, false, fmt.Errorf("no route to %s: %w", ap, err)
+	}
+
+	// The link MTU, or what earlier ICMP taught the kernel about the path
+	initial, err := unix.GetsockoptInt(fd, level, mtuOpt)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read path MTU: %w", err)
+	}
+	mtu := initial
+	for round := 0; round < pmtuProbeRounds; round++ {
+		payload := make([]byte, mtu-ipHeader-8)
+		if _, err := unix.Write(fd, payload); err != nil && !errors.Is(err, unix.EMSGSIZE) {
+			return 0, false, fmt.Errorf("failed to send probe: %w", err)
+		}
+		time.Sleep(pmtuProbeWait)
+		next, err := unix.GetsockoptInt(fd, level, mtuOpt)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read path MTU: %w", err)
+		}
+		if next == mtu {
+			break
+		}
+		mtu = next
+	}
+	return mtu, mtu < initial, nil
+}
+
+// SetLinkMTU changes the MTU of a network interface.
+func SetLinkMTU(iface string, mtu int) error {
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return &RouteError{Op: "set MTU on", Target: iface, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package network
+
+import (
+	"errors"
+	"net/netip"
+)
+
+func probePathMTU(ap netip.AddrPort, fwmark uint32) (int, bool, error) {
+	return 0, false, errors.New("path MTU probing is only supported on Linux")
+}
+
+// SetLinkMTU changes the MTU of a network interface.
+func SetLinkMTU(iface string, mtu int) error {
+	return errors.New("changing the interface MTU is only supported on Linux")
+}
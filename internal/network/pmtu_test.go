@@ -0,0 +1,68 @@
+package network
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestTunnelMTU(t *testing.T) {
+	tests := []struct {
+		pathMTU int
+		ipv6    bool
+		want    int
+	}{
+		{1500, false, 1440},
+		{1500, true, 1420},
+		{1492, false, 1432}, // PPPoE
+		{1280, true, 1200},
+		{9000, false, 8940},
+		{600, true, minTunnelMTU},
+	}
+	for _, tt := range tests {
+		if got := TunnelMTU(tt.pathMTU, tt.ipv6); got != tt.want {
+			t.Errorf("TunnelMTU(%d, %v) = %d, want %d", tt.pathMTU, tt.ipv6, got, tt.want)
+		}
+	}
+}
+
+func TestProbedTunnelMTU(t *testing.T) {
+	tests := []struct {
+		pathMTU int
+		lowered bool
+		want    int
+	}{
+		{1500, false, DefaultTunnelMTU}, // only the link was seen
+		{9000, false, DefaultTunnelMTU},
+		{1400, false, 1340},
+		{1500, true, 1440}, // confirmed by ICMP
+		{1400, true, 1340},
+	}
+	for _, tt := range tests {
+		if got := probedTunnelMTU(tt.pathMTU, false, tt.lowered); got != tt.want {
+			t.Errorf("probedTunnelMTU(%d, lowered=%v) = %d, want %d", tt.pathMTU, tt.lowered, got, tt.want)
+		}
+	}
+}
+
+func TestProbeTunnelMTULoopback(t *testing.T) {
+	mtu, err := ProbeTunnelMTU("127.0.0.1:51820", 0)
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Error("ProbeTunnelMTU should be unsupported off Linux")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("ProbeTunnelMTU() error: %v", err)
+	}
+	// Loopback's large MTU is only the link's; nothing confirms it
+	if mtu != DefaultTunnelMTU {
+		t.Errorf("ProbeTunnelMTU(loopback) = %d, want %d", mtu, DefaultTunnelMTU)
+	}
+}
+
+func TestProbeTunnelMTUBadEndpoint(t *testing.T) {
+	if _, err := ProbeTunnelMTU("not-a-host.invalid:51820", 0); err == nil {
+		t.Error("ProbeTunnelMTU should fail for an unresolvable endpoint")
+	}
+}
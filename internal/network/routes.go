@@ -1,12 +1,81 @@
 package network
 
+import (
+	"fmt"
+	"net/netip"
+)
+
+// RoutingStrategy selects how tunnel routes are installed.
+type RoutingStrategy string
+
+const (
+	// RouteSplit adds /1 routes via the tunnel and pins the endpoint to the
+	// current default gateway.
+	RouteSplit RoutingStrategy = "split"
+	// RoutePolicy marks the tunnel's own sockets and sends all other traffic
+	// through a dedicated routing table, like wg-quick.
+	RoutePolicy RoutingStrategy = "policy"
+)
+
+// PolicyRoutingMark is the socket fwmark and routing table used by RoutePolicy.
+const PolicyRoutingMark = 51820
+
+// ParseRoutingStrategy validates a routing strategy. Empty means RouteSplit.
+func ParseRoutingStrategy(s string) (RoutingStrategy, error) {
+	switch RoutingStrategy(s) {
+	case "", RouteSplit:
+		return RouteSplit, nil
+	case RoutePolicy:
+		return RoutePolicy, nil
+	default:
+		return "", fmt.Errorf("invalid routing strategy %q (want %q or %q)", s, RouteSplit, RoutePolicy)
+	}
+}
+
+// RouteError describes a failed route, address or link operation. Err wraps
+// the kernel's syscall.Errno when one is known, so callers can test for
+// conditions such as errors.Is(err, syscall.EEXIST) or syscall.ENETUNREACH
+// with either the netlink or the iproute2 backend.
+type RouteError struct {
+	Op     string // e.g. "add route", "add address"
+	Target string // prefix, address or interface the operation applied to
+	Err    error
+}
+
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Target, e.Err)
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
 // RouteManager handles routing table configuration for the VPN tunnel.
 type RouteManager interface {
-	AddVPNRoutes(iface string, endpoint string, ipv6 bool) error
+	// AddVPNRoutes pins the endpoint to the current default gateway and routes
+	// each prefix through iface. Callers pass the result of SplitDefaultRoutes
+	// so that /0 entries never replace the system default route. The policy
+	// manager ignores endpoint and accepts /0 prefixes as-is.
+	AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error
 	RemoveVPNRoutes() error
+
+	// AddRoute routes a single prefix through iface.
+	AddRoute(prefix netip.Prefix, iface string) error
+	// AddBypassRoute routes a single prefix via the default gateway captured
+	// by AddVPNRoutes, keeping it outside the tunnel.
+	AddBypassRoute(prefix netip.Prefix) error
+	// DeleteRoute removes a route added by AddRoute or AddBypassRoute.
+	DeleteRoute(prefix netip.Prefix) error
 }
 
 // NewRouteManager returns a platform-appropriate route manager.
 func NewRouteManager() RouteManager {
 	return newRouteManager()
 }
+
+// NewPolicyRouteManager returns a route manager that implements RoutePolicy.
+// Packets carrying mark (the tunnel's own sockets) use the main table; all
+// others go through table mark, which holds the VPN routes.
+func NewPolicyRouteManager(mark uint32) (RouteManager, error) {
+	return newPolicyRouteManager(mark)
+}
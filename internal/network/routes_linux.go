@@ -5,24 +5,32 @@ package network
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 var validIfaceName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
+// unixRoutes is the iproute2 backend, used when netlink is unavailable.
 type unixRoutes struct {
 	addedRoutes []string
 	endpoint    string
 	defaultGW   string
 }
 
+// newRouteManager returns the netlink backend, or iproute2 where netlink
+// is unavailable.
 func newRouteManager() RouteManager {
+	if netlinkAvailable() {
+		return newNetlinkRoutes()
+	}
 	return &unixRoutes{}
 }
 
-func (r *unixRoutes) AddVPNRoutes(iface string, endpoint string, ipv6 bool) error {
+func (r *unixRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
 	// Validate inputs
 	if !validIfaceName.MatchString(iface) {
 		return fmt.Errorf("invalid interface name: %q", iface)
@@ -39,43 +47,28 @@ func (r *unixRoutes) AddVPNRoutes(iface string, endpoint string, ipv6 bool) erro
 	r.endpoint = endpoint
 
 	// Get current default gateway
-	out, err := exec.Command("ip", "route", "show", "default").Output()
+	gw, _, err := defaultRoute()
 	if err != nil {
 		return fmt.Errorf("failed to get default route: %w", err)
 	}
-
-	fields := strings.Fields(string(out))
-	if len(fields) >= 3 {
-		r.defaultGW = fields[2]
-	}
+	r.defaultGW = gw
 
 	// Route VPN endpoint via current default gateway
 	if r.defaultGW != "" {
-		cmd := exec.Command("ip", "route", "add", endpoint+"/32", "via", r.defaultGW)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add endpoint route: %w", err)
+		out, err := exec.Command("ip", "route", "add", endpoint+"/32", "via", r.defaultGW).CombinedOutput()
+		if err != nil {
+			return &RouteError{Op: "add endpoint route", Target: endpoint + "/32", Err: ipCommandError(out, err)}
 		}
 		r.addedRoutes = append(r.addedRoutes, endpoint+"/32")
 	}
 
-	// Add IPv4 split routes
-	for _, cidr := range []string{"0.0.0.0/1", "128.0.0.0/1"} {
-		cmd := exec.Command("ip", "route", "add", cidr, "dev", iface)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add route %s: %w", cidr, err)
-		}
-		r.addedRoutes = append(r.addedRoutes, cidr)
-	}
-
-	// Add IPv6 split routes to prevent IPv6 traffic leaking outside the tunnel
-	if ipv6 {
-		for _, cidr := range []string{"::/1", "8000::/1"} {
-			cmd := exec.Command("ip", "-6", "route", "add", cidr, "dev", iface)
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to add IPv6 route %s: %w", cidr, err)
-			}
-			r.addedRoutes = append(r.addedRoutes, "v6:"+cidr)
+	// Route each prefix through the tunnel interface
+	for _, prefix := range routes {
+		args := append(ipFamilyArgs(prefix), "route", "add", prefix.String(), "dev", iface)
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			return &RouteError{Op: "add route", Target: prefix.String(), Err: ipCommandError(out, err)}
 		}
+		r.addedRoutes = append(r.addedRoutes, routeKey(prefix))
 	}
 
 	return nil
@@ -98,3 +91,129 @@ func (r *unixRoutes) RemoveVPNRoutes() error {
 	r.addedRoutes = nil
 	return lastErr
 }
+
+func (r *unixRoutes) AddRoute(prefix netip.Prefix, iface string) error {
+	if !validIfaceName.MatchString(iface) {
+		return fmt.Errorf("invalid interface name: %q", iface)
+	}
+	args := append(ipFamilyArgs(prefix), "route", "add", prefix.String(), "dev", iface)
+	if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return &RouteError{Op: "add route", Target: prefix.String(), Err: ipCommandError(out, err)}
+	}
+	r.addedRoutes = append(r.addedRoutes, routeKey(prefix))
+	return nil
+}
+
+func (r *unixRoutes) AddBypassRoute(prefix netip.Prefix) error {
+	if prefix.Addr().Is6() {
+		return fmt.Errorf("bypass route %s: IPv6 bypass is not supported", prefix)
+	}
+	if r.defaultGW == "" {
+		return fmt.Errorf("bypass route %s: no default gateway known", prefix)
+	}
+	out, err := exec.Command("ip", "route", "add", prefix.String(), "via", r.defaultGW).CombinedOutput()
+	if err != nil {
+		return &RouteError{Op: "add bypass route", Target: prefix.String(), Err: ipCommandError(out, err)}
+	}
+	r.addedRoutes = append(r.addedRoutes, routeKey(prefix))
+	return nil
+}
+
+func (r *unixRoutes) DeleteRoute(prefix netip.Prefix) error {
+	key := routeKey(prefix)
+	for i, route := range r.addedRoutes {
+		if route != key {
+			continue
+		}
+		r.addedRoutes = append(r.addedRoutes[:i], r.addedRoutes[i+1:]...)
+		args := append(ipFamilyArgs(prefix), "route", "delete", prefix.String())
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			return &RouteError{Op: "delete route", Target: prefix.String(), Err: ipCommandError(out, err)}
+		}
+		return nil
+	}
+	return fmt.Errorf("route %s was not added by VoidVPN", prefix)
+}
+
+// defaultRoute returns the gateway and device of the IPv4 default route.
+// The gateway is empty for point-to-point default routes.
+func defaultRoute() (gw, dev string, err error) {
+	if netlinkAvailable() {
+		return defaultRouteNetlink()
+	}
+	return defaultRouteExec()
+}
+
+// defaultRouteExec is the iproute2 flavour of defaultRoute. It picks the
+// default route with the lowest metric.
+func defaultRouteExec() (gw, dev string, err error) {
+	out, err := exec.Command("ip", "route", "show", "default").Output()
+	if err != nil {
+		return "", "", err
+	}
+	gw, dev = parseDefaultRoutes(string(out))
+	return gw, dev, nil
+}
+
+// parseDefaultRoutes picks the lowest-metric route from `ip route show
+// default` output. Multipath routes contribute their first nexthop, which
+// iproute2 prints on the following indented lines.
+func parseDefaultRoutes(out string) (gw, dev string) {
+	bestMetric := -1
+	inDefault := false
+	var curGW, curDev string
+	var curMetric int
+	flush := func() {
+		if inDefault && curDev != "" && (bestMetric < 0 || curMetric < bestMetric) {
+			gw, dev, bestMetric = curGW, curDev, curMetric
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		if !indented {
+			flush()
+			inDefault = fields[0] == "default"
+			curGW, curDev, curMetric = "", "", 0
+		}
+		if !inDefault {
+			continue
+		}
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "via":
+				if curGW == "" {
+					curGW = fields[i+1]
+				}
+			case "dev":
+				if curDev == "" {
+					curDev = fields[i+1]
+				}
+			case "metric":
+				if m, err := strconv.Atoi(fields[i+1]); err == nil && !indented {
+					curMetric = m
+				}
+			}
+		}
+	}
+	flush()
+	return gw, dev
+}
+
+// routeKey returns the addedRoutes entry for a prefix ("v6:" marks IPv6).
+func routeKey(prefix netip.Prefix) string {
+	if prefix.Addr().Is6() {
+		return "v6:" + prefix.String()
+	}
+	return prefix.String()
+}
+
+func ipFamilyArgs(prefix netip.Prefix) []string {
+	if prefix.Addr().Is6() {
+		return []string{"-6"}
+	}
+	return nil
+}
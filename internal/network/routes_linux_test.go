@@ -3,7 +3,10 @@
 package network
 
 import (
+	"syscall"
 	"testing"
+
+	"github.com/vishvananda/netlink"
 )
 
 func TestValidIfaceName(t *testing.T) {
@@ -27,6 +30,44 @@ func TestValidIfaceName(t *testing.T) {
 	}
 }
 
+func TestPolicyRouteManagerRequiresMark(t *testing.T) {
+	if _, err := newPolicyRouteManager(0); err == nil {
+		t.Error("newPolicyRouteManager(0) should error")
+	}
+}
+
+func TestPolicyRoutesInvalidInterface(t *testing.T) {
+	r, err := newPolicyRouteManager(PolicyRoutingMark)
+	if err != nil {
+		t.Fatalf("newPolicyRouteManager() error: %v", err)
+	}
+	if err := r.AddVPNRoutes("bad iface!", "", nil); err == nil {
+		t.Error("AddVPNRoutes should error for invalid interface name")
+	}
+	if err := r.RemoveVPNRoutes(); err != nil {
+		t.Errorf("RemoveVPNRoutes() on empty should return nil, got %v", err)
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules := policyRules(family, PolicyRoutingMark)
+		if len(rules) != 2 {
+			t.Fatalf("policyRules() returned %d rules, want 2", len(rules))
+		}
+		tunnel, main := rules[0], rules[1]
+		if tunnel.Family != family || tunnel.Mark != PolicyRoutingMark || !tunnel.Invert || tunnel.Table != int(PolicyRoutingMark) {
+			t.Errorf("tunnel rule = %+v, want not fwmark %d table %d", tunnel, PolicyRoutingMark, PolicyRoutingMark)
+		}
+		if main.Family != family || main.Table != syscall.RT_TABLE_MAIN || main.SuppressPrefixlen != 0 || main.Mark != 0 || main.Invert {
+			t.Errorf("main rule = %+v, want table main suppress_prefixlength 0", main)
+		}
+		if tunnel.Priority != -1 || main.Priority != -1 {
+			t.Error("rules should leave the priority to the kernel, like ip rule add")
+		}
+	}
+}
+
 func TestRemoveVPNRoutesEmptyUnix(t *testing.T) {
 	r := &unixRoutes{}
 	err := r.RemoveVPNRoutes()
@@ -37,8 +78,31 @@ func TestRemoveVPNRoutesEmptyUnix(t *testing.T) {
 
 func TestAddVPNRoutesInvalidInterface(t *testing.T) {
 	r := &unixRoutes{}
-	err := r.AddVPNRoutes("bad iface!", "1.2.3.4", false)
+	err := r.AddVPNRoutes("bad iface!", "1.2.3.4", nil)
 	if err == nil {
 		t.Error("AddVPNRoutes should error for invalid interface name")
 	}
 }
+
+func TestParseDefaultRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		wantGW  string
+		wantDev string
+	}{
+		{"single", "default via 192.168.1.1 dev eth0 proto dhcp metric 100\n", "192.168.1.1", "eth0"},
+		{"lowest metric wins", "default via 192.168.1.1 dev wlan0 proto dhcp metric 600\ndefault via 10.0.0.1 dev eth0 proto dhcp metric 100\n", "10.0.0.1", "eth0"},
+		{"point to point", "default dev ppp0 scope link\n", "", "ppp0"},
+		{"multipath", "default proto static metric 50\n\tnexthop via 172.16.0.1 dev eth1 weight 1\n\tnexthop via 172.16.0.2 dev eth2 weight 1\n", "172.16.0.1", "eth1"},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw, dev := parseDefaultRoutes(tt.out)
+			if gw != tt.wantGW || dev != tt.wantDev {
+				t.Errorf("parseDefaultRoutes() = (%q, %q), want (%q, %q)", gw, dev, tt.wantGW, tt.wantDev)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// policyRoutes implements RoutePolicy the way wg-quick does: VPN routes live
+// in a dedicated table, consulted for every packet that does not carry the
+// tunnel's fwmark. Because the endpoint is never routed explicitly, roaming
+// endpoints and gateway changes keep working.
+//
+// Host routes from AddRoute/AddBypassRoute still go into the main table; the
+// suppress_prefixlength 0 rule lets them win over the tunnel table.
+//
+// policyRoutes is the iproute2 backend, used when netlink is unavailable.
+type policyRoutes struct {
+	unixRoutes
+	mark         uint32
+	undo         [][]string // commands that revert each applied step, in order
+	srcValidMark []byte     // original sysctl value, nil if untouched
+}
+
+func newPolicyRouteManager(mark uint32) (RouteManager, error) {
+	if mark == 0 {
+		return nil, fmt.Errorf("policy routing requires a non-zero fwmark")
+	}
+	if netlinkAvailable() {
+		return &netlinkPolicyRoutes{mark: mark}, nil
+	}
+	return &policyRoutes{mark: mark}, nil
+}
+
+func (r *policyRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
+	if !validIfaceName.MatchString(iface) {
+		return fmt.Errorf("invalid interface name: %q", iface)
+	}
+
+	// Remember the gateway for bypass routes; the endpoint itself needs no route.
+	gw, _, err := defaultRoute()
+	if err != nil {
+		return fmt.Errorf("failed to get default route: %w", err)
+	}
+	r.defaultGW = gw
+
+	table := strconv.FormatUint(uint64(r.mark), 10)
+	var families [][]string
+	seen := make(map[bool]bool)
+	for _, prefix := range routes {
+		family := ipFamilyArgs(prefix)
+		if !seen[prefix.Addr().Is6()] {
+			seen[prefix.Addr().Is6()] = true
+			families = append(families, family)
+			r.undo = append(r.undo, append(append([]string{"ip"}, family...), "route", "flush", "table", table))
+		}
+		args := append(append([]string{"ip"}, family...), "route", "add", prefix.String(), "dev", iface, "table", table)
+		if err := r.run(args); err != nil {
+			return fmt.Errorf("failed to add route %s: %w", prefix, err)
+		}
+	}
+
+	mark := strconv.FormatUint(uint64(r.mark), 10)
+	for _, family := range families {
+		if err := r.addRule(family, "not", "fwmark", mark, "table", table); err != nil {
+			return err
+		}
+		if err := r.addRule(family, "table", "main", "suppress_prefixlength", "0"); err != nil {
+			return err
+		}
+	}
+
+	// Replies to marked packets must pass reverse-path filtering
+	if seen[false] {
+		r.srcValidMark = enableSrcValidMark()
+	}
+	return nil
+}
+
+func (r *policyRoutes) RemoveVPNRoutes() error {
+	lastErr := r.unixRoutes.RemoveVPNRoutes()
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		if err := r.run(r.undo[i]); err != nil {
+			lastErr = err
+		}
+	}
+	r.undo = nil
+
+	if err := restoreSrcValidMark(r.srcValidMark); err != nil {
+		lastErr = err
+	}
+	r.srcValidMark = nil
+	return lastErr
+}
+
+func (r *policyRoutes) addRule(family []string, selector ...string) error {
+	add := append(append(append([]string{"ip"}, family...), "rule", "add"), selector...)
+	if err := r.run(add); err != nil {
+		return fmt.Errorf("failed to add routing rule: %w", err)
+	}
+	r.undo = append(r.undo, append(append(append([]string{"ip"}, family...), "rule", "del"), selector...))
+	return nil
+}
+
+func (r *policyRoutes) run(args []string) error {
+	if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s: %w", strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// netlinkPolicyRoutes is policyRoutes over rtnetlink, so policy routing
+// works on minimal systems without iproute2.
+type netlinkPolicyRoutes struct {
+	netlinkRoutes
+	mark         uint32
+	tableRoutes  []netlink.Route
+	rules        []*netlink.Rule
+	srcValidMark []byte // original sysctl value, nil if untouched
+}
+
+func (r *netlinkPolicyRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
+	link, err := lookupLink(iface)
+	if err != nil {
+		return err
+	}
+
+	// Remember the gateway for bypass routes; the endpoint itself needs no route.
+	gw, gwLink, err := netlinkDefaultRoute()
+	if err != nil {
+		return &RouteError{Op: "read default route", Target: "IPv4", Err: err}
+	}
+	r.defaultGW, r.gwLink = gw, gwLink
+
+	var families []int
+	seen := make(map[int]bool)
+	for _, prefix := range routes {
+		family := netlink.FAMILY_V4
+		if prefix.Addr().Is6() {
+			family = netlink.FAMILY_V6
+		}
+		if !seen[family] {
+			seen[family] = true
+			families = append(families, family)
+		}
+		route := netlink.Route{Dst: prefixToIPNet(prefix), LinkIndex: link.Attrs().Index, Scope: netlink.SCOPE_LINK, Table: int(r.mark)}
+		if err := netlink.RouteAdd(&route); err != nil {
+			return &RouteError{Op: "add route", Target: prefix.String(), Err: err}
+		}
+		r.tableRoutes = append(r.tableRoutes, route)
+	}
+
+	for _, family := range families {
+		for _, rule := range policyRules(family, r.mark) {
+			if err := netlink.RuleAdd(rule); err != nil {
+				return &RouteError{Op: "add routing rule", Target: fmt.Sprintf("table %d", rule.Table), Err: err}
+			}
+			r.rules = append(r.rules, rule)
+		}
+	}
+
+	// Replies to marked packets must pass reverse-path filtering
+	if seen[netlink.FAMILY_V4] {
+		r.srcValidMark = enableSrcValidMark()
+	}
+	return nil
+}
+
+func (r *netlinkPolicyRoutes) RemoveVPNRoutes() error {
+	lastErr := r.netlinkRoutes.RemoveVPNRoutes()
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		if err := netlink.RuleDel(r.rules[i]); err != nil {
+			lastErr = &RouteError{Op: "delete routing rule", Target: fmt.Sprintf("table %d", r.rules[i].Table), Err: err}
+		}
+	}
+	r.rules = nil
+	for i := len(r.tableRoutes) - 1; i >= 0; i-- {
+		route := r.tableRoutes[i]
+		if err := netlink.RouteDel(&route); err != nil {
+			lastErr = &RouteError{Op: "delete route", Target: route.Dst.String(), Err: err}
+		}
+	}
+	r.tableRoutes = nil
+
+	if err := restoreSrcValidMark(r.srcValidMark); err != nil {
+		lastErr = err
+	}
+	r.srcValidMark = nil
+	return lastErr
+}
+
+// policyRules returns the rules of wg-quick style policy routing for one
+// address family: `not fwmark <mark> table <mark>`, then `table main
+// suppress_prefixlength 0`.
+func policyRules(family int, mark uint32) []*netlink.Rule {
+	tunnel := netlink.NewRule()
+	tunnel.Family = family
+	tunnel.Mark = mark
+	tunnel.Invert = true
+	tunnel.Table = int(mark)
+
+	main := netlink.NewRule()
+	main.Family = family
+	main.Table = syscall.RT_TABLE_MAIN
+	main.SuppressPrefixlen = 0
+	return []*netlink.Rule{tunnel, main}
+}
+
+// enableSrcValidMark turns on src_valid_mark and returns the value it
+// replaced, or nil if it was already on or could not be changed.
+func enableSrcValidMark() []byte {
+	orig, err := os.ReadFile(srcValidMarkPath)
+	if err != nil || strings.TrimSpace(string(orig)) == "1" {
+		return nil
+	}
+	if err := os.WriteFile(srcValidMarkPath, []byte("1"), 0644); err != nil {
+		return nil
+	}
+	return orig
+}
+
+// restoreSrcValidMark puts back a value returned by enableSrcValidMark.
+func restoreSrcValidMark(orig []byte) error {
+	if orig == nil {
+		return nil
+	}
+	return os.WriteFile(srcValidMarkPath, orig, 0644)
+}
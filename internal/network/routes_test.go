@@ -0,0 +1,22 @@
+package network
+
+import "testing"
+
+func TestParseRoutingStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RoutingStrategy
+		wantErr bool
+	}{
+		{"", RouteSplit, false},
+		{"split", RouteSplit, false},
+		{"policy", RoutePolicy, false},
+		{"fwmark", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoutingStrategy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRoutingStrategy(%q) = %q, %v; want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
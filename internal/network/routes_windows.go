@@ -5,6 +5,7 @@ package network
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"os/exec"
 	"strings"
 )
@@ -14,6 +15,8 @@ type windowsRoutes struct {
 	endpointRoute *gatewayRoute
 	// VPN split routes go via the TUN interface directly (on-link)
 	ifaceRoutes []ifaceRoute
+	// bypass routes keep selected prefixes on the physical default gateway
+	bypassRoutes []gatewayRoute
 }
 
 type gatewayRoute struct {
@@ -31,7 +34,11 @@ func newRouteManager() RouteManager {
 	return &windowsRoutes{}
 }
 
-func (r *windowsRoutes) AddVPNRoutes(iface string, endpoint string, ipv6 bool) error {
+func newPolicyRouteManager(mark uint32) (RouteManager, error) {
+	return nil, fmt.Errorf("policy routing is not supported on Windows")
+}
+
+func (r *windowsRoutes) AddVPNRoutes(iface string, endpoint string, routes []netip.Prefix) error {
 	// Get current default gateway for endpoint-specific route
 	defaultGW, err := getDefaultGateway()
 	if err != nil {
@@ -54,24 +61,18 @@ func (r *windowsRoutes) AddVPNRoutes(iface string, endpoint string, ipv6 bool) e
 	}
 	r.endpointRoute = &gatewayRoute{endpoint, "255.255.255.255", defaultGW}
 
-	// Add IPv4 split routes (0.0.0.0/1 + 128.0.0.0/1) via TUN interface directly.
+	// Route each prefix via the TUN interface directly.
 	// Uses on-link routing — no gateway needed, works with /32 tunnel addresses.
-	for _, prefix := range []string{"0.0.0.0/1", "128.0.0.0/1"} {
-		if err := addInterfaceRoute(prefix, iface); err != nil {
-			return fmt.Errorf("failed to add route %s: %w", prefix, err)
-		}
-		r.ifaceRoutes = append(r.ifaceRoutes, ifaceRoute{prefix, iface})
-	}
-
-	// Add IPv6 split routes (::/1 + 8000::/1) to prevent IPv6 traffic leaking
-	// outside the tunnel when AllowedIPs includes ::/0.
-	if ipv6 {
-		for _, prefix := range []string{"::/1", "8000::/1"} {
+	for _, p := range routes {
+		prefix := p.String()
+		if p.Addr().Is6() {
 			if err := addInterfaceRouteV6(prefix, iface); err != nil {
 				return fmt.Errorf("failed to add IPv6 route %s: %w", prefix, err)
 			}
-			r.ifaceRoutes = append(r.ifaceRoutes, ifaceRoute{prefix, iface})
+		} else if err := addInterfaceRoute(prefix, iface); err != nil {
+			return fmt.Errorf("failed to add route %s: %w", prefix, err)
 		}
+		r.ifaceRoutes = append(r.ifaceRoutes, ifaceRoute{prefix, iface})
 	}
 
 	return nil
@@ -95,6 +96,13 @@ func (r *windowsRoutes) RemoveVPNRoutes() error {
 	}
 	r.ifaceRoutes = nil
 
+	for _, rt := range r.bypassRoutes {
+		if err := deleteGatewayRoute(rt.network, rt.mask, rt.gateway); err != nil {
+			lastErr = err
+		}
+	}
+	r.bypassRoutes = nil
+
 	// Remove endpoint route
 	if r.endpointRoute != nil {
 		rt := r.endpointRoute
@@ -107,6 +115,57 @@ func (r *windowsRoutes) RemoveVPNRoutes() error {
 	return lastErr
 }
 
+func (r *windowsRoutes) AddRoute(prefix netip.Prefix, iface string) error {
+	p := prefix.String()
+	if prefix.Addr().Is6() {
+		if err := addInterfaceRouteV6(p, iface); err != nil {
+			return err
+		}
+	} else if err := addInterfaceRoute(p, iface); err != nil {
+		return err
+	}
+	r.ifaceRoutes = append(r.ifaceRoutes, ifaceRoute{p, iface})
+	return nil
+}
+
+func (r *windowsRoutes) AddBypassRoute(prefix netip.Prefix) error {
+	if prefix.Addr().Is6() {
+		return fmt.Errorf("bypass route %s: IPv6 bypass is not supported", prefix)
+	}
+	if r.endpointRoute == nil {
+		return fmt.Errorf("bypass route %s: no default gateway known", prefix)
+	}
+	rt := gatewayRoute{prefix.Addr().String(), prefixToMask(prefix.Bits()), r.endpointRoute.gateway}
+	if err := addGatewayRoute(rt.network, rt.mask, rt.gateway); err != nil {
+		return err
+	}
+	r.bypassRoutes = append(r.bypassRoutes, rt)
+	return nil
+}
+
+func (r *windowsRoutes) DeleteRoute(prefix netip.Prefix) error {
+	p := prefix.String()
+	for i, rt := range r.ifaceRoutes {
+		if rt.prefix != p {
+			continue
+		}
+		r.ifaceRoutes = append(r.ifaceRoutes[:i], r.ifaceRoutes[i+1:]...)
+		if prefix.Addr().Is6() {
+			return deleteInterfaceRouteV6(rt.prefix, rt.iface)
+		}
+		return deleteInterfaceRoute(rt.prefix, rt.iface)
+	}
+	network, mask := prefix.Addr().String(), prefixToMask(prefix.Bits())
+	for i, rt := range r.bypassRoutes {
+		if rt.network != network || rt.mask != mask {
+			continue
+		}
+		r.bypassRoutes = append(r.bypassRoutes[:i], r.bypassRoutes[i+1:]...)
+		return deleteGatewayRoute(rt.network, rt.mask, rt.gateway)
+	}
+	return fmt.Errorf("route %s was not added by VoidVPN", prefix)
+}
+
 func addGatewayRoute(network, mask, gateway string) error {
 	if net.ParseIP(network) == nil {
 		return fmt.Errorf("invalid network address: %q", network)
@@ -2,13 +2,19 @@ package openvpn
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/voidvpn/voidvpn/internal/config"
 )
 
+// defaultServerPollTimeout is how long OpenVPN tries a remote by default.
+const defaultServerPollTimeout = 120 * time.Second
+
 // DetectOpenVPN searches for the openvpn binary on the system.
 func DetectOpenVPN() (string, error) {
 	// Check PATH first
@@ -41,8 +47,58 @@ func DetectOpenVPN() (string, error) {
 	return "", fmt.Errorf("openvpn binary not found. Install OpenVPN and ensure it is in your PATH")
 }
 
-// BuildOVPNConfig generates .ovpn file content from a ServerConfig.
-func BuildOVPNConfig(cfg *config.ServerConfig, mgmtPort int) string {
+// BuildOVPNConfig generates .ovpn file content from a ServerConfig, with
+// all keys and certificates inline.
+func BuildOVPNConfig(cfg *config.ServerConfig, mgmtPort int) (string, error) {
+	return buildOVPNConfig(cfg, tcpManagement(mgmtPort, ""), nil)
+}
+
+// managementEndpoint is where OpenVPN's management interface listens.
+type managementEndpoint struct {
+	network string // "unix", or "tcp" where OpenVPN has no Unix sockets
+	addr    string // socket path, or host:port
+	pwFile  string // file with the password TCP clients must give
+}
+
+// unixManagement is a management socket at path.
+func unixManagement(path string) managementEndpoint {
+	return managementEndpoint{network: "unix", addr: path}
+}
+
+// tcpManagement is a management port on the loopback address, protected by
+// the password in pwFile unless it is empty.
+func tcpManagement(port int, pwFile string) managementEndpoint {
+	return managementEndpoint{network: "tcp", addr: fmt.Sprintf("127.0.0.1:%d", port), pwFile: pwFile}
+}
+
+// directive returns the management directive that makes OpenVPN listen on e.
+func (e managementEndpoint) directive(quote func(string) string) string {
+	if e.network == "unix" {
+		return fmt.Sprintf("management %s unix", quote(e.addr))
+	}
+	host, port, _ := net.SplitHostPort(e.addr)
+	if e.pwFile != "" {
+		return fmt.Sprintf("management %s %s %s", host, port, quote(e.pwFile))
+	}
+	return fmt.Sprintf("management %s %s", host, port)
+}
+
+// buildOVPNConfig is BuildOVPNConfig with the key material named in
+// keyFiles, by config block ("key", "tls-auth", ...), referenced by path.
+func buildOVPNConfig(cfg *config.ServerConfig, mgmt managementEndpoint, keyFiles map[string]string) (string, error) {
+	// Server files can be edited by hand, so nothing read from them may
+	// start a line of its own
+	if err := checkOVPNValues(cfg, keyFiles); err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(mgmt.addr+mgmt.pwFile, "\r\n") {
+		return "", fmt.Errorf("invalid management path %q: line breaks are not allowed", mgmt.addr)
+	}
+	quote := func(arg string) string {
+		quoted, _ := config.QuoteOVPNArg(arg) // line breaks checked above
+		return quoted
+	}
+
 	var sb strings.Builder
 
 	sb.WriteString("client\n")
@@ -60,48 +116,201 @@ func BuildOVPNConfig(cfg *config.ServerConfig, mgmtPort int) string {
 	}
 	sb.WriteString(fmt.Sprintf("proto %s\n", proto))
 
-	// Parse host:port from endpoint
-	host, port := parseEndpoint(cfg.Endpoint)
-	sb.WriteString(fmt.Sprintf("remote %s %s\n", host, port))
+	// Remotes are tried in order; the endpoint is the only one without a list
+	if len(cfg.Remotes) == 0 {
+		host, port := parseEndpoint(cfg.Endpoint)
+		sb.WriteString(fmt.Sprintf("remote %s %s\n", host, port))
+	}
+	for _, r := range cfg.Remotes {
+		line := fmt.Sprintf("remote %s %d", r.Host, r.Port)
+		if r.Proto != "" {
+			line += " " + r.Proto
+		}
+		sb.WriteString(line + "\n")
+	}
+	if cfg.RemoteRandom {
+		sb.WriteString("remote-random\n")
+	}
+	if cfg.ServerPollTimeout > 0 {
+		sb.WriteString(fmt.Sprintf("server-poll-timeout %d\n", cfg.ServerPollTimeout))
+	}
 	sb.WriteString("resolv-retry infinite\n")
 
 	if cfg.Cipher != "" {
 		sb.WriteString(fmt.Sprintf("cipher %s\n", cfg.Cipher))
 	}
+	if cfg.DataCiphers != "" {
+		sb.WriteString(fmt.Sprintf("data-ciphers %s\n", cfg.DataCiphers))
+	}
 	if cfg.Auth != "" {
 		sb.WriteString(fmt.Sprintf("auth %s\n", cfg.Auth))
 	}
 	if cfg.CompLZO {
 		sb.WriteString("comp-lzo\n")
 	}
+	if cfg.RemoteCertTLS != "" {
+		sb.WriteString(fmt.Sprintf("remote-cert-tls %s\n", cfg.RemoteCertTLS))
+	}
+	if cfg.VerifyX509Name != "" {
+		line := "verify-x509-name " + quote(cfg.VerifyX509Name)
+		if cfg.VerifyX509Type != "" {
+			line += " " + cfg.VerifyX509Type
+		}
+		sb.WriteString(line + "\n")
+	}
+	if cfg.TunMTU > 0 {
+		sb.WriteString(fmt.Sprintf("tun-mtu %d\n", cfg.TunMTU))
+	}
+
+	if cfg.RouteNoPull {
+		sb.WriteString("route-nopull\n")
+	}
+	for _, route := range cfg.Routes {
+		sb.WriteString(fmt.Sprintf("route %s\n", route))
+	}
+	if cfg.RedirectGateway {
+		sb.WriteString(strings.TrimSpace("redirect-gateway "+strings.Join(cfg.RedirectGatewayFlags, " ")) + "\n")
+	}
+
+	// Directives kept from an imported profile. The check is repeated here
+	// because server files can be edited by hand.
+	for _, line := range cfg.ExtraDirectives {
+		if !config.IsSafeOVPNDirective(line) {
+			slog.Warn("skipping unsupported OpenVPN directive", "directive", line)
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
 
 	sb.WriteString("verb 3\n")
-	sb.WriteString(fmt.Sprintf("management 127.0.0.1 %d\n", mgmtPort))
+	sb.WriteString(mgmt.directive(quote) + "\n")
+	// Wait for the management client so no state change is missed
+	sb.WriteString("management-hold\n")
+	// Let the management client see which remote is tried
+	sb.WriteString("management-query-remote\n")
 
-	// Inline certificate blocks
-	if cfg.CACert != "" {
-		sb.WriteString("<ca>\n")
-		sb.WriteString(cfg.CACert)
-		sb.WriteString("\n</ca>\n")
+	// Credentials are answered over the management interface so they never
+	// touch the disk.
+	if NeedsCredentials(cfg) || NeedsKeyPassphrase(cfg) {
+		sb.WriteString("management-query-passwords\n")
 	}
-	if cfg.ClientCert != "" {
-		sb.WriteString("<cert>\n")
-		sb.WriteString(cfg.ClientCert)
-		sb.WriteString("\n</cert>\n")
+	if NeedsCredentials(cfg) {
+		sb.WriteString("auth-user-pass\n")
+		// Ask again instead of exiting after a dynamic challenge
+		sb.WriteString("auth-retry interact\n")
+		if cfg.StaticChallenge != "" {
+			echo := "0"
+			if cfg.StaticChallengeEcho {
+				echo = "1"
+			}
+			sb.WriteString(fmt.Sprintf("static-challenge %s %s\n", quote(cfg.StaticChallenge), echo))
+		}
 	}
-	if cfg.ClientKey != "" {
-		sb.WriteString("<key>\n")
-		sb.WriteString(cfg.ClientKey)
-		sb.WriteString("\n</key>\n")
+
+	// Certificates are inlined, and so is key material unless it was
+	// written to a file of its own
+	block := func(tag, content string) {
+		if content == "" {
+			return
+		}
+		if path := keyFiles[tag]; path != "" {
+			sb.WriteString(fmt.Sprintf("%s %s\n", tag, quote(path)))
+			return
+		}
+		sb.WriteString("<" + tag + ">\n")
+		sb.WriteString(content)
+		sb.WriteString("\n</" + tag + ">\n")
 	}
+	block("ca", cfg.CACert)
+	block("cert", cfg.ClientCert)
+	block("key", cfg.ClientKey)
 	if cfg.TLSAuth != "" {
-		sb.WriteString("key-direction 1\n")
-		sb.WriteString("<tls-auth>\n")
-		sb.WriteString(cfg.TLSAuth)
-		sb.WriteString("\n</tls-auth>\n")
+		keyDirection := cfg.KeyDirection
+		if keyDirection == "" {
+			keyDirection = "1"
+		}
+		sb.WriteString(fmt.Sprintf("key-direction %s\n", keyDirection))
+		block("tls-auth", cfg.TLSAuth)
+	}
+	block("tls-crypt", cfg.TLSCrypt)
+	block("tls-crypt-v2", cfg.TLSCryptV2)
+
+	return sb.String(), nil
+}
+
+// checkOVPNValues rejects server settings that would break out of the line
+// or block they are written to, adding directives to the config.
+func checkOVPNValues(cfg *config.ServerConfig, keyFiles map[string]string) error {
+	type value struct{ name, value string }
+	values := []value{
+		{"proto", cfg.Proto},
+		{"endpoint", cfg.Endpoint},
+		{"cipher", cfg.Cipher},
+		{"data-ciphers", cfg.DataCiphers},
+		{"auth", cfg.Auth},
+		{"remote-cert-tls", cfg.RemoteCertTLS},
+		{"verify-x509-name", cfg.VerifyX509Name},
+		{"verify-x509-name", cfg.VerifyX509Type},
+		{"key-direction", cfg.KeyDirection},
+		{"static-challenge", cfg.StaticChallenge},
+	}
+	for _, r := range cfg.Remotes {
+		values = append(values, value{"remote", r.Host}, value{"remote", r.Proto})
+	}
+	for _, route := range cfg.Routes {
+		values = append(values, value{"route", route})
 	}
+	for _, flag := range cfg.RedirectGatewayFlags {
+		values = append(values, value{"redirect-gateway", flag})
+	}
+	for tag, path := range keyFiles {
+		values = append(values, value{tag, path})
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v.value, "\r\n") {
+			return fmt.Errorf("invalid %s setting %q: line breaks are not allowed", v.name, v.value)
+		}
+	}
+
+	for _, b := range []struct{ tag, content string }{
+		{"ca", cfg.CACert},
+		{"cert", cfg.ClientCert},
+		{"key", cfg.ClientKey},
+		{"tls-auth", cfg.TLSAuth},
+		{"tls-crypt", cfg.TLSCrypt},
+		{"tls-crypt-v2", cfg.TLSCryptV2},
+	} {
+		if strings.Contains(b.content, "</"+b.tag+">") {
+			return fmt.Errorf("invalid %s setting: it closes its own block", b.tag)
+		}
+	}
+	return nil
+}
+
+// ConnectTimeout returns how long to wait for a server to connect. Profiles
+// with several remotes get time to try each of them.
+func ConnectTimeout(cfg *config.ServerConfig) time.Duration {
+	timeout := 60 * time.Second
+	poll := time.Duration(cfg.ServerPollTimeout) * time.Second
+	if poll == 0 {
+		poll = defaultServerPollTimeout
+	}
+	if failover := time.Duration(len(cfg.Remotes))*poll + 10*time.Second; failover > timeout {
+		timeout = failover
+	}
+	return timeout
+}
+
+// NeedsCredentials reports whether the server authenticates with a username
+// and password.
+func NeedsCredentials(cfg *config.ServerConfig) bool {
+	return cfg.AuthUserPass || cfg.Username != ""
+}
 
-	return sb.String()
+// NeedsKeyPassphrase reports whether the client key is encrypted, so
+// OpenVPN asks for its passphrase.
+func NeedsKeyPassphrase(cfg *config.ServerConfig) bool {
+	return config.IsEncryptedKey(cfg.ClientKey)
 }
 
 func parseEndpoint(endpoint string) (host, port string) {
@@ -2,11 +2,26 @@ package openvpn
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+const (
+	// bytecountInterval is how often OpenVPN reports traffic, in seconds.
+	bytecountInterval = 2
+	// mgmtCommandTimeout bounds each management command round trip.
+	mgmtCommandTimeout = 3 * time.Second
 )
 
 // TrafficStats holds bytes transferred through the tunnel.
@@ -15,85 +30,737 @@ type TrafficStats struct {
 	RxBytes int64
 }
 
-// ManagementClient communicates with the OpenVPN management interface.
+// Session describes the tunnel as OpenVPN reported it once connected.
+type Session struct {
+	Device     string // tun/tap device, e.g. tun0 or utun3
+	LocalIP    string // pushed IPv4 tunnel address
+	LocalIPv6  string // pushed IPv6 tunnel address, if any
+	RemoteIP   string // address of the server
+	RemotePort string
+	Remote     string   // host:port of the remote in use, from >REMOTE
+	DNS        []string // pushed dhcp-option DNS and DNS6 servers
+	Domains    []string // pushed dhcp-option DOMAIN and DOMAIN-SEARCH
+
+	pushDone bool // the last PUSH_REPLY was complete; the next one starts over
+}
+
+// Addresses returns the tunnel addresses in server config form, IPv4 first.
+func (s Session) Addresses() string {
+	var addrs []string
+	for _, a := range []string{s.LocalIP, s.LocalIPv6} {
+		if a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// deviceOpened matches the log line each platform writes when OpenVPN opens
+// its tun/tap device.
+var deviceOpened = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:TUN/TAP|DCO) device (\S+) opened`),
+	regexp.MustCompile(`^Opened utun device (\S+)`),
+	regexp.MustCompile(`device \[([^\]]+)\] opened`),
+}
+
+// pushReplyPrefix starts the log line carrying the options the server pushed.
+const pushReplyPrefix = "PUSH: Received control message: 'PUSH_REPLY,"
+
+// notePush records the DNS options of a PUSH_REPLY. Long replies are split
+// into several messages, all but the last marked with push-continuation 2.
+func (s *Session) notePush(reply string) {
+	if s.pushDone {
+		s.DNS, s.Domains = nil, nil
+	}
+	s.pushDone = true
+	for _, opt := range strings.Split(reply, ",") {
+		fields := strings.Fields(opt)
+		switch {
+		case len(fields) == 2 && fields[0] == "push-continuation" && fields[1] == "2":
+			s.pushDone = false
+		case len(fields) == 3 && fields[0] == "dhcp-option":
+			switch fields[1] {
+			case "DNS", "DNS6":
+				s.DNS = append(s.DNS, fields[2])
+			case "DOMAIN", "DOMAIN-SEARCH":
+				s.Domains = append(s.Domains, fields[2])
+			}
+		}
+	}
+}
+
+// Credentials answer OpenVPN's username/password query.
+type Credentials struct {
+	Username string
+	Password string
+
+	// Challenge answers static and dynamic (CRV1) challenges such as
+	// one-time passwords. Servers that send one fail without it.
+	Challenge ChallengeFunc
+
+	// KeyPassphrase unlocks an encrypted client key ("Private Key" query).
+	KeyPassphrase string
+}
+
+// ChallengeFunc asks the user to answer an authentication challenge. echo
+// reports whether the answer may be shown while it is typed.
+type ChallengeFunc func(prompt string, echo bool) (string, error)
+
+var (
+	// ErrAuthFailed is returned when OpenVPN rejects the credentials.
+	ErrAuthFailed = errors.New("authentication failed: check the username and password")
+	// ErrChallengeFailed is returned when OpenVPN rejects credentials that
+	// were sent together with a challenge response.
+	ErrChallengeFailed = errors.New("authentication failed: check the password and the challenge response")
+	// ErrKeyPassphrase is returned when OpenVPN cannot decrypt the client
+	// key with the passphrase.
+	ErrKeyPassphrase = errors.New("wrong passphrase for the client private key")
+)
+
+// challenge is a static or dynamic challenge from the server.
+type challenge struct {
+	prompt string
+	echo   bool
+	concat bool   // static: append the response to the password (SC flag 2)
+	state  string // dynamic: the CRV1 state ID to answer with
+	user   string // dynamic: the username to answer with
+}
+
+// parseStaticChallenge reads the "SC:flags,text" suffix of a password query,
+// set by static-challenge in the config.
+func parseStaticChallenge(query string) *challenge {
+	_, sc, ok := strings.Cut(query, " SC:")
+	if !ok {
+		return nil
+	}
+	flags, text, _ := strings.Cut(sc, ",")
+	n, _ := strconv.Atoi(flags)
+	return &challenge{prompt: text, echo: n&1 != 0, concat: n&2 != 0}
+}
+
+// parseDynamicChallenge reads the CRV1 challenge a server sends with a failed
+// verification: ['CRV1:flags:state ID:base64 username:text'].
+func parseDynamicChallenge(failure string) *challenge {
+	i := strings.Index(failure, "['CRV1:")
+	if i < 0 {
+		return nil
+	}
+	crv1 := strings.TrimSuffix(failure[i+len("['CRV1:"):], "']")
+	fields := strings.SplitN(crv1, ":", 4)
+	if len(fields) != 4 {
+		return nil
+	}
+	user, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return nil
+	}
+	return &challenge{
+		prompt: fields[3],
+		echo:   strings.Contains(fields[0], "E"),
+		state:  fields[1],
+		user:   string(user),
+	}
+}
+
+// ManagementClient keeps a connection to the OpenVPN management interface
+// open. Command responses are matched to the command waiting for them;
+// real-time notifications (>STATE, >BYTECOUNT, >LOG, >HOLD, >FATAL,
+// >PASSWORD, >REMOTE) update the client's view of the tunnel and are published as
+// events.
 type ManagementClient struct {
-	addr string
+	network  string // "tcp" or "unix"
+	addr     string
+	password string // answers the password prompt of a protected TCP port
+
+	cmdMu sync.Mutex // one command in flight at a time
+
+	mu      sync.Mutex // guards the fields below
+	conn    net.Conn
+	replies chan string // response lines for the current connection
+	creds   *Credentials
+	dynamic *challenge // CRV1 challenge to answer on the next password query
+	replied bool       // the last credentials included a challenge response
+	ready   bool       // subscribed; later holds are released by the reader
+	state   string
+	session Session
+	stats   TrafficStats
+	err     error
+
+	events        chan tunnel.Event
+	connected     chan struct{} // closed on the first CONNECTED state
+	done          chan struct{} // closed when the session ends, see Err
+	connectedOnce sync.Once
+	doneOnce      sync.Once
+
+	// initialized is closed on the first state past startup
+	initialized     chan struct{}
+	initializedOnce sync.Once
 }
 
 // NewManagementClient creates a client for the given management address.
 func NewManagementClient(port int) *ManagementClient {
 	return &ManagementClient{
-		addr: fmt.Sprintf("127.0.0.1:%d", port),
+		network:   "tcp",
+		addr:      fmt.Sprintf("127.0.0.1:%d", port),
+		events:    make(chan tunnel.Event, 64),
+		connected: make(chan struct{}),
+		done:      make(chan struct{}),
+
+		initialized: make(chan struct{}),
 	}
 }
 
+// setEndpoint points the client at e, logging in with password if e is a
+// protected TCP port. It must be called before Start.
+func (m *ManagementClient) setEndpoint(e managementEndpoint, password string) {
+	m.network, m.addr, m.password = e.network, e.addr, password
+}
+
+// Start connects to the management interface, retrying while OpenVPN is
+// still starting up. It subscribes to state, log and traffic notifications
+// and then releases the management-hold OpenVPN starts in. creds, if not
+// nil, answer the "Auth" and "Private Key" password queries.
+func (m *ManagementClient) Start(ctx context.Context, creds *Credentials) error {
+	if creds != nil && strings.ContainsAny(creds.Username+creds.Password+creds.KeyPassphrase, "\r\n") {
+		return fmt.Errorf("credentials must not contain line breaks")
+	}
+	conn, err := m.dialWait(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.creds = creds
+	m.mu.Unlock()
+	m.attach(conn)
+
+	for _, cmd := range []string{"state on", "log on", fmt.Sprintf("bytecount %d", bytecountInterval), "hold release"} {
+		if _, err := m.command(cmd, false); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	m.ready = true
+	m.mu.Unlock()
+	return nil
+}
+
+// Events returns real-time notifications from OpenVPN. Events are dropped
+// when the channel is full.
+func (m *ManagementClient) Events() <-chan tunnel.Event {
+	return m.events
+}
+
+// Connected is closed once OpenVPN reports the CONNECTED state.
+func (m *ManagementClient) Connected() <-chan struct{} {
+	return m.connected
+}
+
+// Initialized is closed once OpenVPN reports a state past startup, such as
+// RESOLVE or WAIT. By then it has read its config and keys.
+func (m *ManagementClient) Initialized() <-chan struct{} {
+	return m.initialized
+}
+
+// Done is closed when the session ends: OpenVPN reported a fatal error,
+// rejected the credentials, or the management connection was lost.
+func (m *ManagementClient) Done() <-chan struct{} {
+	return m.done
+}
+
+// Session returns what OpenVPN reported about the tunnel. The addresses are
+// set once it has connected and follow later reconnects.
+func (m *ManagementClient) Session() Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session := m.session
+	session.DNS = slices.Clone(session.DNS)
+	session.Domains = slices.Clone(session.Domains)
+	return session
+}
+
+// Err returns why the session ended, once Done is closed.
+func (m *ManagementClient) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// State returns the last state OpenVPN reported, such as "CONNECTED".
+func (m *ManagementClient) State() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Stats returns the traffic counters from the last >BYTECOUNT notification.
+func (m *ManagementClient) Stats() TrafficStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
 // GetStats queries the management interface for traffic statistics.
 func (m *ManagementClient) GetStats() (*TrafficStats, error) {
-	conn, err := net.DialTimeout("tcp", m.addr, 2*time.Second)
+	lines, err := m.command("status", true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to management interface: %w", err)
+		return nil, err
 	}
-	defer conn.Close()
 
-	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	stats := &TrafficStats{}
+	for _, line := range lines {
+		// Parse "TUN/TAP read bytes,<N>" and "TUN/TAP write bytes,<N>"
+		if v, ok := strings.CutPrefix(line, "TUN/TAP read bytes,"); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				stats.RxBytes = n
+			}
+		}
+		if v, ok := strings.CutPrefix(line, "TUN/TAP write bytes,"); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				stats.TxBytes = n
+			}
+		}
+	}
+	return stats, nil
+}
 
-	reader := bufio.NewReader(conn)
+// SendSignal sends a signal command (e.g., SIGTERM) via the management interface.
+func (m *ManagementClient) SendSignal(sig string) error {
+	_, err := m.command("signal "+sig, false)
+	return err
+}
 
-	// Read the greeting line
-	reader.ReadString('\n')
+// Close drops the management connection.
+func (m *ManagementClient) Close() error {
+	m.mu.Lock()
+	conn := m.conn
+	m.conn = nil
+	m.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
 
-	// Send status command
-	fmt.Fprintf(conn, "status\n")
+// command sends a management command and returns its response: the
+// SUCCESS line, or for multi-line commands the lines up to END.
+func (m *ManagementClient) command(cmd string, multiLine bool) ([]string, error) {
+	m.cmdMu.Lock()
+	defer m.cmdMu.Unlock()
 
-	stats := &TrafficStats{}
+	conn, replies, err := m.ensureConn()
+	if err != nil {
+		return nil, err
+	}
+	// Discard responses to earlier commands that timed out
+	for len(replies) > 0 {
+		<-replies
+	}
+
+	// Only the verb goes into errors; arguments may be credentials
+	verb, _, _ := strings.Cut(cmd, " ")
+	conn.SetWriteDeadline(time.Now().Add(mgmtCommandTimeout))
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("management command %s: %w", verb, err)
+	}
+
+	timeout := time.NewTimer(mgmtCommandTimeout)
+	defer timeout.Stop()
+	var lines []string
+	for {
+		select {
+		case line, ok := <-replies:
+			if !ok {
+				return nil, fmt.Errorf("management command %s: connection closed", verb)
+			}
+			if msg, isErr := strings.CutPrefix(line, "ERROR:"); isErr {
+				return nil, fmt.Errorf("management command %s: %s", verb, strings.TrimSpace(msg))
+			}
+			if !multiLine {
+				return []string{line}, nil
+			}
+			if line == "END" {
+				return lines, nil
+			}
+			lines = append(lines, line)
+		case <-timeout.C:
+			return nil, fmt.Errorf("management command %s timed out", verb)
+		}
+	}
+}
+
+// ensureConn returns the open connection, dialing one if needed.
+func (m *ManagementClient) ensureConn() (net.Conn, chan string, error) {
+	m.mu.Lock()
+	conn, replies := m.conn, m.replies
+	m.mu.Unlock()
+	if conn != nil {
+		return conn, replies, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to management interface: %w", err)
+	}
+	return conn, m.attach(conn), nil
+}
+
+// attach makes conn the client's connection and starts reading from it.
+func (m *ManagementClient) attach(conn net.Conn) chan string {
+	replies := make(chan string, 64)
+	m.mu.Lock()
+	m.conn, m.replies = conn, replies
+	m.mu.Unlock()
+	go m.readLoop(conn, replies)
+	return replies
+}
+
+func (m *ManagementClient) readLoop(conn net.Conn, replies chan string) {
+	defer close(replies)
+	reader := bufio.NewReader(conn)
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			break
+			m.mu.Lock()
+			current := m.conn == conn
+			if current {
+				m.conn = nil
+			}
+			m.mu.Unlock()
+			if current {
+				m.finish(fmt.Errorf("management interface closed: %w", err))
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, ">") {
+			m.handleNotification(line[1:])
+			continue
 		}
-		line = strings.TrimSpace(line)
-		if line == "END" {
-			break
+		select {
+		case replies <- line:
+		default:
+			// Nobody is waiting and the backlog is full; the next
+			// command discards it anyway.
 		}
+	}
+}
 
-		// Parse "TUN/TAP read bytes,<N>" and "TUN/TAP write bytes,<N>"
-		if strings.HasPrefix(line, "TUN/TAP read bytes,") {
-			parts := strings.SplitN(line, ",", 2)
-			if len(parts) == 2 {
-				if n, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-					stats.RxBytes = n
+// handleNotification processes a real-time message without its ">".
+func (m *ManagementClient) handleNotification(msg string) {
+	kind, payload, _ := strings.Cut(msg, ":")
+	switch kind {
+	case "STATE":
+		// unix time,state,description,local IP,remote IP,remote port,
+		// local address,local port,local IPv6
+		fields := strings.Split(payload, ",")
+		if len(fields) < 2 {
+			return
+		}
+		m.mu.Lock()
+		m.state = fields[1]
+		if fields[1] == "CONNECTED" {
+			field := func(i int) string {
+				if i < len(fields) {
+					return fields[i]
 				}
+				return ""
 			}
+			m.session.LocalIP = field(3)
+			m.session.RemoteIP = field(4)
+			m.session.RemotePort = field(5)
+			m.session.LocalIPv6 = field(8)
 		}
-		if strings.HasPrefix(line, "TUN/TAP write bytes,") {
-			parts := strings.SplitN(line, ",", 2)
-			if len(parts) == 2 {
-				if n, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-					stats.TxBytes = n
-				}
+		m.mu.Unlock()
+		text := fields[1]
+		if len(fields) > 2 && fields[2] != "" {
+			text += " " + fields[2]
+		}
+		m.emit(tunnel.Event{Time: parseUnixTime(fields[0]), Type: tunnel.EventState, Message: text})
+		if fields[1] != "CONNECTING" {
+			m.initializedOnce.Do(func() { close(m.initialized) })
+		}
+		if fields[1] == "CONNECTED" {
+			m.connectedOnce.Do(func() { close(m.connected) })
+		}
+	case "BYTECOUNT":
+		in, out, ok := strings.Cut(payload, ",")
+		if !ok {
+			return
+		}
+		rx, err1 := strconv.ParseInt(in, 10, 64)
+		tx, err2 := strconv.ParseInt(out, 10, 64)
+		if err1 == nil && err2 == nil {
+			m.mu.Lock()
+			m.stats = TrafficStats{TxBytes: tx, RxBytes: rx}
+			m.mu.Unlock()
+		}
+	case "LOG":
+		// unix time,flags,message
+		fields := strings.SplitN(payload, ",", 3)
+		if len(fields) == 3 {
+			m.noteLog(fields[2])
+			m.emit(tunnel.Event{Time: parseUnixTime(fields[0]), Type: tunnel.EventLog, Message: fields[2]})
+		}
+	case "HOLD":
+		// OpenVPN holds again after a restart; Start releases the first one
+		m.mu.Lock()
+		ready := m.ready
+		m.mu.Unlock()
+		if ready {
+			go m.command("hold release", false)
+		}
+	case "FATAL":
+		m.finish(fmt.Errorf("openvpn: %s", payload))
+	case "REMOTE":
+		// host,port,proto: OpenVPN is about to try this remote and waits
+		// for the answer (management-query-remote)
+		fields := strings.Split(payload, ",")
+		if len(fields) >= 2 {
+			m.mu.Lock()
+			m.session.Remote = net.JoinHostPort(fields[0], fields[1])
+			m.mu.Unlock()
+		}
+		go m.command("remote ACCEPT", false)
+	case "PASSWORD":
+		switch {
+		case strings.HasPrefix(payload, "Verification Failed: 'Private Key'"):
+			m.finish(ErrKeyPassphrase)
+		case strings.HasPrefix(payload, "Verification Failed"):
+			// A dynamic challenge comes as a failure; with auth-retry
+			// interact OpenVPN then asks for the credentials again.
+			if c := parseDynamicChallenge(payload); c != nil {
+				m.mu.Lock()
+				m.dynamic = c
+				m.mu.Unlock()
+				return
 			}
+			m.mu.Lock()
+			replied := m.replied
+			m.mu.Unlock()
+			if replied {
+				m.finish(ErrChallengeFailed)
+			} else {
+				m.finish(ErrAuthFailed)
+			}
+		case strings.HasPrefix(payload, "Need 'Auth'"):
+			go m.answerAuth(parseStaticChallenge(payload))
+		case strings.HasPrefix(payload, "Need 'Private Key'"):
+			go m.answerKeyPassphrase()
 		}
 	}
+}
 
-	return stats, nil
+// noteLog picks the device name and pushed options out of log messages.
+func (m *ManagementClient) noteLog(msg string) {
+	if reply, ok := strings.CutPrefix(msg, pushReplyPrefix); ok {
+		m.mu.Lock()
+		m.session.notePush(strings.TrimSuffix(reply, "'"))
+		m.mu.Unlock()
+		return
+	}
+	for _, re := range deviceOpened {
+		if match := re.FindStringSubmatch(msg); match != nil {
+			m.mu.Lock()
+			m.session.Device = match[1]
+			m.mu.Unlock()
+			return
+		}
+	}
 }
 
-// SendSignal sends a signal command (e.g., SIGTERM) via the management interface.
-func (m *ManagementClient) SendSignal(sig string) error {
-	conn, err := net.DialTimeout("tcp", m.addr, 2*time.Second)
+// answerAuth sends the credentials for the "Auth" query, with the response
+// to static, or a pending dynamic, challenge.
+func (m *ManagementClient) answerAuth(static *challenge) {
+	m.mu.Lock()
+	creds, dynamic := m.creds, m.dynamic
+	m.dynamic = nil
+	m.mu.Unlock()
+	if creds == nil {
+		m.finish(fmt.Errorf("server requires a username and password"))
+		return
+	}
+
+	user, pass := creds.Username, creds.Password
+	if c := dynamic; c != nil || static != nil {
+		if c == nil {
+			c = static
+		}
+		resp, err := answerChallenge(creds, c)
+		if err != nil {
+			m.finish(err)
+			return
+		}
+		switch {
+		case c.state != "":
+			user, pass = c.user, "CRV1::"+c.state+"::"+resp
+		case c.concat:
+			pass += resp
+		default:
+			pass = "SCRV1:" + base64.StdEncoding.EncodeToString([]byte(pass)) + ":" + base64.StdEncoding.EncodeToString([]byte(resp))
+		}
+	}
+	m.mu.Lock()
+	m.replied = dynamic != nil || static != nil
+	m.mu.Unlock()
+
+	quotedUser, err := quoteMgmt(user)
+	if err != nil {
+		m.finish(fmt.Errorf("username: %w", err))
+		return
+	}
+	quotedPass, err := quoteMgmt(pass)
 	if err != nil {
-		return fmt.Errorf("failed to connect to management interface: %w", err)
+		m.finish(fmt.Errorf("password: %w", err))
+		return
+	}
+	if _, err := m.command(`username "Auth" `+quotedUser, false); err != nil {
+		m.finish(err)
+		return
+	}
+	if _, err := m.command(`password "Auth" `+quotedPass, false); err != nil {
+		m.finish(err)
 	}
-	defer conn.Close()
+}
 
-	conn.SetDeadline(time.Now().Add(3 * time.Second))
+// answerKeyPassphrase sends the passphrase of an encrypted client key.
+func (m *ManagementClient) answerKeyPassphrase() {
+	m.mu.Lock()
+	creds := m.creds
+	m.mu.Unlock()
+	if creds == nil || creds.KeyPassphrase == "" {
+		m.finish(fmt.Errorf("client private key is encrypted and no passphrase was given"))
+		return
+	}
+	quoted, err := quoteMgmt(creds.KeyPassphrase)
+	if err != nil {
+		m.finish(fmt.Errorf("key passphrase: %w", err))
+		return
+	}
+	if _, err := m.command(`password "Private Key" `+quoted, false); err != nil {
+		m.finish(err)
+	}
+}
 
-	reader := bufio.NewReader(conn)
-	reader.ReadString('\n') // greeting
+// answerChallenge asks the user for the response to c.
+func answerChallenge(creds *Credentials, c *challenge) (string, error) {
+	if creds.Challenge == nil {
+		return "", fmt.Errorf("server asks %q, but no prompt is available", c.prompt)
+	}
+	resp, err := creds.Challenge(c.prompt, c.echo)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(resp, "\r\n") {
+		return "", fmt.Errorf("challenge response must not contain line breaks")
+	}
+	return resp, nil
+}
+
+// emit publishes an event unless the channel is full.
+func (m *ManagementClient) emit(ev tunnel.Event) {
+	select {
+	case m.events <- ev:
+	default:
+	}
+}
 
-	fmt.Fprintf(conn, "signal %s\n", sig)
+// finish ends the session with err and reports it as a fatal event. Only
+// the first reason is kept.
+func (m *ManagementClient) finish(err error) {
+	m.doneOnce.Do(func() {
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+		m.emit(tunnel.Event{Time: time.Now(), Type: tunnel.EventFatal, Message: err.Error()})
+		close(m.done)
+	})
+}
 
-	// Read response
-	reader.ReadString('\n')
+// dialWait connects to the management interface, retrying while OpenVPN is
+// still starting up.
+func (m *ManagementClient) dialWait(ctx context.Context) (net.Conn, error) {
+	for {
+		conn, err := m.dial(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to management interface: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// dial connects to the management interface and logs in if it has a
+// password.
+func (m *ManagementClient) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, m.network, m.addr)
+	if err != nil {
+		return nil, err
+	}
+	if m.password != "" {
+		if err := m.login(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// login answers the "ENTER PASSWORD:" prompt of a protected management
+// port. It reads a byte at a time so nothing after the reply is consumed.
+func (m *ManagementClient) login(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	readUntil := func(done func(string) bool) (string, error) {
+		var buf []byte
+		b := make([]byte, 1)
+		for !done(string(buf)) {
+			if len(buf) > 1024 {
+				return "", fmt.Errorf("unexpected management greeting %q", buf)
+			}
+			if _, err := conn.Read(b); err != nil {
+				return "", err
+			}
+			buf = append(buf, b[0])
+		}
+		return string(buf), nil
+	}
+	if _, err := readUntil(func(s string) bool { return strings.HasSuffix(s, "ENTER PASSWORD:") }); err != nil {
+		return fmt.Errorf("management login failed: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", m.password); err != nil {
+		return fmt.Errorf("management login failed: %w", err)
+	}
+	reply, err := readUntil(func(s string) bool { return strings.HasSuffix(s, "\n") })
+	if err != nil {
+		return fmt.Errorf("management login failed: %w", err)
+	}
+	if !strings.HasPrefix(reply, "SUCCESS:") {
+		return fmt.Errorf("management login failed: %s", strings.TrimSpace(reply))
+	}
 	return nil
 }
+
+func parseUnixTime(s string) time.Time {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil && sec > 0 {
+		return time.Unix(sec, 0)
+	}
+	return time.Now()
+}
+
+// quoteMgmt quotes a management command argument, escaping backslashes and
+// double quotes. Line breaks cannot be quoted: they would end the command
+// and start another.
+func quoteMgmt(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", fmt.Errorf("must not contain line breaks")
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`, nil
+}
@@ -2,11 +2,18 @@ package openvpn
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/voidvpn/voidvpn/internal/tunnel"
 )
 
 func TestNewManagementClient(t *testing.T) {
@@ -212,3 +219,556 @@ func TestGetStatsLargeValues(t *testing.T) {
 		t.Errorf("TxBytes = %d, want 8888888888", stats.TxBytes)
 	}
 }
+
+// mockManagement accepts one management connection, sends the greeting and
+// hands the connection to serve.
+func mockManagement(t *testing.T, serve func(conn net.Conn, r *bufio.Reader)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		fmt.Fprintf(conn, ">INFO:OpenVPN Management Interface Version 5\n")
+		serve(conn, bufio.NewReader(conn))
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// acceptStart answers the commands Start sends before releasing the hold.
+func acceptStart(conn net.Conn, r *bufio.Reader) []string {
+	fmt.Fprintf(conn, ">HOLD:Waiting for hold release:0\n")
+	var cmds []string
+	for len(cmds) < 4 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		cmds = append(cmds, strings.TrimSpace(line))
+		fmt.Fprintf(conn, "SUCCESS: ok\n")
+	}
+	return cmds
+}
+
+func TestManagementStart(t *testing.T) {
+	cmdsCh := make(chan []string, 1)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		cmdsCh <- acceptStart(conn, r)
+		fmt.Fprintf(conn, ">STATE:1700000000,WAIT,,,,,,\n")
+		fmt.Fprintf(conn, ">LOG:1700000001,I,TUN/TAP device tun3 opened\n")
+		fmt.Fprintf(conn, ">BYTECOUNT:1000,2000\n")
+		fmt.Fprintf(conn, ">STATE:1700000002,CONNECTED,SUCCESS,10.8.0.2,1.2.3.4,1194,,,fd00::2\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, nil); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	want := []string{"state on", "log on", "bytecount 2", "hold release"}
+	if got := <-cmdsCh; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	select {
+	case <-mc.Connected():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for CONNECTED")
+	}
+	if mc.State() != "CONNECTED" {
+		t.Errorf("State() = %q, want CONNECTED", mc.State())
+	}
+	wantSession := Session{Device: "tun3", LocalIP: "10.8.0.2", LocalIPv6: "fd00::2", RemoteIP: "1.2.3.4", RemotePort: "1194"}
+	if got := mc.Session(); !reflect.DeepEqual(got, wantSession) {
+		t.Errorf("Session() = %+v, want %+v", got, wantSession)
+	}
+	if stats := mc.Stats(); stats.RxBytes != 1000 || stats.TxBytes != 2000 {
+		t.Errorf("Stats() = %+v, want rx 1000 tx 2000", stats)
+	}
+
+	var events []tunnel.Event
+	for len(events) < 3 {
+		select {
+		case ev := <-mc.Events():
+			events = append(events, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events, want 3", len(events))
+		}
+	}
+	if events[1].Type != tunnel.EventLog || events[1].Message != "TUN/TAP device tun3 opened" {
+		t.Errorf("log event = %+v", events[1])
+	}
+	if events[2].Type != tunnel.EventState || events[2].Message != "CONNECTED SUCCESS" || events[2].Time.Unix() != 1700000002 {
+		t.Errorf("state event = %+v", events[2])
+	}
+}
+
+func TestManagementUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, mgmtSocketName)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	cmdsCh := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		r := bufio.NewReader(conn)
+		cmdsCh <- acceptStart(conn, r)
+		r.ReadString('\n')
+	}()
+
+	mc := NewManagementClient(0)
+	mc.setEndpoint(unixManagement(path), "")
+	defer mc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, nil); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if got := <-cmdsCh; len(got) != 4 {
+		t.Errorf("commands = %q, want 4", got)
+	}
+}
+
+func TestManagementLogin(t *testing.T) {
+	for _, tt := range []struct {
+		password string
+		wantErr  bool
+	}{
+		{"s3cret", false},
+		{"wrong", true},
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+			r := bufio.NewReader(conn)
+			fmt.Fprintf(conn, "ENTER PASSWORD:")
+			if line, _ := r.ReadString('\n'); strings.TrimSpace(line) != "s3cret" {
+				fmt.Fprintf(conn, "ERROR: bad password\r\n")
+				return
+			}
+			fmt.Fprintf(conn, "SUCCESS: password is correct\r\n")
+			fmt.Fprintf(conn, ">INFO:OpenVPN Management Interface Version 5\r\n")
+			acceptStart(conn, r)
+			r.ReadString('\n')
+		}()
+
+		port := listener.Addr().(*net.TCPAddr).Port
+		mc := NewManagementClient(port)
+		mc.setEndpoint(tcpManagement(port, "pw"), tt.password)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = mc.Start(ctx, nil)
+		cancel()
+		mc.Close()
+		listener.Close()
+		if tt.wantErr && err == nil {
+			t.Errorf("Start() with password %q should fail", tt.password)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("Start() with password %q error: %v", tt.password, err)
+		}
+	}
+}
+
+func TestManagementInitialized(t *testing.T) {
+	states := make(chan string)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		for state := range states {
+			fmt.Fprintf(conn, ">STATE:1700000000,%s,,,,,,\n", state)
+		}
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, nil); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	states <- "CONNECTING"
+	select {
+	case <-mc.Initialized():
+		t.Fatal("Initialized closed before OpenVPN got past startup")
+	case <-time.After(100 * time.Millisecond):
+	}
+	states <- "RESOLVE"
+	close(states)
+	select {
+	case <-mc.Initialized():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for Initialized")
+	}
+}
+
+func TestNoteLogDevice(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"TUN/TAP device tun0 opened", "tun0"},
+		{"DCO device tun1 opened", "tun1"},
+		{"Opened utun device utun3", "utun3"},
+		{`TAP-WIN32 device [OpenVPN TAP-Windows6] opened: \\.\Global\{ABC}.tap`, "OpenVPN TAP-Windows6"},
+		{"Wintun device [OpenVPN Wintun] opened", "OpenVPN Wintun"},
+		{"Peer Connection Initiated with [AF_INET]1.2.3.4:1194", ""},
+	}
+	for _, tt := range tests {
+		mc := NewManagementClient(1)
+		mc.noteLog(tt.msg)
+		if got := mc.Session().Device; got != tt.want {
+			t.Errorf("noteLog(%q) device = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestNoteLogPushReply(t *testing.T) {
+	mc := NewManagementClient(1)
+	mc.noteLog(pushReplyPrefix + "route-gateway 10.8.0.1,dhcp-option DNS 10.8.0.1,dhcp-option DOMAIN corp.example,push-continuation 2'")
+	mc.noteLog(pushReplyPrefix + "dhcp-option DNS6 fd00::1,dhcp-option DOMAIN-SEARCH lab.example,ifconfig 10.8.0.2 255.255.255.0'")
+	session := mc.Session()
+	if want := []string{"10.8.0.1", "fd00::1"}; !reflect.DeepEqual(session.DNS, want) {
+		t.Errorf("DNS = %q, want %q", session.DNS, want)
+	}
+	if want := []string{"corp.example", "lab.example"}; !reflect.DeepEqual(session.Domains, want) {
+		t.Errorf("Domains = %q, want %q", session.Domains, want)
+	}
+
+	// A reconnect brings a new, complete reply that replaces the old options
+	mc.noteLog(pushReplyPrefix + "dhcp-option DNS 10.9.0.1'")
+	session = mc.Session()
+	if want := []string{"10.9.0.1"}; !reflect.DeepEqual(session.DNS, want) || session.Domains != nil {
+		t.Errorf("after reconnect DNS = %q, Domains = %q, want [10.9.0.1] and none", session.DNS, session.Domains)
+	}
+}
+
+func TestSessionAddresses(t *testing.T) {
+	tests := []struct {
+		session Session
+		want    string
+	}{
+		{Session{}, ""},
+		{Session{LocalIP: "10.8.0.2"}, "10.8.0.2"},
+		{Session{LocalIPv6: "fd00::2"}, "fd00::2"},
+		{Session{LocalIP: "10.8.0.2", LocalIPv6: "fd00::2"}, "10.8.0.2, fd00::2"},
+	}
+	for _, tt := range tests {
+		if got := tt.session.Addresses(); got != tt.want {
+			t.Errorf("Addresses() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestManagementRemote(t *testing.T) {
+	answer := make(chan string, 1)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">REMOTE:vpn2.example.com,443,tcp-client\n")
+		line, _ := r.ReadString('\n')
+		fmt.Fprintf(conn, "SUCCESS: remote command succeeded\n")
+		answer <- strings.TrimSpace(line)
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, nil); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	select {
+	case got := <-answer:
+		if got != "remote ACCEPT" {
+			t.Errorf("answer = %q, want remote ACCEPT", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the remote query to be answered")
+	}
+	if got := mc.Session().Remote; got != "vpn2.example.com:443" {
+		t.Errorf("Session().Remote = %q, want vpn2.example.com:443", got)
+	}
+}
+
+func TestManagementAuth(t *testing.T) {
+	received := make(chan []string, 1)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Auth' username/password\n")
+		user, _ := r.ReadString('\n')
+		fmt.Fprintf(conn, "SUCCESS: 'Auth' username entered, but not yet verified\n")
+		pass, _ := r.ReadString('\n')
+		fmt.Fprintf(conn, "SUCCESS: 'Auth' password entered, but not yet verified\n")
+		received <- []string{strings.TrimSpace(user), strings.TrimSpace(pass)}
+		fmt.Fprintf(conn, ">PASSWORD:Verification Failed: 'Auth'\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, &Credentials{Username: "alice", Password: `p"a\ss`}); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	got := <-received
+	if len(got) != 2 || got[0] != `username "Auth" "alice"` || got[1] != `password "Auth" "p\"a\\ss"` {
+		t.Errorf("credentials sent = %q", got)
+	}
+
+	select {
+	case <-mc.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the failed verification")
+	}
+	if !errors.Is(mc.Err(), ErrAuthFailed) {
+		t.Errorf("Err() = %v, want ErrAuthFailed", mc.Err())
+	}
+}
+
+func TestManagementKeyPassphrase(t *testing.T) {
+	received := make(chan string, 1)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Private Key' password\n")
+		line, _ := r.ReadString('\n')
+		fmt.Fprintf(conn, "SUCCESS: 'Private Key' password entered, but not yet verified\n")
+		received <- strings.TrimSpace(line)
+		fmt.Fprintf(conn, ">PASSWORD:Verification Failed: 'Private Key'\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, &Credentials{KeyPassphrase: "s3cret"}); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if got := <-received; got != `password "Private Key" "s3cret"` {
+		t.Errorf("passphrase sent = %q", got)
+	}
+
+	select {
+	case <-mc.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the failed verification")
+	}
+	if !errors.Is(mc.Err(), ErrKeyPassphrase) {
+		t.Errorf("Err() = %v, want ErrKeyPassphrase", mc.Err())
+	}
+}
+
+// readAuth reads the username and password commands and acknowledges them.
+func readAuth(conn net.Conn, r *bufio.Reader) []string {
+	var lines []string
+	for i := 0; i < 2; i++ {
+		line, _ := r.ReadString('\n')
+		fmt.Fprintf(conn, "SUCCESS: entered, but not yet verified\n")
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines
+}
+
+func TestManagementStaticChallenge(t *testing.T) {
+	received := make(chan []string, 1)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Auth' username/password SC:1,Enter OTP\n")
+		received <- readAuth(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Verification Failed: 'Auth'\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	var gotPrompt string
+	var gotEcho bool
+	creds := &Credentials{Username: "alice", Password: "s3cret", Challenge: func(prompt string, echo bool) (string, error) {
+		gotPrompt, gotEcho = prompt, echo
+		return "123456", nil
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, creds); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	got := <-received
+	// SCRV1:base64("s3cret"):base64("123456")
+	if got[0] != `username "Auth" "alice"` || got[1] != `password "Auth" "SCRV1:czNjcmV0:MTIzNDU2"` {
+		t.Errorf("credentials sent = %q", got)
+	}
+	if gotPrompt != "Enter OTP" || !gotEcho {
+		t.Errorf("challenge = %q echo %v, want Enter OTP with echo", gotPrompt, gotEcho)
+	}
+
+	<-mc.Done()
+	if !errors.Is(mc.Err(), ErrChallengeFailed) {
+		t.Errorf("Err() = %v, want ErrChallengeFailed", mc.Err())
+	}
+}
+
+func TestManagementDynamicChallenge(t *testing.T) {
+	received := make(chan []string, 2)
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Auth' username/password\n")
+		received <- readAuth(conn, r)
+		// base64("alice-sso") as the username to answer with
+		fmt.Fprintf(conn, ">PASSWORD:Verification Failed: 'Auth' ['CRV1:R:Om01u7Fh4LrG:YWxpY2Utc3Nv:Enter token PIN']\n")
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Auth' username/password\n")
+		received <- readAuth(conn, r)
+		fmt.Fprintf(conn, ">STATE:1700000002,CONNECTED,SUCCESS,10.8.0.2,1.2.3.4,1194,,\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	creds := &Credentials{Username: "alice", Password: "s3cret", Challenge: func(prompt string, echo bool) (string, error) {
+		if prompt != "Enter token PIN" || echo {
+			t.Errorf("challenge = %q echo %v, want Enter token PIN without echo", prompt, echo)
+		}
+		return "4321", nil
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, creds); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if got := <-received; got[1] != `password "Auth" "s3cret"` {
+		t.Errorf("first attempt = %q, want the plain password", got)
+	}
+	if got := <-received; got[0] != `username "Auth" "alice-sso"` || got[1] != `password "Auth" "CRV1::Om01u7Fh4LrG::4321"` {
+		t.Errorf("challenge response = %q", got)
+	}
+	select {
+	case <-mc.Connected():
+	case <-mc.Done():
+		t.Fatalf("session ended: %v", mc.Err())
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for CONNECTED")
+	}
+}
+
+func TestManagementChallengeWithoutPrompt(t *testing.T) {
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">PASSWORD:Need 'Auth' username/password SC:0,Enter OTP\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, &Credentials{Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	select {
+	case <-mc.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the session to fail")
+	}
+	if err := mc.Err(); err == nil || !strings.Contains(err.Error(), "Enter OTP") {
+		t.Errorf("Err() = %v, want it to name the unanswered challenge", err)
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	sc := parseStaticChallenge("Need 'Auth' username/password SC:3,Token, please")
+	if sc == nil || sc.prompt != "Token, please" || !sc.echo || !sc.concat {
+		t.Errorf("parseStaticChallenge() = %+v", sc)
+	}
+	if parseStaticChallenge("Need 'Auth' username/password") != nil {
+		t.Error("a query without SC: has no static challenge")
+	}
+
+	dc := parseDynamicChallenge("Verification Failed: 'Auth' ['CRV1:R,E:state:YWxpY2U=:Code: from app']")
+	if dc == nil || dc.prompt != "Code: from app" || !dc.echo || dc.state != "state" || dc.user != "alice" {
+		t.Errorf("parseDynamicChallenge() = %+v", dc)
+	}
+	for _, failure := range []string{"Verification Failed: 'Auth'", "Verification Failed: 'Auth' ['CRV1:R:state:!!:text']"} {
+		if parseDynamicChallenge(failure) != nil {
+			t.Errorf("parseDynamicChallenge(%q) should find no challenge", failure)
+		}
+	}
+}
+
+func TestManagementFatal(t *testing.T) {
+	port := mockManagement(t, func(conn net.Conn, r *bufio.Reader) {
+		acceptStart(conn, r)
+		fmt.Fprintf(conn, ">FATAL:Cannot open TUN/TAP dev /dev/net/tun\n")
+		r.ReadString('\n')
+	})
+	mc := NewManagementClient(port)
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Start(ctx, nil); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	select {
+	case <-mc.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the fatal error")
+	}
+	if err := mc.Err(); err == nil || !strings.Contains(err.Error(), "Cannot open TUN/TAP") {
+		t.Errorf("Err() = %v, want the fatal message", err)
+	}
+}
+
+func TestManagementStartRejectsLineBreaks(t *testing.T) {
+	mc := NewManagementClient(1)
+	for _, creds := range []*Credentials{
+		{Username: "alice", Password: "x\nsignal SIGTERM"},
+		{Username: "alice\r\nsignal SIGTERM", Password: "x"},
+		{KeyPassphrase: "x\nsignal SIGTERM"},
+	} {
+		if err := mc.Start(context.Background(), creds); err == nil {
+			t.Errorf("Start(%+v) should reject credentials containing line breaks", *creds)
+		}
+	}
+}
+
+func TestQuoteMgmt(t *testing.T) {
+	if got, err := quoteMgmt(`pa"ss\word`); err != nil || got != `"pa\"ss\\word"` {
+		t.Errorf("quoteMgmt() = %q, %v", got, err)
+	}
+	for _, s := range []string{"x\nsignal SIGTERM", "x\rsignal SIGTERM"} {
+		if got, err := quoteMgmt(s); err == nil {
+			t.Errorf("quoteMgmt(%q) = %q, want an error", s, got)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package openvpn
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+const (
+	// sessionDirPrefix starts the name of each session's runtime directory.
+	sessionDirPrefix = "openvpn-"
+	// logName is the log of the current session; older ones get a suffix.
+	logName = "openvpn.log"
+	// keepLogs is how many logs of earlier sessions are kept.
+	keepLogs = 3
+	// mgmtSocketName is the management socket in the session directory.
+	mgmtSocketName = "mgmt.sock"
+)
+
+// runtimeDir is a private directory for the files of one OpenVPN session.
+// Its name and the names of the files in it are random.
+type runtimeDir struct {
+	path    string
+	secrets []string // files to remove once OpenVPN has read them
+}
+
+// newRuntimeDir creates a session directory under base, readable only by
+// the owner. Directories left behind by sessions that did not clean up are
+// removed first; only one OpenVPN session runs at a time.
+func newRuntimeDir(base string) (*runtimeDir, error) {
+	if err := os.MkdirAll(base, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	if stale, err := filepath.Glob(filepath.Join(base, sessionDirPrefix+"*")); err == nil {
+		for _, dir := range stale {
+			os.RemoveAll(dir)
+		}
+	}
+	path, err := os.MkdirTemp(base, sessionDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	return &runtimeDir{path: path}, nil
+}
+
+// writeSecret writes content to a new file that only the owner can read,
+// and returns its path. It is removed by removeSecrets.
+func (r *runtimeDir) writeSecret(pattern, content string) (string, error) {
+	f, err := os.CreateTemp(r.path, pattern)
+	if err != nil {
+		return "", err
+	}
+	r.secrets = append(r.secrets, f.Name())
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// removeSecrets removes the files written by writeSecret.
+func (r *runtimeDir) removeSecrets() {
+	for _, f := range r.secrets {
+		os.Remove(f)
+	}
+	r.secrets = nil
+}
+
+// remove removes the directory and everything in it.
+func (r *runtimeDir) remove() {
+	os.RemoveAll(r.path)
+	r.secrets = nil
+}
+
+// writeKeyFiles writes the server's key material to files in the session
+// directory and returns their paths by config block, for BuildOVPNConfig.
+func (r *runtimeDir) writeKeyFiles(cfg *config.ServerConfig) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, k := range []struct{ tag, content string }{
+		{"key", cfg.ClientKey},
+		{"tls-auth", cfg.TLSAuth},
+		{"tls-crypt", cfg.TLSCrypt},
+		{"tls-crypt-v2", cfg.TLSCryptV2},
+	} {
+		if k.content == "" {
+			continue
+		}
+		path, err := r.writeSecret("*.key", k.content+"\n")
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s file: %w", k.tag, err)
+		}
+		files[k.tag] = path
+	}
+	return files, nil
+}
+
+// managementEndpoint returns where OpenVPN's management interface should
+// listen: a socket in the session directory, which only the owner can
+// reach. Windows builds of OpenVPN have no Unix sockets, so there it is a
+// port on the loopback address with a random password, which is returned
+// too.
+func (r *runtimeDir) managementEndpoint(port int) (managementEndpoint, string, error) {
+	if runtime.GOOS != "windows" {
+		return unixManagement(filepath.Join(r.path, mgmtSocketName)), "", nil
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return managementEndpoint{}, "", fmt.Errorf("failed to generate management password: %w", err)
+	}
+	password := hex.EncodeToString(b)
+	pwFile, err := r.writeSecret("*.pw", password+"\n")
+	if err != nil {
+		return managementEndpoint{}, "", fmt.Errorf("failed to write management password: %w", err)
+	}
+	return tcpManagement(port, pwFile), password, nil
+}
+
+// openSessionLog starts a new OpenVPN log in dir, keeping the logs of the
+// last keepLogs sessions as openvpn.log.1 (newest) and up.
+func openSessionLog(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, logName)
+	for i := keepLogs; i > 0; i-- {
+		older := fmt.Sprintf("%s.%d", path, i-1)
+		if i == 1 {
+			older = path
+		}
+		if err := os.Rename(older, fmt.Sprintf("%s.%d", path, i)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	// The log has been moved away; never follow whatever replaced it
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
@@ -0,0 +1,138 @@
+package openvpn
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+func TestNewRuntimeDir(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "run")
+	stale := filepath.Join(base, sessionDirPrefix+"stale")
+	os.MkdirAll(stale, 0700)
+	os.WriteFile(filepath.Join(stale, "left.key"), []byte("secret"), 0600)
+
+	rt, err := newRuntimeDir(base)
+	if err != nil {
+		t.Fatalf("newRuntimeDir() error: %v", err)
+	}
+	defer rt.remove()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("a stale session directory should have been removed")
+	}
+	if filepath.Dir(rt.path) != base || !strings.HasPrefix(filepath.Base(rt.path), sessionDirPrefix) {
+		t.Errorf("path = %q, want a session directory in %q", rt.path, base)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(rt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Errorf("session directory mode = %o, want 700", perm)
+		}
+	}
+
+	other, err := newRuntimeDir(base)
+	if err != nil {
+		t.Fatalf("newRuntimeDir() error: %v", err)
+	}
+	defer other.remove()
+	if other.path == rt.path {
+		t.Error("session directories should get unpredictable, distinct names")
+	}
+}
+
+func TestRuntimeDirSecrets(t *testing.T) {
+	rt, err := newRuntimeDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("newRuntimeDir() error: %v", err)
+	}
+	defer rt.remove()
+
+	cfg := &config.ServerConfig{
+		CACert:    "CA",
+		ClientKey: "KEY",
+		TLSCrypt:  "TLS CRYPT",
+	}
+	files, err := rt.writeKeyFiles(cfg)
+	if err != nil {
+		t.Fatalf("writeKeyFiles() error: %v", err)
+	}
+	if len(files) != 2 || files["key"] == "" || files["tls-crypt"] == "" {
+		t.Fatalf("writeKeyFiles() = %v, want the key and tls-crypt files", files)
+	}
+	data, err := os.ReadFile(files["key"])
+	if err != nil || string(data) != "KEY\n" {
+		t.Errorf("key file = %q, %v", data, err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(files["key"]); err == nil && info.Mode().Perm() != 0600 {
+			t.Errorf("key file mode = %o, want 600", info.Mode().Perm())
+		}
+	}
+
+	rt.removeSecrets()
+	for tag, path := range files {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s file should have been removed", tag)
+		}
+	}
+	if _, err := os.Stat(rt.path); err != nil {
+		t.Error("the session directory should remain until the session ends")
+	}
+}
+
+func TestOpenSessionLog(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < keepLogs+2; i++ {
+		f, err := openSessionLog(dir)
+		if err != nil {
+			t.Fatalf("openSessionLog() error: %v", err)
+		}
+		f.WriteString(strings.Repeat("x", i+1))
+		f.Close()
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != keepLogs+1 {
+		t.Errorf("log directory has %d files, want %d", len(entries), keepLogs+1)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, logName)); len(data) != keepLogs+2 {
+		t.Errorf("current log = %q, want the last session's", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, logName+".1")); len(data) != keepLogs+1 {
+		t.Errorf("%s.1 = %q, want the previous session's", logName, data)
+	}
+}
+
+func TestRuntimeManagementEndpoint(t *testing.T) {
+	rt, err := newRuntimeDir(filepath.Join(t.TempDir(), "run"))
+	if err != nil {
+		t.Fatalf("newRuntimeDir() error: %v", err)
+	}
+	defer rt.remove()
+
+	mgmt, password, err := rt.managementEndpoint(12345)
+	if err != nil {
+		t.Fatalf("managementEndpoint() error: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if mgmt.network != "unix" || mgmt.addr != filepath.Join(rt.path, mgmtSocketName) || password != "" {
+			t.Errorf("managementEndpoint() = %+v, %q, want a socket in the session directory", mgmt, password)
+		}
+		return
+	}
+	if mgmt.network != "tcp" || mgmt.addr != "127.0.0.1:12345" || len(password) < 32 {
+		t.Errorf("managementEndpoint() = %+v, want a loopback port with a password", mgmt)
+	}
+	data, err := os.ReadFile(mgmt.pwFile)
+	if err != nil || strings.TrimSpace(string(data)) != password {
+		t.Errorf("password file = %q, %v, want %q", data, err, password)
+	}
+}
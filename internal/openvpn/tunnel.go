@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -16,22 +17,18 @@ import (
 	"github.com/voidvpn/voidvpn/internal/tunnel"
 )
 
-type scanResult struct {
-	connected bool
-	errMsg    string
-	lastLines []string
-}
-
 // Tunnel manages an OpenVPN connection by shelling out to the openvpn binary.
 type Tunnel struct {
-	server     *config.ServerConfig
-	cmd        *exec.Cmd
-	mgmt       *ManagementClient
-	mgmtPort   int
-	tmpConfig  string
-	cancel     context.CancelFunc
-	mu         sync.Mutex
+	server      *config.ServerConfig
+	cmd         *exec.Cmd
+	mgmt        *ManagementClient
+	mgmtPort    int         // management port where there are no Unix sockets
+	runtime     *runtimeDir // config and key files handed to openvpn
+	cancel      context.CancelFunc
+	mu          sync.Mutex
 	connectedAt time.Time
+
+	challenge ChallengeFunc // asks for OTPs and other challenge responses
 }
 
 // NewTunnel creates a new OpenVPN tunnel for the given server config.
@@ -54,25 +51,44 @@ func (t *Tunnel) Connect(ctx context.Context) error {
 		return err
 	}
 
-	// Write temp config
-	tmpDir := os.TempDir()
-	t.tmpConfig = filepath.Join(tmpDir, fmt.Sprintf("voidvpn-ovpn-%d.conf", os.Getpid()))
-	ovpnContent := BuildOVPNConfig(t.server, t.mgmtPort)
-	if err := os.WriteFile(t.tmpConfig, []byte(ovpnContent), 0600); err != nil {
-		return fmt.Errorf("failed to write temp config: %w", err)
+	// The config and keys go to a private session directory under random
+	// names, and are removed as soon as OpenVPN has read them
+	if t.runtime, err = newRuntimeDir(config.RuntimeDir()); err != nil {
+		return err
+	}
+	keyFiles, err := t.runtime.writeKeyFiles(t.server)
+	if err != nil {
+		t.cleanupRuntime()
+		return err
+	}
+	mgmt, password, err := t.runtime.managementEndpoint(t.mgmtPort)
+	if err != nil {
+		t.cleanupRuntime()
+		return err
+	}
+	t.mgmt.setEndpoint(mgmt, password)
+	ovpnConfig, err := buildOVPNConfig(t.server, mgmt, keyFiles)
+	if err != nil {
+		t.cleanupRuntime()
+		return err
+	}
+	configPath, err := t.runtime.writeSecret("*.conf", ovpnConfig)
+	if err != nil {
+		t.cleanupRuntime()
+		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	t.cancel = cancel
 
-	t.cmd = exec.CommandContext(ctx, binPath, "--config", t.tmpConfig)
+	t.cmd = exec.CommandContext(ctx, binPath, "--config", configPath)
 
 	// Combine stdout and stderr into a single pipe so we capture ALL openvpn output.
 	// On Windows, critical messages (TAP adapter errors, etc.) may go to stderr.
 	pr, pw, err := os.Pipe()
 	if err != nil {
 		cancel()
-		t.cleanupTempFile()
+		t.cleanupRuntime()
 		return fmt.Errorf("failed to create pipe: %w", err)
 	}
 	t.cmd.Stdout = pw
@@ -82,18 +98,26 @@ func (t *Tunnel) Connect(ctx context.Context) error {
 		cancel()
 		pw.Close()
 		pr.Close()
-		t.cleanupTempFile()
+		t.cleanupRuntime()
 		return fmt.Errorf("failed to start openvpn: %w", err)
 	}
 	pw.Close() // Close write end in parent; child process has its own fd
 
-	// Debug log file for full output
-	logPath := filepath.Join(os.TempDir(), "voidvpn-ovpn-debug.log")
-	logFile, _ := os.Create(logPath)
+	// Full output goes to a log per session; earlier ones are rotated.
+	// Errors only point at the log if there is one.
+	var fullLog, checkLog string
+	logFile, err := openSessionLog(config.LogDir())
+	if err != nil {
+		slog.Warn("failed to open OpenVPN log, output is not saved", "dir", config.LogDir(), "error", err)
+	} else {
+		fullLog = "\nFull log: " + logFile.Name()
+		checkLog = " (check " + logFile.Name() + ")"
+	}
 
-	// Scan combined output in background goroutine.
-	// Signals one of: connected, error message, or process exit (EOF).
-	resultCh := make(chan scanResult, 1)
+	// Copy combined output to the debug log in a background goroutine, keeping
+	// the last lines for the error if the process exits while connecting.
+	// Progress comes from the management interface.
+	exitCh := make(chan []string, 1)
 	go func() {
 		defer pr.Close()
 		defer func() {
@@ -112,58 +136,104 @@ func (t *Tunnel) Connect(ctx context.Context) error {
 			if len(lines) > 10 {
 				lines = lines[1:]
 			}
-			if strings.Contains(line, "Initialization Sequence Completed") {
-				resultCh <- scanResult{connected: true}
-				return
-			}
-			if strings.Contains(line, "AUTH_FAILED") || strings.Contains(line, "Connection refused") {
-				resultCh <- scanResult{errMsg: line}
-				return
-			}
 		}
-		// Scanner finished (EOF) = process exited without connecting
-		resultCh <- scanResult{lastLines: lines}
+		// Scanner finished (EOF) = process exited
+		exitCh <- lines
 	}()
 
-	select {
-	case res := <-resultCh:
-		if res.connected {
-			t.connectedAt = time.Now()
-			return nil
-		}
-		_ = t.cmd.Process.Kill()
-		_ = t.cmd.Wait()
-		t.cleanupTempFile()
-		cancel()
-		if res.errMsg != "" {
-			return fmt.Errorf("openvpn error: %s", res.errMsg)
+	connectTimeout := ConnectTimeout(t.server)
+	timeout := time.NewTimer(connectTimeout)
+	defer timeout.Stop()
+
+	var creds *Credentials
+	if NeedsCredentials(t.server) || NeedsKeyPassphrase(t.server) {
+		creds = &Credentials{
+			Username:      t.server.Username,
+			Password:      t.server.Password,
+			KeyPassphrase: t.server.KeyPassphrase,
 		}
-		detail := strings.Join(res.lastLines, "\n  ")
-		if detail == "" {
-			detail = "no output captured"
+		if ask := t.challenge; ask != nil {
+			// The time spent answering does not count against the timeout
+			creds.Challenge = func(prompt string, echo bool) (string, error) {
+				if !timeout.Stop() {
+					return "", fmt.Errorf("openvpn connection timed out")
+				}
+				defer timeout.Reset(connectTimeout)
+				return ask(prompt, echo)
+			}
 		}
-		return fmt.Errorf("openvpn exited unexpectedly. Last output:\n  %s\nFull log: %s", detail, logPath)
-	case <-time.After(60 * time.Second):
+	}
+	startCh := make(chan error, 1)
+	go func() { startCh <- t.mgmt.Start(ctx, creds) }()
+
+	fail := func(err error) error {
 		_ = t.cmd.Process.Kill()
 		_ = t.cmd.Wait()
-		t.cleanupTempFile()
+		t.mgmt.Close()
+		t.cleanupRuntime()
 		cancel()
-		return fmt.Errorf("openvpn connection timed out after 60s (check %s)", logPath)
-	case <-ctx.Done():
-		_ = t.cmd.Process.Kill()
-		_ = t.cmd.Wait()
-		t.cleanupTempFile()
-		return ctx.Err()
+		return err
+	}
+	initialized := t.mgmt.Initialized()
+	for {
+		select {
+		case err := <-startCh:
+			if err != nil {
+				return fail(err)
+			}
+			startCh = nil
+		case <-initialized:
+			t.runtime.removeSecrets()
+			initialized = nil
+		case <-t.mgmt.Connected():
+			t.runtime.removeSecrets()
+			t.connectedAt = time.Now()
+			return nil
+		case <-t.mgmt.Done():
+			return fail(fmt.Errorf("openvpn error: %w", t.mgmt.Err()))
+		case lastLines := <-exitCh:
+			detail := strings.Join(lastLines, "\n  ")
+			if detail == "" {
+				detail = "no output captured"
+			}
+			return fail(fmt.Errorf("openvpn exited unexpectedly. Last output:\n  %s%s", detail, fullLog))
+		case <-timeout.C:
+			return fail(fmt.Errorf("openvpn connection timed out after %s%s", connectTimeout, checkLog))
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		}
 	}
 }
 
+// SetChallengeFunc sets how to ask the user for challenge responses, such
+// as one-time passwords. It must be called before Connect.
+func (t *Tunnel) SetChallengeFunc(fn ChallengeFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.challenge = fn
+}
+
+// Events returns state changes, log messages and fatal errors reported by
+// OpenVPN over the management interface.
+func (t *Tunnel) Events() <-chan tunnel.Event {
+	return t.mgmt.Events()
+}
+
+// PushedDNS returns the DNS servers and search domains the server pushed.
+func (t *Tunnel) PushedDNS() (servers, domains []string) {
+	session := t.mgmt.Session()
+	return session.DNS, session.Domains
+}
+
 func (t *Tunnel) Disconnect() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Try graceful shutdown via management interface
+	// Try graceful shutdown via management interface. Closing it right away
+	// keeps the shutdown from being reported as a lost connection.
 	if t.mgmt != nil {
 		_ = t.mgmt.SendSignal("SIGTERM")
+		t.mgmt.Close()
 	}
 
 	// If process is still running, kill it
@@ -176,7 +246,7 @@ func (t *Tunnel) Disconnect() error {
 		t.cancel()
 	}
 
-	t.cleanupTempFile()
+	t.cleanupRuntime()
 	return nil
 }
 
@@ -194,11 +264,26 @@ func (t *Tunnel) Status() (*tunnel.TunnelStatus, error) {
 
 	if status.Connected {
 		status.ConnectedAt = t.connectedAt
-		if stats, err := t.mgmt.GetStats(); err == nil {
-			status.TxBytes = stats.TxBytes
-			status.RxBytes = stats.RxBytes
+		stats := t.mgmt.Stats()
+		status.TxBytes = stats.TxBytes
+		status.RxBytes = stats.RxBytes
+
+		// Imported profiles have no address or endpoint of their own; what
+		// the server pushed is the only source.
+		session := t.mgmt.Session()
+		status.InterfaceName = session.Device
+		if addrs := session.Addresses(); addrs != "" {
+			status.TunnelIP = addrs
+		}
+		if session.Remote != "" {
+			// With several remotes, the one OpenVPN settled on
+			status.Endpoint = session.Remote
+		} else if status.Endpoint == "" && session.RemoteIP != "" {
+			status.Endpoint = session.RemoteIP
+			if session.RemotePort != "" {
+				status.Endpoint = net.JoinHostPort(session.RemoteIP, session.RemotePort)
+			}
 		}
-		status.InterfaceName = "tun0"
 	}
 
 	return status, nil
@@ -221,9 +306,9 @@ func (t *Tunnel) IsActiveUnlocked() bool {
 	return true
 }
 
-func (t *Tunnel) cleanupTempFile() {
-	if t.tmpConfig != "" {
-		os.Remove(t.tmpConfig)
-		t.tmpConfig = ""
+func (t *Tunnel) cleanupRuntime() {
+	if t.runtime != nil {
+		t.runtime.remove()
+		t.runtime = nil
 	}
 }
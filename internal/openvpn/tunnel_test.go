@@ -2,7 +2,6 @@ package openvpn
 
 import (
 	"os"
-	"path/filepath"
 	"strings"
 	"testing"
 
@@ -24,7 +23,7 @@ func TestBuildOVPNConfig(t *testing.T) {
 		TLSAuth:   "-----BEGIN OpenVPN Static key V1-----\nFAKETLS\n-----END OpenVPN Static key V1-----",
 	}
 
-	result := BuildOVPNConfig(cfg, 12345)
+	result := buildConfig(t, cfg, 12345)
 
 	checks := []string{
 		"client",
@@ -64,7 +63,7 @@ func TestBuildOVPNConfigMinimal(t *testing.T) {
 		Proto:    "tcp",
 	}
 
-	result := BuildOVPNConfig(cfg, 9999)
+	result := buildConfig(t, cfg, 9999)
 
 	if !strings.Contains(result, "proto tcp") {
 		t.Error("expected 'proto tcp'")
@@ -171,28 +170,32 @@ func TestIsActiveUnlockedNilCmd(t *testing.T) {
 	}
 }
 
-func TestCleanupTempFileRemoves(t *testing.T) {
-	tmp := t.TempDir()
-	tmpFile := filepath.Join(tmp, "test.conf")
-	os.WriteFile(tmpFile, []byte("test"), 0600)
+func TestCleanupRuntimeRemoves(t *testing.T) {
+	rt, err := newRuntimeDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("newRuntimeDir() error: %v", err)
+	}
+	if _, err := rt.writeSecret("*.conf", "test"); err != nil {
+		t.Fatalf("writeSecret() error: %v", err)
+	}
 
 	tun := &Tunnel{
-		server:    &config.ServerConfig{Name: "test"},
-		tmpConfig: tmpFile,
+		server:  &config.ServerConfig{Name: "test"},
+		runtime: rt,
 	}
 
-	tun.cleanupTempFile()
+	tun.cleanupRuntime()
 
-	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
-		t.Error("temp file should have been removed")
+	if _, err := os.Stat(rt.path); !os.IsNotExist(err) {
+		t.Error("runtime directory should have been removed")
 	}
-	if tun.tmpConfig != "" {
-		t.Error("tmpConfig should be empty after cleanup")
+	if tun.runtime != nil {
+		t.Error("runtime should be nil after cleanup")
 	}
 }
 
-func TestCleanupTempFileEmpty(t *testing.T) {
+func TestCleanupRuntimeEmpty(t *testing.T) {
 	tun := &Tunnel{server: &config.ServerConfig{Name: "test"}}
-	// Should not panic with empty tmpConfig
-	tun.cleanupTempFile()
+	// Should not panic without a runtime directory
+	tun.cleanupRuntime()
 }
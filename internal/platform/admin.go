@@ -1,7 +1,16 @@
 // Package platform provides platform-specific utilities for VoidVPN.
 package platform
 
+import "os/exec"
+
 // IsAdmin returns true if the current process has elevated/root privileges.
 func IsAdmin() bool {
 	return isAdmin()
 }
+
+// RunAsInvokingUser configures cmd to run as the user who invoked sudo, so
+// programs launched by an elevated VoidVPN do not inherit root. It is a no-op
+// when not running under sudo.
+func RunAsInvokingUser(cmd *exec.Cmd) error {
+	return runAsInvokingUser(cmd)
+}
@@ -2,8 +2,53 @@
 
 package platform
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
 
 func isAdmin() bool {
 	return os.Geteuid() == 0
 }
+
+func runAsInvokingUser(cmd *exec.Cmd) error {
+	uidStr, gidStr := os.Getenv("SUDO_UID"), os.Getenv("SUDO_GID")
+	if os.Geteuid() != 0 || uidStr == "" || gidStr == "" {
+		return nil
+	}
+	uid, err := strconv.ParseUint(uidStr, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid SUDO_UID %q: %w", uidStr, err)
+	}
+	gid, err := strconv.ParseUint(gidStr, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid SUDO_GID %q: %w", gidStr, err)
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if u, err := user.LookupId(uidStr); err == nil {
+		if groups, err := u.GroupIds(); err == nil {
+			for _, g := range groups {
+				if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+					cred.Groups = append(cred.Groups, uint32(id))
+				}
+			}
+		}
+		env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	cmd.Env = env
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = cred
+	return nil
+}
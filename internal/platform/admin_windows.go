@@ -3,6 +3,8 @@
 package platform
 
 import (
+	"os/exec"
+
 	"golang.org/x/sys/windows"
 )
 
@@ -27,3 +29,7 @@ func isAdmin() bool {
 	}
 	return member
 }
+
+func runAsInvokingUser(cmd *exec.Cmd) error {
+	return nil
+}
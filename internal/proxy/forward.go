@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+const forwardUDPIdleTimeout = 2 * time.Minute
+
+// ForwardSpec describes a port forward. Local is an address on the host and
+// Remote an address reached through (or, if Reverse, exposed on) the tunnel.
+type ForwardSpec struct {
+	Proto   string `json:"proto"` // "tcp" or "udp"
+	Reverse bool   `json:"reverse,omitempty"`
+	Local   string `json:"local"`
+	Remote  string `json:"remote"`
+}
+
+func (s ForwardSpec) String() string {
+	arrow := "->"
+	if s.Reverse {
+		arrow = "<-"
+	}
+	return fmt.Sprintf("%s %s %s %s", s.Proto, s.Local, arrow, s.Remote)
+}
+
+// ParseForwardSpec parses "local:remote". For a forward, local is "port" or
+// "host:port" (host defaults to 127.0.0.1) and remote is "host:port". For a
+// reverse forward, remote is the port to expose on the tunnel address, so the
+// returned Remote is ":port". IPv6 hosts must be bracketed.
+func ParseForwardSpec(spec string, reverse bool, proto string) (ForwardSpec, error) {
+	proto = strings.ToLower(proto)
+	if proto == "" {
+		proto = "tcp"
+	}
+	if proto != "tcp" && proto != "udp" {
+		return ForwardSpec{}, fmt.Errorf("unsupported protocol %q (use tcp or udp)", proto)
+	}
+	parts, err := splitForwardSpec(spec)
+	if err != nil {
+		return ForwardSpec{}, err
+	}
+
+	var local, remote []string
+	switch {
+	case !reverse && len(parts) == 3:
+		local, remote = []string{"127.0.0.1", parts[0]}, parts[1:]
+	case !reverse && len(parts) == 4:
+		local, remote = parts[:2], parts[2:]
+	case reverse && len(parts) == 2:
+		local, remote = []string{"127.0.0.1", parts[0]}, []string{"", parts[1]}
+	case reverse && len(parts) == 3:
+		local, remote = parts[:2], []string{"", parts[2]}
+	default:
+		if reverse {
+			return ForwardSpec{}, fmt.Errorf("invalid reverse forward %q: want [host:]port:tunnel-port", spec)
+		}
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: want [host:]port:remote-host:remote-port", spec)
+	}
+	if local[0] == "" {
+		local[0] = "127.0.0.1"
+	}
+	if !reverse && remote[0] == "" {
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: remote host is empty", spec)
+	}
+	for _, port := range []string{local[1], remote[1]} {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return ForwardSpec{}, fmt.Errorf("invalid port %q in %q", port, spec)
+		}
+	}
+	return ForwardSpec{
+		Proto:   proto,
+		Reverse: reverse,
+		Local:   net.JoinHostPort(local[0], local[1]),
+		Remote:  net.JoinHostPort(remote[0], remote[1]),
+	}, nil
+}
+
+// splitForwardSpec splits on colons outside of [brackets].
+func splitForwardSpec(spec string) ([]string, error) {
+	var parts []string
+	var cur strings.Builder
+	inBracket := false
+	for _, r := range spec {
+		switch {
+		case r == '[' && !inBracket:
+			inBracket = true
+		case r == ']' && inBracket:
+			inBracket = false
+		case r == ':' && !inBracket:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inBracket {
+		return nil, fmt.Errorf("invalid forward %q: unterminated '['", spec)
+	}
+	return append(parts, cur.String()), nil
+}
+
+// Forward relays connections accepted on one network to a fixed target
+// dialed on another: host to tunnel for a forward, tunnel to host for a
+// reverse forward.
+type Forward struct {
+	spec     ForwardSpec
+	target   string
+	dialer   tunnel.Dialer
+	listener net.Listener   // tcp
+	packet   net.PacketConn // udp
+	sessions sessionTable
+
+	mu   sync.Mutex
+	udp  map[string]net.Conn // client address -> upstream socket
+	done bool
+}
+
+// NewForward listens on listenAddr using ln and relays every connection or
+// datagram to target using dialer.
+func NewForward(spec ForwardSpec, ln tunnel.Listener, listenAddr string, dialer tunnel.Dialer, target string) (*Forward, error) {
+	f := &Forward{spec: spec, target: target, dialer: dialer, udp: make(map[string]net.Conn)}
+	var err error
+	if spec.Proto == "udp" {
+		f.packet, err = ln.ListenPacket("udp", listenAddr)
+	} else {
+		f.listener, err = ln.Listen("tcp", listenAddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+	return f, nil
+}
+
+// Spec returns the forward's specification.
+func (f *Forward) Spec() ForwardSpec {
+	return f.spec
+}
+
+// Addr returns the address the forward is listening on.
+func (f *Forward) Addr() net.Addr {
+	if f.packet != nil {
+		return f.packet.LocalAddr()
+	}
+	return f.listener.Addr()
+}
+
+// Serve relays traffic until the forward is closed.
+func (f *Forward) Serve() {
+	if f.packet != nil {
+		f.serveUDP()
+		return
+	}
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		sess := f.sessions.add(conn, "forward")
+		if sess == nil {
+			conn.Close()
+			return
+		}
+		go func() {
+			defer f.sessions.remove(conn)
+			f.relayTCP(conn, sess)
+		}()
+	}
+}
+
+// Close stops listening and drops every active session.
+func (f *Forward) Close() error {
+	f.sessions.closeAll()
+	f.mu.Lock()
+	f.done = true
+	for _, c := range f.udp {
+		c.Close()
+	}
+	f.mu.Unlock()
+	if f.packet != nil {
+		return f.packet.Close()
+	}
+	return f.listener.Close()
+}
+
+// Connections returns the active TCP sessions.
+func (f *Forward) Connections() []ConnStats {
+	return f.sessions.list()
+}
+
+func (f *Forward) relayTCP(conn net.Conn, sess *session) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	remote, err := f.dialer.DialContext(ctx, "tcp", f.target)
+	cancel()
+	if err != nil {
+		slog.Debug("port forward dial failed", "forward", f.spec, "error", err)
+		return
+	}
+	defer remote.Close()
+	sess.setTarget(f.target)
+	relay(conn, &countingConn{Conn: remote, s: sess})
+}
+
+// serveUDP gives every client address its own upstream socket, so replies
+// can be routed back to the right client.
+func (f *Forward) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := f.packet.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		upstream, err := f.udpUpstream(from)
+		if err != nil {
+			slog.Debug("port forward dial failed", "forward", f.spec, "error", err)
+			continue
+		}
+		upstream.SetReadDeadline(time.Now().Add(forwardUDPIdleTimeout))
+		upstream.Write(buf[:n])
+	}
+}
+
+func (f *Forward) udpUpstream(client net.Addr) (net.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return nil, net.ErrClosed
+	}
+	if c, ok := f.udp[client.String()]; ok {
+		return c, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	c, err := f.dialer.DialContext(ctx, "udp", f.target)
+	if err != nil {
+		return nil, err
+	}
+	f.udp[client.String()] = c
+	go f.udpReplies(client, c)
+	return c, nil
+}
+
+func (f *Forward) udpReplies(client net.Addr, c net.Conn) {
+	defer func() {
+		f.mu.Lock()
+		if f.udp[client.String()] == c {
+			delete(f.udp, client.String())
+		}
+		f.mu.Unlock()
+		c.Close()
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				slog.Debug("port forward UDP session ended", "client", client, "error", err)
+			}
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(forwardUDPIdleTimeout))
+		if _, err := f.packet.WriteTo(buf[:n], client); err != nil {
+			return
+		}
+	}
+}
+
+// HostNetwork dials and listens on the host's own network stack.
+type HostNetwork struct{}
+
+func (HostNetwork) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func (HostNetwork) Listen(network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
+
+func (HostNetwork) ListenPacket(network, address string) (net.PacketConn, error) {
+	return net.ListenPacket(network, address)
+}
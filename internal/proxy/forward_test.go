@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		reverse bool
+		proto   string
+		want    ForwardSpec
+		wantErr bool
+	}{
+		{spec: "15432:10.20.0.5:5432", want: ForwardSpec{Proto: "tcp", Local: "127.0.0.1:15432", Remote: "10.20.0.5:5432"}},
+		{spec: "0.0.0.0:15432:db.corp:5432", proto: "tcp", want: ForwardSpec{Proto: "tcp", Local: "0.0.0.0:15432", Remote: "db.corp:5432"}},
+		{spec: "5353:[fd00::53]:53", proto: "udp", want: ForwardSpec{Proto: "udp", Local: "127.0.0.1:5353", Remote: "[fd00::53]:53"}},
+		{spec: "3000:8080", reverse: true, want: ForwardSpec{Proto: "tcp", Reverse: true, Local: "127.0.0.1:3000", Remote: ":8080"}},
+		{spec: "[::1]:3000:8080", reverse: true, want: ForwardSpec{Proto: "tcp", Reverse: true, Local: "[::1]:3000", Remote: ":8080"}},
+		{spec: "3000:8080", wantErr: true},
+		{spec: "15432:10.20.0.5:5432", reverse: true, wantErr: true},
+		{spec: "15432::5432", wantErr: true},
+		{spec: "0:10.20.0.5:5432", wantErr: true},
+		{spec: "15432:10.20.0.5:70000", wantErr: true},
+		{spec: "15432:[fd00::1:5432", wantErr: true},
+		{spec: "15432:10.20.0.5:5432", proto: "sctp", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseForwardSpec(tt.spec, tt.reverse, tt.proto)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseForwardSpec(%q, %v) = %+v, want error", tt.spec, tt.reverse, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseForwardSpec(%q, %v) error: %v", tt.spec, tt.reverse, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseForwardSpec(%q, %v) = %+v, want %+v", tt.spec, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestForwardTCP(t *testing.T) {
+	echo := startEcho(t)
+	dialer := &recordingDialer{rewrite: map[string]string{"10.20.0.5:5432": echo}}
+	spec := ForwardSpec{Proto: "tcp", Local: "127.0.0.1:0", Remote: "10.20.0.5:5432"}
+	f, err := NewForward(spec, HostNetwork{}, spec.Local, dialer, spec.Remote)
+	if err != nil {
+		t.Fatalf("NewForward error: %v", err)
+	}
+	go f.Serve()
+	defer f.Close()
+
+	c, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	roundTrip(t, c, "select 1")
+
+	conns := f.Connections()
+	if len(conns) != 1 || conns[0].Target != "10.20.0.5:5432" {
+		t.Errorf("Connections() = %+v, want one session to 10.20.0.5:5432", conns)
+	}
+}
+
+func TestForwardUDP(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], from)
+		}
+	}()
+
+	spec := ForwardSpec{Proto: "udp", Local: "127.0.0.1:0", Remote: echo.LocalAddr().String()}
+	f, err := NewForward(spec, HostNetwork{}, spec.Local, &recordingDialer{}, spec.Remote)
+	if err != nil {
+		t.Fatalf("NewForward error: %v", err)
+	}
+	go f.Serve()
+	defer f.Close()
+
+	// Two clients must each get their own replies
+	for _, msg := range []string{"first", "second"} {
+		c, err := net.Dial("udp", f.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial error: %v", err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		c.Write([]byte(msg))
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		c.Close()
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if string(buf[:n]) != msg {
+			t.Errorf("reply = %q, want %q", buf[:n], msg)
+		}
+	}
+}
+
+func TestForwardClose(t *testing.T) {
+	spec := ForwardSpec{Proto: "tcp", Local: "127.0.0.1:0", Remote: "10.20.0.5:5432"}
+	f, err := NewForward(spec, HostNetwork{}, spec.Local, &recordingDialer{}, spec.Remote)
+	if err != nil {
+		t.Fatalf("NewForward error: %v", err)
+	}
+	go f.Serve()
+	addr := f.Addr().String()
+	f.Close()
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Error("forward still listening after Close")
+	}
+}
@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+// DefaultHTTPAddr is where the HTTP proxy listens unless configured.
+const DefaultHTTPAddr = "127.0.0.1:8080"
+
+const httpIdleTimeout = 2 * time.Minute
+
+// hopHeaders apply to a single connection and are not forwarded (RFC 9110).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Upgrade",
+}
+
+// HTTP is an HTTP proxy that tunnels CONNECT requests and forwards plain
+// http:// requests, with optional Basic authentication.
+type HTTP struct {
+	listener net.Listener
+	creds    *Credentials
+	dialer   tunnel.Dialer
+	sessions sessionTable
+}
+
+// NewHTTP listens on addr and dials every outbound connection with dialer.
+func NewHTTP(addr string, creds *Credentials, dialer tunnel.Dialer) (*HTTP, error) {
+	if dialer == nil {
+		return nil, fmt.Errorf("HTTP proxy needs a dialer")
+	}
+	if creds != nil && (creds.Username == "" || strings.Contains(creds.Username, ":")) {
+		return nil, fmt.Errorf("HTTP proxy username must be non-empty and must not contain ':'")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start HTTP proxy: %w", err)
+	}
+	return &HTTP{listener: ln, creds: creds, dialer: dialer}, nil
+}
+
+// Addr returns the address the proxy is listening on.
+func (h *HTTP) Addr() net.Addr {
+	return h.listener.Addr()
+}
+
+// Serve accepts clients until the proxy is closed.
+func (h *HTTP) Serve() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+		sess := h.sessions.add(conn, "http")
+		if sess == nil {
+			conn.Close()
+			return
+		}
+		go func() {
+			defer h.sessions.remove(conn)
+			h.handle(conn, sess)
+		}()
+	}
+}
+
+// Close stops the listener and drops every active session.
+func (h *HTTP) Close() error {
+	h.sessions.closeAll()
+	return h.listener.Close()
+}
+
+// Connections returns the active CONNECT tunnels and forwarding sessions.
+func (h *HTTP) Connections() []ConnStats {
+	return h.sessions.list()
+}
+
+func (h *HTTP) handle(conn net.Conn, sess *session) {
+	br := bufio.NewReader(conn)
+	var upstream *forwardConn
+	defer func() {
+		if upstream != nil {
+			upstream.Close()
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(httpIdleTimeout))
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("HTTP proxy bad request", "client", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+
+		if !h.authorized(req) {
+			resp := httpError(http.StatusProxyAuthRequired, "proxy authentication required")
+			resp.Header.Set("Proxy-Authenticate", `Basic realm="voidvpn"`)
+			resp.Write(conn)
+			return
+		}
+
+		if req.Method == http.MethodConnect {
+			h.connect(conn, br, sess, req)
+			return
+		}
+
+		var keepAlive bool
+		upstream, keepAlive = h.forward(conn, sess, req, upstream)
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+// connect answers a CONNECT request and relays raw bytes to the target.
+func (h *HTTP) connect(conn net.Conn, br *bufio.Reader, sess *session, req *http.Request) {
+	target := withDefaultPort(req.Host, "443")
+	remote, err := h.dial(target)
+	if err != nil {
+		slog.Debug("HTTP proxy connect failed", "target", target, "error", err)
+		dialErrorResponse(err).Write(conn)
+		return
+	}
+	defer remote.Close()
+
+	sess.setTarget(target)
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	counted := &countingConn{Conn: remote, s: sess}
+	// The client may have sent the start of its TLS handshake already
+	if n := br.Buffered(); n > 0 {
+		buf, _ := br.Peek(n)
+		if _, err := counted.Write(buf); err != nil {
+			return
+		}
+	}
+	slog.Debug("HTTP proxy connect", "client", conn.RemoteAddr(), "target", target)
+	relay(conn, counted)
+}
+
+// forwardConn is a kept-alive connection to an origin server.
+type forwardConn struct {
+	net.Conn
+	target string
+	br     *bufio.Reader
+}
+
+// forward sends an absolute-form request to its origin and copies the
+// response back. It returns the upstream connection for reuse and whether
+// the client connection can stay open.
+func (h *HTTP) forward(conn net.Conn, sess *session, req *http.Request, upstream *forwardConn) (*forwardConn, bool) {
+	if req.URL.Scheme != "http" || req.URL.Host == "" {
+		httpError(http.StatusBadRequest, "only absolute http:// URLs can be forwarded; use CONNECT for https").Write(conn)
+		return upstream, false
+	}
+	target := withDefaultPort(req.URL.Host, "80")
+	if upstream != nil && upstream.target != target {
+		upstream.Close()
+		upstream = nil
+	}
+	if upstream == nil {
+		remote, err := h.dial(target)
+		if err != nil {
+			slog.Debug("HTTP proxy forward failed", "target", target, "error", err)
+			dialErrorResponse(err).Write(conn)
+			return nil, false
+		}
+		counted := &countingConn{Conn: remote, s: sess}
+		upstream = &forwardConn{Conn: counted, target: target, br: bufio.NewReader(counted)}
+	}
+	sess.setTarget(target)
+
+	clientClose := req.Close
+	removeHopHeaders(req.Header)
+	req.Close = false
+	if err := req.Write(upstream); err != nil {
+		httpError(http.StatusBadGateway, err.Error()).Write(conn)
+		return upstream, false
+	}
+	resp, err := http.ReadResponse(upstream.br, req)
+	if err != nil {
+		httpError(http.StatusBadGateway, err.Error()).Write(conn)
+		return upstream, false
+	}
+	defer resp.Body.Close()
+
+	upstreamClose := resp.Close
+	removeHopHeaders(resp.Header)
+	// Bodies of unknown length can only be delimited by closing the connection
+	chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+	resp.Close = clientClose || (resp.ContentLength < 0 && !chunked)
+	if err := resp.Write(conn); err != nil || resp.Close {
+		return upstream, false
+	}
+	if upstreamClose {
+		upstream.Close()
+		upstream = nil
+	}
+	return upstream, true
+}
+
+func (h *HTTP) dial(target string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	return h.dialer.DialContext(ctx, "tcp", target)
+}
+
+func (h *HTTP) authorized(req *http.Request) bool {
+	if h.creds == nil {
+		return true
+	}
+	encoded, ok := strings.CutPrefix(req.Header.Get("Proxy-Authorization"), "Basic ")
+	if !ok {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.creds.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(h.creds.Password)) == 1
+	return userOK && passOK
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, f := range header.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+func httpError(code int, msg string) *http.Response {
+	body := msg + "\n"
+	return &http.Response{
+		StatusCode:    code,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         true,
+	}
+}
+
+// dialErrorResponse maps a dial error to a gateway error response.
+func dialErrorResponse(err error) *http.Response {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return httpError(http.StatusGatewayTimeout, err.Error())
+	}
+	return httpError(http.StatusBadGateway, err.Error())
+}
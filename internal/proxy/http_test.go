@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func startHTTPProxy(t *testing.T, creds *Credentials, dialer *recordingDialer) *HTTP {
+	t.Helper()
+	h, err := NewHTTP("127.0.0.1:0", creds, dialer)
+	if err != nil {
+		t.Fatalf("NewHTTP error: %v", err)
+	}
+	go h.Serve()
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func proxyClient(h *HTTP, user *url.Userinfo) *http.Client {
+	proxyURL := &url.URL{Scheme: "http", Host: h.Addr().String(), User: user}
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   5 * time.Second,
+	}
+}
+
+func TestHTTPProxyForward(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Connection") != "" {
+			t.Error("Proxy-Connection header was forwarded")
+		}
+		fmt.Fprintf(w, "hello %s", r.URL.Path)
+	}))
+	defer origin.Close()
+
+	// The name only exists inside the "tunnel"; the dialer maps it to origin
+	dialer := &recordingDialer{rewrite: map[string]string{"intranet.corp.example:80": origin.Listener.Addr().String()}}
+	h := startHTTPProxy(t, nil, dialer)
+	client := proxyClient(h, nil)
+
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := client.Get("http://intranet.corp.example" + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello "+path {
+			t.Errorf("body = %q, want %q", body, "hello "+path)
+		}
+	}
+	// Both requests reuse the kept-alive upstream connection
+	if got := dialer.seen(); len(got) != 1 || got[0] != "intranet.corp.example:80" {
+		t.Errorf("dialed %v, want a single dial of the unresolved name", got)
+	}
+}
+
+func TestHTTPProxyConnect(t *testing.T) {
+	echo := startEcho(t)
+	h := startHTTPProxy(t, nil, &recordingDialer{})
+
+	c, err := net.Dial("tcp", h.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(c, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", echo, echo)
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("ReadResponse error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT status = %d, want 200", resp.StatusCode)
+	}
+
+	c.Write([]byte("tunnelled"))
+	buf := make([]byte, len("tunnelled"))
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "tunnelled" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+
+	conns := h.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("Connections() = %v, want one session", conns)
+	}
+	if conns[0].Proxy != "http" || conns[0].Target != echo {
+		t.Errorf("session = %+v, want http proxy to %s", conns[0], echo)
+	}
+	if conns[0].TxBytes != int64(len("tunnelled")) || conns[0].RxBytes != int64(len("tunnelled")) {
+		t.Errorf("traffic = %d/%d, want %d each way", conns[0].TxBytes, conns[0].RxBytes, len("tunnelled"))
+	}
+}
+
+func TestHTTPProxyAuth(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Error("Proxy-Authorization header was forwarded")
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+	h := startHTTPProxy(t, &Credentials{Username: "ci", Password: "token"}, &recordingDialer{})
+
+	resp, err := proxyClient(h, nil).Get(origin.URL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("status without credentials = %d, want 407", resp.StatusCode)
+	}
+
+	resp, err = proxyClient(h, url.UserPassword("ci", "wrong")).Get(origin.URL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("status with a wrong password = %d, want 407", resp.StatusCode)
+	}
+
+	resp, err = proxyClient(h, url.UserPassword("ci", "token")).Get(origin.URL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status with credentials = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestHTTPProxyDialFailure(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+
+	h := startHTTPProxy(t, nil, &recordingDialer{})
+	resp, err := proxyClient(h, nil).Get("http://" + closed + "/")
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	tests := []struct{ host, port, want string }{
+		{"example.com", "443", "example.com:443"},
+		{"example.com:8443", "443", "example.com:8443"},
+		{"[2001:db8::1]", "80", "[2001:db8::1]:80"},
+		{"[2001:db8::1]:8080", "80", "[2001:db8::1]:8080"},
+	}
+	for _, tt := range tests {
+		if got := withDefaultPort(tt.host, tt.port); got != tt.want {
+			t.Errorf("withDefaultPort(%q, %q) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
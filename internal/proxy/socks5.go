@@ -0,0 +1,512 @@
+// Package proxy implements local proxy listeners whose outbound connections
+// are dialed through the active VPN tunnel.
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+// DefaultSOCKSAddr is where the SOCKS5 proxy listens unless configured.
+const DefaultSOCKSAddr = "127.0.0.1:1080"
+
+const (
+	socksVersion = 0x05
+
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthNoMatch  = 0xff
+
+	socksCmdConnect      = 0x01
+	socksCmdUDPAssociate = 0x03
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksRepSuccess             = 0x00
+	socksRepGeneralFailure      = 0x01
+	socksRepNetworkUnreachable  = 0x03
+	socksRepHostUnreachable     = 0x04
+	socksRepConnectionRefused   = 0x05
+	socksRepCommandNotSupported = 0x07
+	socksRepAddrNotSupported    = 0x08
+
+	socksHandshakeTimeout = 10 * time.Second
+	dialTimeout           = 15 * time.Second
+	socksUDPIdleTimeout   = 2 * time.Minute
+)
+
+// Credentials enables username/password authentication when non-nil.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// SOCKS5 is a SOCKS5 server (RFC 1928) supporting CONNECT and UDP ASSOCIATE,
+// with optional username/password authentication (RFC 1929).
+type SOCKS5 struct {
+	listener net.Listener
+	creds    *Credentials
+	dialer   tunnel.Dialer
+	sessions sessionTable
+}
+
+// NewSOCKS5 listens on addr and dials every outbound connection with dialer.
+func NewSOCKS5(addr string, creds *Credentials, dialer tunnel.Dialer) (*SOCKS5, error) {
+	if dialer == nil {
+		return nil, fmt.Errorf("SOCKS5 proxy needs a dialer")
+	}
+	if creds != nil && (len(creds.Username) == 0 || len(creds.Username) > 255 || len(creds.Password) > 255) {
+		return nil, fmt.Errorf("SOCKS5 username must be 1-255 bytes and password at most 255 bytes")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SOCKS5 proxy: %w", err)
+	}
+	return &SOCKS5{
+		listener: ln,
+		creds:    creds,
+		dialer:   dialer,
+	}, nil
+}
+
+// Addr returns the address the proxy is listening on.
+func (s *SOCKS5) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts clients until the proxy is closed.
+func (s *SOCKS5) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		sess := s.sessions.add(conn, "socks5")
+		if sess == nil {
+			conn.Close()
+			return
+		}
+		go func() {
+			defer s.sessions.remove(conn)
+			s.handle(conn, sess)
+		}()
+	}
+}
+
+// Close stops the listener and drops every active session.
+func (s *SOCKS5) Close() error {
+	s.sessions.closeAll()
+	return s.listener.Close()
+}
+
+// Connections returns the active CONNECT and UDP ASSOCIATE sessions.
+func (s *SOCKS5) Connections() []ConnStats {
+	return s.sessions.list()
+}
+
+func (s *SOCKS5) handle(conn net.Conn, sess *session) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	if err := s.negotiate(conn); err != nil {
+		slog.Debug("SOCKS5 handshake failed", "client", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	cmd, target, err := readSOCKSRequest(conn)
+	if err != nil {
+		slog.Debug("SOCKS5 bad request", "client", conn.RemoteAddr(), "error", err)
+		if errors.Is(err, errSOCKSAddrType) {
+			writeSOCKSReply(conn, socksRepAddrNotSupported, nil)
+		}
+		return
+	}
+
+	switch cmd {
+	case socksCmdConnect:
+		s.connect(conn, sess, target)
+	case socksCmdUDPAssociate:
+		s.udpAssociate(conn, sess)
+	default:
+		writeSOCKSReply(conn, socksRepCommandNotSupported, nil)
+	}
+}
+
+// negotiate performs method selection and, if configured, password auth.
+func (s *SOCKS5) negotiate(conn net.Conn) error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != socksVersion {
+		return fmt.Errorf("unsupported SOCKS version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+
+	want := byte(socksAuthNone)
+	if s.creds != nil {
+		want = socksAuthPassword
+	}
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socksVersion, socksAuthNoMatch})
+		return fmt.Errorf("client did not offer auth method %d", want)
+	}
+	if _, err := conn.Write([]byte{socksVersion, want}); err != nil {
+		return err
+	}
+	if s.creds == nil {
+		return nil
+	}
+
+	// RFC 1929: VER ULEN UNAME PLEN PASSWD
+	var ver [2]byte
+	if _, err := io.ReadFull(conn, ver[:]); err != nil {
+		return err
+	}
+	user := make([]byte, ver[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return err
+	}
+	var plen [1]byte
+	if _, err := io.ReadFull(conn, plen[:]); err != nil {
+		return err
+	}
+	pass := make([]byte, plen[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return err
+	}
+	userOK := subtle.ConstantTimeCompare(user, []byte(s.creds.Username)) == 1
+	passOK := subtle.ConstantTimeCompare(pass, []byte(s.creds.Password)) == 1
+	if ver[0] != 0x01 || !userOK || !passOK {
+		conn.Write([]byte{0x01, 0x01})
+		return fmt.Errorf("authentication failed for user %q", user)
+	}
+	_, err := conn.Write([]byte{0x01, 0x00})
+	return err
+}
+
+func (s *SOCKS5) connect(conn net.Conn, sess *session, target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	remote, err := s.dialer.DialContext(ctx, "tcp", target)
+	cancel()
+	if err != nil {
+		slog.Debug("SOCKS5 connect failed", "target", target, "error", err)
+		writeSOCKSReply(conn, dialErrorReply(err), nil)
+		return
+	}
+	defer remote.Close()
+
+	sess.setTarget(target)
+	if err := writeSOCKSReply(conn, socksRepSuccess, remote.LocalAddr()); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	slog.Debug("SOCKS5 connect", "client", conn.RemoteAddr(), "target", target)
+	relay(conn, &countingConn{Conn: remote, s: sess})
+}
+
+// udpAssociate relays datagrams for the client until its control connection
+// closes. Each destination gets its own connected UDP socket in the tunnel.
+func (s *SOCKS5) udpAssociate(conn net.Conn, sess *session) {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		writeSOCKSReply(conn, socksRepGeneralFailure, nil)
+		return
+	}
+	defer pc.Close()
+
+	sess.setTarget("udp")
+	if err := writeSOCKSReply(conn, socksRepSuccess, pc.LocalAddr()); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+	assoc := &udpAssociation{
+		socks:    s,
+		sess:     sess,
+		pc:       pc,
+		clientIP: clientIP,
+		targets:  make(map[string]net.Conn),
+	}
+	go assoc.serve()
+	defer assoc.close()
+
+	// The association lives as long as the TCP connection
+	io.Copy(io.Discard, conn)
+}
+
+type udpAssociation struct {
+	socks    *SOCKS5
+	sess     *session
+	pc       net.PacketConn
+	clientIP net.IP
+
+	mu      sync.Mutex
+	client  net.Addr
+	targets map[string]net.Conn
+}
+
+func (a *udpAssociation) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := a.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// Only the client that opened the association may use it
+		if udp, ok := from.(*net.UDPAddr); !ok || !udp.IP.Equal(a.clientIP) {
+			continue
+		}
+		a.mu.Lock()
+		a.client = from
+		a.mu.Unlock()
+
+		target, payload, err := parseSOCKSDatagram(buf[:n])
+		if err != nil {
+			slog.Debug("SOCKS5 dropped datagram", "error", err)
+			continue
+		}
+		remote, err := a.target(target)
+		if err != nil {
+			slog.Debug("SOCKS5 UDP dial failed", "target", target, "error", err)
+			continue
+		}
+		remote.SetReadDeadline(time.Now().Add(socksUDPIdleTimeout))
+		if n, err := remote.Write(payload); err == nil {
+			a.sess.tx.Add(int64(n))
+		}
+	}
+}
+
+func (a *udpAssociation) target(target string) (net.Conn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c, ok := a.targets[target]; ok {
+		return c, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	c, err := a.socks.dialer.DialContext(ctx, "udp", target)
+	if err != nil {
+		return nil, err
+	}
+	a.targets[target] = c
+	go a.readReplies(target, c)
+	return c, nil
+}
+
+func (a *udpAssociation) readReplies(target string, c net.Conn) {
+	defer func() {
+		a.mu.Lock()
+		if a.targets[target] == c {
+			delete(a.targets, target)
+		}
+		a.mu.Unlock()
+		c.Close()
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(socksUDPIdleTimeout))
+		a.sess.rx.Add(int64(n))
+		hdr := socksDatagramHeader(c.RemoteAddr())
+		a.mu.Lock()
+		client := a.client
+		a.mu.Unlock()
+		if client != nil {
+			a.pc.WriteTo(append(hdr, buf[:n]...), client)
+		}
+	}
+}
+
+func (a *udpAssociation) close() {
+	a.pc.Close()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.targets {
+		c.Close()
+	}
+}
+
+var errSOCKSAddrType = errors.New("unsupported address type")
+
+// readSOCKSRequest reads VER CMD RSV ATYP DST.ADDR DST.PORT.
+func readSOCKSRequest(r io.Reader) (cmd byte, target string, err error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, "", err
+	}
+	if hdr[0] != socksVersion {
+		return 0, "", fmt.Errorf("unsupported SOCKS version %d", hdr[0])
+	}
+	target, err = readSOCKSAddr(r)
+	return hdr[1], target, err
+}
+
+// readSOCKSAddr reads ATYP DST.ADDR DST.PORT and returns host:port. Domain
+// names are passed through unresolved so the tunnel's DNS resolves them.
+func readSOCKSAddr(r io.Reader) (string, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp[0] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := 4
+		if atyp[0] == socksAtypIPv6 {
+			size = 16
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		addr, _ := netip.AddrFromSlice(ip)
+		host = addr.String()
+	case socksAtypDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", errSOCKSAddrType
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// parseSOCKSDatagram splits a UDP request (RSV FRAG ATYP DST PORT DATA).
+func parseSOCKSDatagram(b []byte) (target string, payload []byte, err error) {
+	if len(b) < 4 {
+		return "", nil, fmt.Errorf("short datagram")
+	}
+	if b[2] != 0 {
+		return "", nil, fmt.Errorf("fragmented datagrams are not supported")
+	}
+	r := &countingReader{b: b[3:]}
+	target, err = readSOCKSAddr(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return target, b[3+r.n:], nil
+}
+
+type countingReader struct {
+	b []byte
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.n >= len(r.b) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b[r.n:])
+	r.n += n
+	return n, nil
+}
+
+// socksAddr encodes addr as ATYP BND.ADDR BND.PORT, using 0.0.0.0:0 when
+// the address is unknown.
+func socksAddr(addr net.Addr) []byte {
+	ip, port := net.IPv4zero, 0
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	default:
+		if addr != nil {
+			if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+				ip, port = ap.Addr().AsSlice(), int(ap.Port())
+			}
+		}
+	}
+	var b []byte
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append([]byte{socksAtypIPv4}, ip4...)
+	} else {
+		b = append([]byte{socksAtypIPv6}, ip.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port))
+}
+
+func socksDatagramHeader(from net.Addr) []byte {
+	return append([]byte{0, 0, 0}, socksAddr(from)...)
+}
+
+func writeSOCKSReply(w io.Writer, rep byte, bound net.Addr) error {
+	_, err := w.Write(append([]byte{socksVersion, rep, 0x00}, socksAddr(bound)...))
+	return err
+}
+
+// dialErrorReply maps a dial error to the closest SOCKS5 reply code.
+func dialErrorReply(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socksRepConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return socksRepNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, context.DeadlineExceeded):
+		return socksRepHostUnreachable
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return socksRepHostUnreachable
+	}
+	return socksRepGeneralFailure
+}
+
+// relay copies data in both directions until either side is done.
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		// Half-close so the peer sees EOF but can still finish replying
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go pipe(a, b)
+	go pipe(b, a)
+	<-done
+	<-done
+}
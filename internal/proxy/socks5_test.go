@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// recordingDialer dials with the host stack and remembers every target.
+type recordingDialer struct {
+	mu      sync.Mutex
+	targets []string
+	rewrite map[string]string // target -> address actually dialed
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.targets = append(d.targets, address)
+	if to, ok := d.rewrite[address]; ok {
+		address = to
+	}
+	d.mu.Unlock()
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, address)
+}
+
+func (d *recordingDialer) seen() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.targets...)
+}
+
+func startSOCKS(t *testing.T, creds *Credentials, dialer *recordingDialer) *SOCKS5 {
+	t.Helper()
+	s, err := NewSOCKS5("127.0.0.1:0", creds, dialer)
+	if err != nil {
+		t.Fatalf("NewSOCKS5 error: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// startEcho runs a TCP echo server and returns its address.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func roundTrip(t *testing.T, c net.Conn, msg string) {
+	t.Helper()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(buf) != msg {
+		t.Errorf("echo = %q, want %q", buf, msg)
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	echo := startEcho(t)
+	dialer := &recordingDialer{}
+	s := startSOCKS(t, nil, dialer)
+
+	client, err := xproxy.SOCKS5("tcp", s.Addr().String(), nil, xproxy.Direct)
+	if err != nil {
+		t.Fatalf("SOCKS5 client error: %v", err)
+	}
+	c, err := client.Dial("tcp", echo)
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	roundTrip(t, c, "hello through the tunnel")
+
+	if got := dialer.seen(); len(got) != 1 || got[0] != echo {
+		t.Errorf("dialed %v, want [%s]", got, echo)
+	}
+}
+
+func TestSOCKS5PassesDomainsToDialer(t *testing.T) {
+	echo := startEcho(t)
+	dialer := &recordingDialer{rewrite: map[string]string{"intranet.corp.example:80": echo}}
+	s := startSOCKS(t, nil, dialer)
+
+	client, _ := xproxy.SOCKS5("tcp", s.Addr().String(), nil, xproxy.Direct)
+	c, err := client.Dial("tcp", "intranet.corp.example:80")
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	roundTrip(t, c, "ping")
+
+	if got := dialer.seen(); len(got) != 1 || got[0] != "intranet.corp.example:80" {
+		t.Errorf("dialed %v, want the unresolved domain", got)
+	}
+}
+
+func TestSOCKS5Auth(t *testing.T) {
+	echo := startEcho(t)
+	s := startSOCKS(t, &Credentials{Username: "alice", Password: "s3cret"}, &recordingDialer{})
+
+	good, _ := xproxy.SOCKS5("tcp", s.Addr().String(), &xproxy.Auth{User: "alice", Password: "s3cret"}, xproxy.Direct)
+	c, err := good.Dial("tcp", echo)
+	if err != nil {
+		t.Fatalf("Dial with valid credentials error: %v", err)
+	}
+	roundTrip(t, c, "ok")
+	c.Close()
+
+	bad, _ := xproxy.SOCKS5("tcp", s.Addr().String(), &xproxy.Auth{User: "alice", Password: "wrong"}, xproxy.Direct)
+	if c, err := bad.Dial("tcp", echo); err == nil {
+		c.Close()
+		t.Error("Dial with a wrong password succeeded")
+	}
+
+	anon, _ := xproxy.SOCKS5("tcp", s.Addr().String(), nil, xproxy.Direct)
+	if c, err := anon.Dial("tcp", echo); err == nil {
+		c.Close()
+		t.Error("Dial without credentials succeeded")
+	}
+}
+
+func TestSOCKS5UDPAssociate(t *testing.T) {
+	// UDP echo server
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], from)
+		}
+	}()
+
+	s := startSOCKS(t, nil, &recordingDialer{})
+	ctrl, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer ctrl.Close()
+	ctrl.SetDeadline(time.Now().Add(5 * time.Second))
+
+	ctrl.Write([]byte{socksVersion, 1, socksAuthNone})
+	var method [2]byte
+	if _, err := io.ReadFull(ctrl, method[:]); err != nil || method[1] != socksAuthNone {
+		t.Fatalf("method selection = %v, %v", method, err)
+	}
+	ctrl.Write([]byte{socksVersion, socksCmdUDPAssociate, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(ctrl, reply); err != nil || reply[1] != socksRepSuccess {
+		t.Fatalf("UDP ASSOCIATE reply = %v, %v", reply, err)
+	}
+	relay := &net.UDPAddr{IP: net.IP(reply[4:8]), Port: int(binary.BigEndian.Uint16(reply[8:10]))}
+
+	uc, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		t.Fatalf("DialUDP error: %v", err)
+	}
+	defer uc.Close()
+
+	target := echo.LocalAddr().(*net.UDPAddr)
+	hdr := socksDatagramHeader(target)
+	uc.Write(append(hdr, []byte("datagram")...))
+
+	uc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := uc.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(buf[:len(hdr)], hdr) {
+		t.Errorf("reply header = %v, want %v", buf[:len(hdr)], hdr)
+	}
+	if got := string(buf[len(hdr):n]); got != "datagram" {
+		t.Errorf("reply payload = %q, want %q", got, "datagram")
+	}
+}
+
+func TestSOCKS5RejectsBind(t *testing.T) {
+	s := startSOCKS(t, nil, &recordingDialer{})
+	c, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c.Write([]byte{socksVersion, 1, socksAuthNone})
+	io.ReadFull(c, make([]byte, 2))
+	c.Write([]byte{socksVersion, 0x02, 0, socksAtypIPv4, 127, 0, 0, 1, 0, 80})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if reply[1] != socksRepCommandNotSupported {
+		t.Errorf("reply code = %d, want %d", reply[1], socksRepCommandNotSupported)
+	}
+}
+
+func TestParseSOCKSDatagram(t *testing.T) {
+	pkt := []byte{0, 0, 0, socksAtypDomain, 4, 'h', 'o', 's', 't', 0, 53, 'x', 'y'}
+	target, payload, err := parseSOCKSDatagram(pkt)
+	if err != nil {
+		t.Fatalf("parseSOCKSDatagram error: %v", err)
+	}
+	if target != "host:53" || string(payload) != "xy" {
+		t.Errorf("got %q %q, want host:53 xy", target, payload)
+	}
+
+	pkt[2] = 1
+	if _, _, err := parseSOCKSDatagram(pkt); err == nil {
+		t.Error("expected fragmented datagram to be rejected")
+	}
+}
+
+func TestDialErrorReply(t *testing.T) {
+	tests := []struct {
+		err  error
+		want byte
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, socksRepConnectionRefused},
+		{&net.OpError{Op: "dial", Err: syscall.ENETUNREACH}, socksRepNetworkUnreachable},
+		{&net.DNSError{Err: "no such host", Name: "x"}, socksRepHostUnreachable},
+		{context.DeadlineExceeded, socksRepHostUnreachable},
+		{io.ErrUnexpectedEOF, socksRepGeneralFailure},
+	}
+	for _, tt := range tests {
+		if got := dialErrorReply(tt.err); got != tt.want {
+			t.Errorf("dialErrorReply(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats describes one active proxy session. TxBytes counts data sent
+// through the tunnel and RxBytes data received from it.
+type ConnStats struct {
+	Proxy   string    `json:"proxy"`
+	Client  string    `json:"client"`
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+	TxBytes int64     `json:"tx_bytes"`
+	RxBytes int64     `json:"rx_bytes"`
+}
+
+type session struct {
+	proxy   string
+	client  string
+	started time.Time
+
+	mu     sync.Mutex
+	target string
+	tx, rx atomic.Int64
+}
+
+func (s *session) setTarget(target string) {
+	s.mu.Lock()
+	s.target = target
+	s.mu.Unlock()
+}
+
+func (s *session) stats() ConnStats {
+	s.mu.Lock()
+	target := s.target
+	s.mu.Unlock()
+	return ConnStats{
+		Proxy:   s.proxy,
+		Client:  s.client,
+		Target:  target,
+		Started: s.started,
+		TxBytes: s.tx.Load(),
+		RxBytes: s.rx.Load(),
+	}
+}
+
+// sessionTable tracks client connections so they can be listed for status
+// and dropped when the proxy closes.
+type sessionTable struct {
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]*session
+}
+
+// add registers a client connection, returning nil once the table is closed.
+func (t *sessionTable) add(c net.Conn, proxy string) *session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]*session)
+	}
+	s := &session{proxy: proxy, client: c.RemoteAddr().String(), started: time.Now()}
+	t.conns[c] = s
+	return s
+}
+
+func (t *sessionTable) remove(c net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+	c.Close()
+}
+
+func (t *sessionTable) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for c := range t.conns {
+		c.Close()
+	}
+}
+
+// list returns the sessions that have a target, oldest first.
+func (t *sessionTable) list() []ConnStats {
+	t.mu.Lock()
+	var out []ConnStats
+	for _, s := range t.conns {
+		if st := s.stats(); st.Target != "" {
+			out = append(out, st)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+// countingConn attributes traffic on a tunnel-side connection to a session.
+type countingConn struct {
+	net.Conn
+	s *session
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.s.rx.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.s.tx.Add(int64(n))
+	return n, err
+}
+
+// CloseWrite keeps half-close working through the wrapper.
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -3,6 +3,7 @@ package tunnel
 
 import (
 	"context"
+	"net"
 	"time"
 )
 
@@ -14,6 +15,40 @@ type Tunnel interface {
 	IsActive() bool
 }
 
+// Dialer is implemented by tunnels that can open connections through
+// themselves. Userspace tunnels have no host interface or routes, so this is
+// the only way traffic reaches them.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Listener is implemented by tunnels that can accept connections on their
+// tunnel addresses, including userspace tunnels the host cannot see.
+type Listener interface {
+	Listen(network, address string) (net.Listener, error)
+	ListenPacket(network, address string) (net.PacketConn, error)
+}
+
+// EventSource is implemented by tunnels that report what happens while they
+// run, such as state changes and log messages from an external process.
+type EventSource interface {
+	Events() <-chan Event
+}
+
+// Event types.
+const (
+	EventState = "state" // the tunnel changed state, e.g. RECONNECTING
+	EventLog   = "log"   // a log message from the tunnel implementation
+	EventFatal = "fatal" // the tunnel stopped with an unrecoverable error
+)
+
+// Event is a notification from a running tunnel.
+type Event struct {
+	Time    time.Time
+	Type    string
+	Message string
+}
+
 // TunnelStatus holds the current state of a VPN tunnel, regardless of protocol.
 type TunnelStatus struct {
 	Connected     bool
@@ -26,4 +61,9 @@ type TunnelStatus struct {
 	RxBytes       int64
 	LastHandshake time.Time
 	InterfaceName string
+	Userspace     bool // runs on a userspace network stack, no host interface
+
+	// HandshakePending is set while a connected tunnel has no live session,
+	// before its first handshake or after the last one expired.
+	HandshakePending bool
 }
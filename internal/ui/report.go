@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProbeStep is one check of a connectivity probe. Skipped steps did not run.
+type ProbeStep struct {
+	Name     string
+	Duration time.Duration
+	Detail   string
+	Err      error
+	Skipped  bool
+}
+
+// RenderProbeReport renders probe steps as a pass/fail list with timings.
+func RenderProbeReport(server string, steps []ProbeStep) string {
+	var sb strings.Builder
+	sb.WriteString(TitleStyle.Render("Connectivity test: "+server) + "\n\n")
+
+	passed := true
+	for _, s := range steps {
+		mark, timing := SuccessStyle.Render("✓"), fmt.Sprintf("%8s", s.Duration.Round(time.Millisecond))
+		detail := DimStyle.Render(s.Detail)
+		switch {
+		case s.Skipped:
+			mark, timing = DimStyle.Render("-"), fmt.Sprintf("%8s", "")
+		case s.Err != nil:
+			mark = ErrorStyle.Render("✗")
+			detail = ErrorStyle.Render(s.Err.Error())
+			passed = false
+		}
+		sb.WriteString(fmt.Sprintf("  %s %-16s %s  %s\n", mark, s.Name, AccentStyle.Render(timing), detail))
+	}
+
+	sb.WriteString("\n")
+	if passed {
+		sb.WriteString(SuccessStyle.Render("PASS") + "\n")
+	} else {
+		sb.WriteString(ErrorStyle.Render("FAIL") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderProbeReportPass(t *testing.T) {
+	result := RenderProbeReport("office", []ProbeStep{
+		{Name: "Handshake", Duration: 42 * time.Millisecond, Detail: "vpn.example.com:51820"},
+		{Name: "Gateway RTT", Skipped: true, Detail: "no gateway"},
+	})
+	for _, want := range []string{"office", "Handshake", "42ms", "no gateway", "PASS"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("RenderProbeReport should contain %q", want)
+		}
+	}
+}
+
+func TestRenderProbeReportFail(t *testing.T) {
+	result := RenderProbeReport("office", []ProbeStep{
+		{Name: "DNS", Err: errors.New("i/o timeout")},
+	})
+	if !strings.Contains(result, "i/o timeout") || !strings.Contains(result, "FAIL") {
+		t.Errorf("RenderProbeReport should report the failure, got %q", result)
+	}
+}
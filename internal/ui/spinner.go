@@ -2,19 +2,37 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
-type ConnectMsg struct{ Err error }
+// ConnectMsg ends the spinner. Hint, if set, is shown under a failure.
+type ConnectMsg struct {
+	Err  error
+	Hint string
+}
+
+// ChallengeMsg asks for a response, such as a one-time password, while the
+// spinner runs. The answer is sent on Reply; Reply is closed if the user
+// cancels instead.
+type ChallengeMsg struct {
+	Prompt string
+	Echo   bool // show the response as it is typed
+	Reply  chan<- string
+}
 
 type SpinnerModel struct {
 	spinner  spinner.Model
 	message  string
 	quitting bool
 	err      error
+	hint     string
+
+	challenge *ChallengeMsg // waiting for the user's response
+	input     []rune
 }
 
 func NewSpinner(message string) SpinnerModel {
@@ -30,7 +48,14 @@ func (m SpinnerModel) Init() tea.Cmd {
 
 func (m SpinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case ChallengeMsg:
+		m.challenge = &msg
+		m.input = nil
+		return m, nil
 	case tea.KeyMsg:
+		if m.challenge != nil {
+			return m.updateChallenge(msg)
+		}
 		if msg.String() == "ctrl+c" || msg.String() == "q" {
 			m.quitting = true
 			return m, tea.Quit
@@ -38,6 +63,7 @@ func (m SpinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ConnectMsg:
 		m.quitting = true
 		m.err = msg.Err
+		m.hint = msg.Hint
 		return m, tea.Quit
 	case spinner.TickMsg:
 		var cmd tea.Cmd
@@ -47,12 +73,46 @@ func (m SpinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateChallenge edits the challenge response.
+func (m SpinnerModel) updateChallenge(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC, tea.KeyEsc:
+		close(m.challenge.Reply)
+		m.challenge = nil
+		m.quitting = true
+		return m, tea.Quit
+	case tea.KeyEnter:
+		m.challenge.Reply <- string(m.input)
+		m.challenge = nil
+		m.input = nil
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.input = append(m.input, msg.Runes...)
+	}
+	return m, nil
+}
+
 func (m SpinnerModel) View() string {
 	if m.quitting {
 		if m.err != nil {
-			return ErrorStyle.Render(fmt.Sprintf("✗ %s\n", m.err))
+			view := ErrorStyle.Render(fmt.Sprintf("✗ %s\n", m.err))
+			if m.hint != "" {
+				view += DimStyle.Render("  "+m.hint) + "\n"
+			}
+			return view
 		}
 		return SuccessStyle.Render("✓ Connected!\n")
 	}
+	if m.challenge != nil {
+		typed := string(m.input)
+		if !m.challenge.Echo {
+			typed = strings.Repeat("•", len(m.input))
+		}
+		return fmt.Sprintf("%s %s\n  %s %s\n", m.spinner.View(), AccentStyle.Render(m.message),
+			LabelStyle.Render(m.challenge.Prompt), typed)
+	}
 	return fmt.Sprintf("%s %s\n", m.spinner.View(), AccentStyle.Render(m.message))
 }
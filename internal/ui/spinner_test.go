@@ -115,3 +115,54 @@ func TestSpinnerInit(t *testing.T) {
 		t.Error("Init() should return spinner tick command")
 	}
 }
+
+func TestSpinnerChallenge(t *testing.T) {
+	reply := make(chan string, 1)
+	var model tea.Model = NewSpinner("test")
+	model, _ = model.Update(ChallengeMsg{Prompt: "Enter OTP", Reply: reply})
+	for _, key := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune("12")},
+		{Type: tea.KeyRunes, Runes: []rune{'q'}},
+		{Type: tea.KeyBackspace},
+		{Type: tea.KeyRunes, Runes: []rune("34")},
+	} {
+		model, _ = model.Update(key)
+	}
+	if model.(SpinnerModel).quitting {
+		t.Fatal("'q' should be typed into the response, not quit")
+	}
+	view := model.View()
+	if !strings.Contains(view, "Enter OTP") || !strings.Contains(view, "••••") || strings.Contains(view, "1234") {
+		t.Errorf("View() should show the prompt and mask the response: %q", view)
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := <-reply; got != "1234" {
+		t.Errorf("reply = %q, want 1234", got)
+	}
+	if strings.Contains(model.View(), "Enter OTP") {
+		t.Error("the prompt should be gone after Enter")
+	}
+}
+
+func TestSpinnerChallengeEcho(t *testing.T) {
+	var model tea.Model = NewSpinner("test")
+	model, _ = model.Update(ChallengeMsg{Prompt: "Token", Echo: true, Reply: make(chan string, 1)})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("987")})
+	if !strings.Contains(model.View(), "987") {
+		t.Errorf("View() should show an echoed response: %q", model.View())
+	}
+}
+
+func TestSpinnerChallengeCancel(t *testing.T) {
+	reply := make(chan string, 1)
+	var model tea.Model = NewSpinner("test")
+	model, _ = model.Update(ChallengeMsg{Prompt: "Enter OTP", Reply: reply})
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if _, ok := <-reply; ok {
+		t.Error("reply should be closed when the challenge is cancelled")
+	}
+	if !model.(SpinnerModel).quitting || cmd == nil {
+		t.Error("ctrl+c should still quit")
+	}
+}
@@ -7,15 +7,44 @@ import (
 )
 
 type StatusInfo struct {
-	Connected    bool
-	Protocol     string
-	ServerName   string
-	Endpoint     string
-	TunnelIP     string
-	ConnectedAt  time.Time
-	TxBytes      int64
-	RxBytes      int64
+	Connected     bool
+	Protocol      string
+	ServerName    string
+	Endpoint      string
+	TunnelIP      string
+	ConnectedAt   time.Time
+	TxBytes       int64
+	RxBytes       int64
 	LastHandshake time.Time
+	Userspace     bool
+	SOCKSProxy    string
+	HTTPProxy     string
+	ProxyConns    []ProxyConn
+	Forwards      []ForwardRow
+
+	// HandshakePending shows the handshake as pending instead of its age
+	HandshakePending bool
+	// Namespace is the network namespace holding the tunnel, if any
+	Namespace string
+}
+
+// ForwardRow is one active port forward.
+type ForwardRow struct {
+	ID          int
+	Proto       string
+	Reverse     bool
+	Local       string
+	Remote      string
+	Connections int
+}
+
+// ProxyConn is one active session on a local proxy listener.
+type ProxyConn struct {
+	Proxy   string
+	Target  string
+	Started time.Time
+	TxBytes int64
+	RxBytes int64
 }
 
 func RenderStatus(s StatusInfo) string {
@@ -27,7 +56,7 @@ func RenderStatus(s StatusInfo) string {
 	if !s.Connected {
 		sb.WriteString(BoxStyle.Render(
 			WarningStyle.Render("● Disconnected") + "\n\n" +
-			DimStyle.Render("Run 'voidvpn connect <server>' to connect."),
+				DimStyle.Render("Run 'voidvpn connect <server>' to connect."),
 		))
 		sb.WriteString("\n")
 		return sb.String()
@@ -39,6 +68,9 @@ func RenderStatus(s StatusInfo) string {
 	if s.Protocol == "openvpn" {
 		protoLabel = "OpenVPN"
 	}
+	if s.Userspace {
+		protoLabel += " (userspace)"
+	}
 
 	content := fmt.Sprintf(
 		"%s\n\n%s %s\n%s %s\n%s %s\n%s %s\n%s %s\n%s %s\n%s %s / %s",
@@ -54,17 +86,79 @@ func RenderStatus(s StatusInfo) string {
 		LabelStyle.Render("Uptime:"),
 		AccentStyle.Render(uptime.String()),
 		LabelStyle.Render("Last Handshake:"),
-		ValueStyle.Render(formatHandshake(s.LastHandshake)),
+		renderHandshake(s),
 		LabelStyle.Render("Traffic:"),
 		AccentStyle.Render("↑ "+FormatBytes(s.TxBytes)),
 		AccentStyle.Render("↓ "+FormatBytes(s.RxBytes)),
 	)
+	if s.Namespace != "" {
+		content += fmt.Sprintf("\n%s %s", LabelStyle.Render("Namespace:"), ValueStyle.Render(s.Namespace))
+	}
+	if s.SOCKSProxy != "" {
+		content += fmt.Sprintf("\n%s %s", LabelStyle.Render("SOCKS5 Proxy:"), ValueStyle.Render(s.SOCKSProxy))
+	}
+	if s.HTTPProxy != "" {
+		content += fmt.Sprintf("\n%s %s", LabelStyle.Render("HTTP Proxy:"), ValueStyle.Render(s.HTTPProxy))
+	}
 
 	sb.WriteString(BoxStyle.Render(content))
 	sb.WriteString("\n")
+	if len(s.Forwards) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(TitleStyle.Render("Port Forwards") + "\n")
+		sb.WriteString(RenderForwards(s.Forwards))
+	}
+	if len(s.ProxyConns) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(renderProxyConns(s.ProxyConns))
+	}
 	return sb.String()
 }
 
+func renderProxyConns(conns []ProxyConn) string {
+	columns := []TableColumn{
+		{Header: "Proxy", Width: 6},
+		{Header: "Target", Width: 32},
+		{Header: "Age", Width: 10},
+		{Header: "Sent", Width: 10},
+		{Header: "Received", Width: 10},
+	}
+	var rows []TableRow
+	for _, c := range conns {
+		age := time.Since(c.Started).Truncate(time.Second).String()
+		rows = append(rows, TableRow{c.Proxy, c.Target, age, FormatBytes(c.TxBytes), FormatBytes(c.RxBytes)})
+	}
+	return TitleStyle.Render("Proxy Connections") + "\n" + RenderTable(columns, rows)
+}
+
+// RenderForwards renders port forwards as a table.
+func RenderForwards(forwards []ForwardRow) string {
+	columns := []TableColumn{
+		{Header: "ID", Width: 4},
+		{Header: "Proto", Width: 5},
+		{Header: "Local", Width: 22},
+		{Header: "", Width: 2},
+		{Header: "Remote", Width: 28},
+		{Header: "Conns", Width: 5},
+	}
+	var rows []TableRow
+	for _, f := range forwards {
+		arrow := "→"
+		if f.Reverse {
+			arrow = "←"
+		}
+		rows = append(rows, TableRow{fmt.Sprint(f.ID), f.Proto, f.Local, arrow, f.Remote, fmt.Sprint(f.Connections)})
+	}
+	return RenderTable(columns, rows)
+}
+
+func renderHandshake(s StatusInfo) string {
+	if s.HandshakePending {
+		return WarningStyle.Render("handshake pending")
+	}
+	return ValueStyle.Render(formatHandshake(s.LastHandshake))
+}
+
 func formatHandshake(t time.Time) string {
 	if t.IsZero() {
 		return "never"
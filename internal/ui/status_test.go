@@ -104,3 +104,48 @@ func TestRenderStatusDisconnectedContent(t *testing.T) {
 		t.Error("should show 'Disconnected'")
 	}
 }
+
+func TestRenderStatusProxies(t *testing.T) {
+	info := StatusInfo{
+		Connected:   true,
+		Protocol:    "wireguard",
+		ServerName:  "my-server",
+		ConnectedAt: time.Now(),
+		HTTPProxy:   "127.0.0.1:8080",
+		ProxyConns: []ProxyConn{
+			{Proxy: "http", Target: "registry.npmjs.org:443", Started: time.Now(), TxBytes: 2048, RxBytes: 4096},
+		},
+	}
+	result := RenderStatus(info)
+	for _, want := range []string{"HTTP Proxy:", "127.0.0.1:8080", "Proxy Connections", "registry.npmjs.org:443"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("RenderStatus should contain %q", want)
+		}
+	}
+}
+
+func TestRenderStatusHandshakePending(t *testing.T) {
+	info := StatusInfo{
+		Connected:        true,
+		Protocol:         "wireguard",
+		ServerName:       "my-server",
+		ConnectedAt:      time.Now(),
+		HandshakePending: true,
+	}
+	if result := RenderStatus(info); !strings.Contains(result, "handshake pending") {
+		t.Error("RenderStatus should show a pending handshake")
+	}
+}
+
+func TestRenderStatusNamespace(t *testing.T) {
+	info := StatusInfo{
+		Connected:   true,
+		Protocol:    "wireguard",
+		ServerName:  "work",
+		ConnectedAt: time.Now(),
+		Namespace:   "voidvpn-work",
+	}
+	if result := RenderStatus(info); !strings.Contains(result, "voidvpn-work") {
+		t.Error("RenderStatus should show the network namespace")
+	}
+}
@@ -0,0 +1,57 @@
+package wireguard
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+// Backend selects the WireGuard implementation used for kernel-mode tunnels.
+type Backend string
+
+const (
+	BackendAuto   Backend = "auto"         // kernel module if available, else wireguard-go
+	BackendKernel Backend = "kernel"       // Linux kernel module only
+	BackendGo     Backend = "wireguard-go" // embedded userspace implementation
+)
+
+// ParseBackend validates a backend name. The empty string means auto.
+func ParseBackend(s string) (Backend, error) {
+	switch Backend(s) {
+	case "", BackendAuto:
+		return BackendAuto, nil
+	case BackendKernel, BackendGo:
+		return Backend(s), nil
+	default:
+		return "", fmt.Errorf("invalid WireGuard backend %q (use auto, kernel or wireguard-go)", s)
+	}
+}
+
+// KernelAvailable reports whether the kernel WireGuard module can be used.
+func KernelAvailable() bool {
+	return kernelAvailable()
+}
+
+// NewTunnelWithBackend creates a TUN-based tunnel using the requested
+// backend. In auto mode it prefers the kernel module and falls back to
+// wireguard-go when the module is missing.
+func NewTunnelWithBackend(serverCfg *config.ServerConfig, privateKey string, backend Backend) (tunnel.Tunnel, error) {
+	switch backend {
+	case BackendGo:
+		return NewTunnel(serverCfg, privateKey), nil
+	case BackendKernel:
+		if !kernelAvailable() {
+			return nil, fmt.Errorf("kernel WireGuard backend requested but the wireguard module is not available")
+		}
+		return newKernelTunnel(serverCfg, privateKey)
+	default:
+		if kernelAvailable() {
+			slog.Debug("using kernel WireGuard backend")
+			return newKernelTunnel(serverCfg, privateKey)
+		}
+		slog.Debug("kernel WireGuard unavailable, using wireguard-go")
+		return NewTunnel(serverCfg, privateKey), nil
+	}
+}
@@ -0,0 +1,56 @@
+package wireguard
+
+import (
+	"testing"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Backend
+		wantErr bool
+	}{
+		{"", BackendAuto, false},
+		{"auto", BackendAuto, false},
+		{"kernel", BackendKernel, false},
+		{"wireguard-go", BackendGo, false},
+		{"boringtun", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBackend(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBackend(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBackend(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewTunnelWithBackend(t *testing.T) {
+	serverCfg := &config.ServerConfig{Name: "test", Address: "10.0.0.2/24"}
+
+	tun, err := NewTunnelWithBackend(serverCfg, "key", BackendGo)
+	if err != nil {
+		t.Fatalf("NewTunnelWithBackend(wireguard-go) error: %v", err)
+	}
+	if _, ok := tun.(*Tunnel); !ok {
+		t.Errorf("wireguard-go backend returned %T, want *Tunnel", tun)
+	}
+
+	if !KernelAvailable() {
+		tun, err := NewTunnelWithBackend(serverCfg, "key", BackendAuto)
+		if err != nil {
+			t.Fatalf("NewTunnelWithBackend(auto) error: %v", err)
+		}
+		if _, ok := tun.(*Tunnel); !ok {
+			t.Errorf("auto without kernel support returned %T, want *Tunnel", tun)
+		}
+		if _, err := NewTunnelWithBackend(serverCfg, "key", BackendKernel); err == nil {
+			t.Error("kernel backend should fail without kernel support")
+		}
+	}
+}
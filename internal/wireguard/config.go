@@ -1,13 +1,19 @@
 package wireguard
 
+import "time"
+
 type TunnelConfig struct {
-	PrivateKey         string
-	Address            string
-	DNS                []string
-	MTU                int
-	PeerPublicKey      string
-	PeerEndpoint       string
-	PeerAllowedIPs     []string
-	PeerPresharedKey   string
+	PrivateKey          string
+	Address             string
+	DNS                 []string
+	MTU                 int
+	AutoMTU             bool // derive MTU from a path MTU probe to PeerEndpoint
+	PeerPublicKey       string
+	PeerEndpoint        string
+	PeerAllowedIPs      []string
+	PeerExcludedIPs     []string
+	PeerPresharedKey    string
 	PersistentKeepalive int
+	FwMark              uint32        // marks the device's own UDP packets; 0 leaves them unmarked
+	HandshakeTimeout    time.Duration // how long Connect waits for the first handshake
 }
@@ -2,8 +2,11 @@ package wireguard
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"net/netip"
 	"strings"
+	"sync"
 
 	"golang.zx2c4.com/wireguard/conn"
 	"golang.zx2c4.com/wireguard/device"
@@ -14,22 +17,86 @@ type Device struct {
 	dev    *device.Device
 	tunDev tun.Device
 	name   string
+
+	mu           sync.Mutex
+	handshakeErr error // last failure to send a handshake initiation
+	sendErr      error // last failure to send data, until read
 }
 
 func NewDevice(tunDev tun.Device, logger *device.Logger) (*Device, error) {
-	bind := conn.NewDefaultBind()
-	dev := device.NewDevice(tunDev, bind, logger)
-
 	name, err := tunDev.Name()
 	if err != nil {
 		name = "unknown"
 	}
+	d := &Device{tunDev: tunDev, name: name}
+
+	// wireguard-go only reports send failures through its logger
+	errorf := logger.Errorf
+	logger = &device.Logger{
+		Verbosef: logger.Verbosef,
+		Errorf: func(format string, args ...any) {
+			d.recordError(format, args)
+			errorf(format, args...)
+		},
+	}
+	d.dev = device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	return d, nil
+}
+
+func (d *Device) recordError(format string, args []any) {
+	if len(args) == 0 {
+		return
+	}
+	err, ok := args[len(args)-1].(error)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case strings.Contains(format, "Failed to send handshake initiation"):
+		d.handshakeErr = err
+	case strings.Contains(format, "Failed to send data packets"):
+		d.sendErr = err
+	}
+}
 
-	return &Device{
-		dev:    dev,
-		tunDev: tunDev,
-		name:   name,
-	}, nil
+// HandshakeSendError returns the last error from sending a handshake
+// initiation, such as a missing route to the endpoint.
+func (d *Device) HandshakeSendError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.handshakeErr
+}
+
+// TakeSendError returns the last error from sending data packets, such as
+// EMSGSIZE after the path MTU dropped, and clears it.
+func (d *Device) TakeSendError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.sendErr
+	d.sendErr = nil
+	return err
+}
+
+// InitiateHandshake starts a handshake with the peer right away instead of
+// waiting for outbound traffic or a keepalive to trigger one.
+func (d *Device) InitiateHandshake(peerPublicKey string) error {
+	pubHex, err := keyToHex(peerPublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid peer public key: %w", err)
+	}
+	var key device.NoisePublicKey
+	if err := key.FromHex(pubHex); err != nil {
+		return fmt.Errorf("invalid peer public key: %w", err)
+	}
+	peer := d.dev.LookupPeer(key)
+	if peer == nil {
+		return fmt.Errorf("peer is not configured")
+	}
+	// A keepalive with no session queues a handshake initiation
+	peer.SendKeepalive()
+	return nil
 }
 
 func (d *Device) Configure(cfg *TunnelConfig) error {
@@ -40,6 +107,60 @@ func (d *Device) Configure(cfg *TunnelConfig) error {
 	return d.dev.IpcSet(ipcConfig)
 }
 
+// AddAllowedIPs appends prefixes to the allowed IPs of an already configured
+// peer without touching the rest of the device configuration.
+func (d *Device) AddAllowedIPs(peerPublicKey string, prefixes []netip.Prefix) error {
+	pubHex, err := keyToHex(peerPublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid peer public key: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("public_key=%s\n", pubHex))
+	sb.WriteString("update_only=true\n")
+	for _, p := range prefixes {
+		sb.WriteString(fmt.Sprintf("allowed_ip=%s\n", p))
+	}
+	return d.dev.IpcSet(sb.String())
+}
+
+// ReplaceAllowedIPs sets the allowed IPs of an already configured peer to
+// prefixes, dropping any others.
+func (d *Device) ReplaceAllowedIPs(peerPublicKey string, prefixes []netip.Prefix) error {
+	pubHex, err := keyToHex(peerPublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid peer public key: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("public_key=%s\n", pubHex))
+	sb.WriteString("update_only=true\n")
+	sb.WriteString("replace_allowed_ips=true\n")
+	for _, p := range prefixes {
+		sb.WriteString(fmt.Sprintf("allowed_ip=%s\n", p))
+	}
+	return d.dev.IpcSet(sb.String())
+}
+
+// ServeUAPI opens the standard WireGuard UAPI socket for the device, so tools
+// like `wg show` and `wg set` can query and configure it. Closing the
+// returned listener removes the socket.
+func (d *Device) ServeUAPI() (io.Closer, error) {
+	ln, err := listenUAPI(d.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UAPI socket for %s: %w", d.name, err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				slog.Debug("UAPI listener stopped", "interface", d.name, "error", err)
+				return
+			}
+			go d.dev.IpcHandle(conn)
+		}
+	}()
+	return ln, nil
+}
+
 func (d *Device) Up() error {
 	return d.dev.Up()
 }
@@ -1,6 +1,7 @@
 package wireguard
 
 import (
+	"syscall"
 	"testing"
 )
 
@@ -90,3 +91,18 @@ func TestParseAddressAllZeros(t *testing.T) {
 		t.Errorf("bits = %d, want 0", prefix.Bits())
 	}
 }
+
+func TestDeviceRecordsSendErrors(t *testing.T) {
+	d := &Device{}
+	d.recordError("%v - Failed to send handshake initiation: %v", []any{"peer", syscall.ENETUNREACH})
+	d.recordError("%v - Failed to send data packets: %v", []any{"peer", syscall.EMSGSIZE})
+	if err := d.HandshakeSendError(); err != syscall.ENETUNREACH {
+		t.Errorf("HandshakeSendError() = %v, want ENETUNREACH", err)
+	}
+	if err := d.TakeSendError(); err != syscall.EMSGSIZE {
+		t.Errorf("TakeSendError() = %v, want EMSGSIZE", err)
+	}
+	if err := d.TakeSendError(); err != nil {
+		t.Errorf("TakeSendError() = %v after it was taken, want nil", err)
+	}
+}
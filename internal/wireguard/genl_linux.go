@@ -0,0 +1,252 @@
+//go:build linux
+
+package wireguard
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Generic netlink interface of the kernel module, from
+// include/uapi/linux/wireguard.h.
+const (
+	wgGenlName    = "wireguard"
+	wgGenlVersion = 1
+
+	wgCmdGetDevice = 0
+	wgCmdSetDevice = 1
+
+	wgDeviceAIfname       = 2
+	wgDeviceAPrivateKey   = 3
+	wgDeviceAFlags        = 5
+	wgDeviceAFwmark       = 7
+	wgDeviceAPeers        = 8
+	wgDeviceFReplacePeers = 1
+
+	wgPeerAPublicKey           = 1
+	wgPeerAPresharedKey        = 2
+	wgPeerAFlags               = 3
+	wgPeerAEndpoint            = 4
+	wgPeerAKeepaliveInterval   = 5
+	wgPeerALastHandshakeTime   = 6
+	wgPeerARxBytes             = 7
+	wgPeerATxBytes             = 8
+	wgPeerAAllowedIPs          = 9
+	wgPeerFReplaceAllowedIPs   = 2
+	wgPeerFUpdateOnly          = 4
+	wgLastHandshakeTimespecLen = 16 // struct __kernel_timespec
+
+	wgAllowedIPAFamily   = 1
+	wgAllowedIPAIPAddr   = 2
+	wgAllowedIPACidrMask = 3
+
+	// Entries of nested arrays (peers, allowed IPs) carry no meaningful type
+	wgNestedArrayEntry = 0
+
+	nlaTypeMask = ^uint16(unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+)
+
+// buildSetDevice encodes cfg as WG_CMD_SET_DEVICE attributes that replace the
+// device's key and peers. endpoint is the resolved peer endpoint.
+func buildSetDevice(iface string, cfg *TunnelConfig, endpoint netip.AddrPort, allowed []netip.Prefix) ([]nl.NetlinkRequestData, error) {
+	priv, err := decodeKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	pub, err := decodeKey(cfg.PeerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+
+	attrs := []nl.NetlinkRequestData{
+		nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(iface)),
+		nl.NewRtAttr(wgDeviceAPrivateKey, priv),
+		nl.NewRtAttr(wgDeviceAFlags, nl.Uint32Attr(wgDeviceFReplacePeers)),
+	}
+	if cfg.FwMark != 0 {
+		attrs = append(attrs, nl.NewRtAttr(wgDeviceAFwmark, nl.Uint32Attr(cfg.FwMark)))
+	}
+
+	peers := nl.NewRtAttr(wgDeviceAPeers|unix.NLA_F_NESTED, nil)
+	peer := peers.AddRtAttr(wgNestedArrayEntry|unix.NLA_F_NESTED, nil)
+	peer.AddRtAttr(wgPeerAPublicKey, pub)
+	if cfg.PeerPresharedKey != "" {
+		psk, err := decodeKey(cfg.PeerPresharedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preshared key: %w", err)
+		}
+		peer.AddRtAttr(wgPeerAPresharedKey, psk)
+	}
+	peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFReplaceAllowedIPs))
+	peer.AddRtAttr(wgPeerAEndpoint, encodeSockaddr(endpoint))
+	if cfg.PersistentKeepalive > 0 {
+		peer.AddRtAttr(wgPeerAKeepaliveInterval, nl.Uint16Attr(uint16(cfg.PersistentKeepalive)))
+	}
+	addAllowedIPs(peer, allowed)
+	return append(attrs, peers), nil
+}
+
+// buildAddAllowedIPs encodes an update that appends prefixes to an existing
+// peer, leaving everything else alone.
+func buildAddAllowedIPs(iface, peerPublicKey string, prefixes []netip.Prefix) ([]nl.NetlinkRequestData, error) {
+	pub, err := decodeKey(peerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+	peers := nl.NewRtAttr(wgDeviceAPeers|unix.NLA_F_NESTED, nil)
+	peer := peers.AddRtAttr(wgNestedArrayEntry|unix.NLA_F_NESTED, nil)
+	peer.AddRtAttr(wgPeerAPublicKey, pub)
+	peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFUpdateOnly))
+	addAllowedIPs(peer, prefixes)
+	return []nl.NetlinkRequestData{nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(iface)), peers}, nil
+}
+
+// buildReplaceAllowedIPs encodes an update that sets the allowed IPs of an
+// existing peer to prefixes.
+func buildReplaceAllowedIPs(iface, peerPublicKey string, prefixes []netip.Prefix) ([]nl.NetlinkRequestData, error) {
+	pub, err := decodeKey(peerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+	peers := nl.NewRtAttr(wgDeviceAPeers|unix.NLA_F_NESTED, nil)
+	peer := peers.AddRtAttr(wgNestedArrayEntry|unix.NLA_F_NESTED, nil)
+	peer.AddRtAttr(wgPeerAPublicKey, pub)
+	peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFUpdateOnly|wgPeerFReplaceAllowedIPs))
+	addAllowedIPs(peer, prefixes)
+	return []nl.NetlinkRequestData{nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(iface)), peers}, nil
+}
+
+// buildSetKeepalive encodes an update of only the peer's persistent
+// keepalive interval.
+func buildSetKeepalive(iface, peerPublicKey string, interval uint16) ([]nl.NetlinkRequestData, error) {
+	pub, err := decodeKey(peerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+	peers := nl.NewRtAttr(wgDeviceAPeers|unix.NLA_F_NESTED, nil)
+	peer := peers.AddRtAttr(wgNestedArrayEntry|unix.NLA_F_NESTED, nil)
+	peer.AddRtAttr(wgPeerAPublicKey, pub)
+	peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFUpdateOnly))
+	peer.AddRtAttr(wgPeerAKeepaliveInterval, nl.Uint16Attr(interval))
+	return []nl.NetlinkRequestData{nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(iface)), peers}, nil
+}
+
+func addAllowedIPs(peer *nl.RtAttr, prefixes []netip.Prefix) {
+	list := peer.AddRtAttr(wgPeerAAllowedIPs|unix.NLA_F_NESTED, nil)
+	for _, p := range prefixes {
+		family := uint16(unix.AF_INET)
+		if p.Addr().Is6() {
+			family = unix.AF_INET6
+		}
+		entry := list.AddRtAttr(wgNestedArrayEntry|unix.NLA_F_NESTED, nil)
+		entry.AddRtAttr(wgAllowedIPAFamily, nl.Uint16Attr(family))
+		entry.AddRtAttr(wgAllowedIPAIPAddr, p.Masked().Addr().AsSlice())
+		entry.AddRtAttr(wgAllowedIPACidrMask, nl.Uint8Attr(uint8(p.Bits())))
+	}
+}
+
+// encodeSockaddr returns the sockaddr_in or sockaddr_in6 the kernel expects.
+func encodeSockaddr(ap netip.AddrPort) []byte {
+	addr := ap.Addr().Unmap()
+	if addr.Is4() {
+		b := make([]byte, unix.SizeofSockaddrInet4)
+		nl.NativeEndian().PutUint16(b[0:2], unix.AF_INET)
+		binary.BigEndian.PutUint16(b[2:4], ap.Port())
+		a := addr.As4()
+		copy(b[4:8], a[:])
+		return b
+	}
+	b := make([]byte, unix.SizeofSockaddrInet6)
+	nl.NativeEndian().PutUint16(b[0:2], unix.AF_INET6)
+	binary.BigEndian.PutUint16(b[2:4], ap.Port())
+	a := addr.As16()
+	copy(b[8:24], a[:])
+	return b
+}
+
+// parseDeviceStats sums traffic and takes the latest handshake over all
+// peers in a WG_CMD_GET_DEVICE dump. Each message starts with the genl header.
+func parseDeviceStats(msgs [][]byte) (*DeviceStats, error) {
+	stats := &DeviceStats{}
+	for _, m := range msgs {
+		if len(m) < nl.SizeofGenlmsg {
+			return nil, fmt.Errorf("short WireGuard netlink message")
+		}
+		attrs, err := nl.ParseRouteAttr(m[nl.SizeofGenlmsg:])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attrs {
+			if a.Attr.Type&nlaTypeMask != wgDeviceAPeers {
+				continue
+			}
+			peers, err := nl.ParseRouteAttr(a.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range peers {
+				if err := addPeerStats(stats, p); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+func addPeerStats(stats *DeviceStats, peer syscall.NetlinkRouteAttr) error {
+	attrs, err := nl.ParseRouteAttr(peer.Value)
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type & nlaTypeMask {
+		case wgPeerARxBytes:
+			if len(a.Value) >= 8 {
+				stats.RxBytes += int64(nl.NativeEndian().Uint64(a.Value))
+			}
+		case wgPeerATxBytes:
+			if len(a.Value) >= 8 {
+				stats.TxBytes += int64(nl.NativeEndian().Uint64(a.Value))
+			}
+		case wgPeerALastHandshakeTime:
+			if len(a.Value) >= wgLastHandshakeTimespecLen {
+				sec := int64(nl.NativeEndian().Uint64(a.Value[0:8]))
+				if sec > stats.LastHandshake {
+					stats.LastHandshake = sec
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveEndpoint turns the configured host:port into an address.
+func resolveEndpoint(endpoint string) (netip.AddrPort, error) {
+	if ap, err := netip.ParseAddrPort(endpoint); err == nil {
+		return ap, nil
+	}
+	udp, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("failed to resolve endpoint %q: %w", endpoint, err)
+	}
+	return udp.AddrPort(), nil
+}
+
+func decodeKey(key string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 key: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid key length: expected 32 bytes, got %d", len(b))
+	}
+	return b, nil
+}
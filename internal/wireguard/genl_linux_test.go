@@ -0,0 +1,161 @@
+//go:build linux
+
+package wireguard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+const (
+	testPrivateKey = "AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA="
+	testPublicKey  = "ISIjJCUmJygpKissLS4vMDEyMzQ1Njc4OTo7PD0+P0A="
+)
+
+func serializeAttrs(attrs []nl.NetlinkRequestData) []byte {
+	var b []byte
+	for _, a := range attrs {
+		b = append(b, a.Serialize()...)
+	}
+	return b
+}
+
+func attrMap(t *testing.T, b []byte) map[uint16]syscall.NetlinkRouteAttr {
+	t.Helper()
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		t.Fatalf("ParseRouteAttr error: %v", err)
+	}
+	m := make(map[uint16]syscall.NetlinkRouteAttr)
+	for _, a := range attrs {
+		m[a.Attr.Type&nlaTypeMask] = a
+	}
+	return m
+}
+
+func TestBuildSetDevice(t *testing.T) {
+	cfg := &TunnelConfig{
+		PrivateKey:          testPrivateKey,
+		PeerPublicKey:       testPublicKey,
+		PeerPresharedKey:    testPublicKey,
+		PersistentKeepalive: 25,
+		FwMark:              51820,
+	}
+	endpoint := netip.MustParseAddrPort("203.0.113.1:51820")
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/64")}
+
+	attrs, err := buildSetDevice("voidvpn0", cfg, endpoint, allowed)
+	if err != nil {
+		t.Fatalf("buildSetDevice error: %v", err)
+	}
+	dev := attrMap(t, serializeAttrs(attrs))
+
+	if got := nl.BytesToString(dev[wgDeviceAIfname].Value); got != "voidvpn0" {
+		t.Errorf("ifname = %q, want voidvpn0", got)
+	}
+	priv, _ := base64.StdEncoding.DecodeString(testPrivateKey)
+	if !bytes.Equal(dev[wgDeviceAPrivateKey].Value, priv) {
+		t.Error("private key not encoded")
+	}
+	if got := nl.NativeEndian().Uint32(dev[wgDeviceAFlags].Value); got != wgDeviceFReplacePeers {
+		t.Errorf("device flags = %d, want replace peers", got)
+	}
+	if got := nl.NativeEndian().Uint32(dev[wgDeviceAFwmark].Value); got != 51820 {
+		t.Errorf("fwmark = %d, want 51820", got)
+	}
+
+	peers, err := nl.ParseRouteAttr(dev[wgDeviceAPeers].Value)
+	if err != nil || len(peers) != 1 {
+		t.Fatalf("peers = %d, %v; want 1", len(peers), err)
+	}
+	peer := attrMap(t, peers[0].Value)
+	pub, _ := base64.StdEncoding.DecodeString(testPublicKey)
+	if !bytes.Equal(peer[wgPeerAPublicKey].Value, pub) {
+		t.Error("peer public key not encoded")
+	}
+	if _, ok := peer[wgPeerAPresharedKey]; !ok {
+		t.Error("preshared key missing")
+	}
+	if got := nl.NativeEndian().Uint16(peer[wgPeerAKeepaliveInterval].Value); got != 25 {
+		t.Errorf("keepalive = %d, want 25", got)
+	}
+	if !bytes.Equal(peer[wgPeerAEndpoint].Value, encodeSockaddr(endpoint)) {
+		t.Error("endpoint not encoded as sockaddr_in")
+	}
+
+	ips, err := nl.ParseRouteAttr(peer[wgPeerAAllowedIPs].Value)
+	if err != nil || len(ips) != 2 {
+		t.Fatalf("allowed IPs = %d, %v; want 2", len(ips), err)
+	}
+	v6 := attrMap(t, ips[1].Value)
+	if got := nl.NativeEndian().Uint16(v6[wgAllowedIPAFamily].Value); got != syscall.AF_INET6 {
+		t.Errorf("family = %d, want AF_INET6", got)
+	}
+	if got := v6[wgAllowedIPACidrMask].Value[0]; got != 64 {
+		t.Errorf("cidr = %d, want 64", got)
+	}
+}
+
+func TestBuildSetDeviceInvalidKey(t *testing.T) {
+	cfg := &TunnelConfig{PrivateKey: "short", PeerPublicKey: testPublicKey}
+	if _, err := buildSetDevice("voidvpn0", cfg, netip.MustParseAddrPort("203.0.113.1:51820"), nil); err == nil {
+		t.Error("expected error for invalid private key")
+	}
+}
+
+func TestEncodeSockaddr(t *testing.T) {
+	v4 := encodeSockaddr(netip.MustParseAddrPort("192.0.2.1:51820"))
+	if len(v4) != 16 || nl.NativeEndian().Uint16(v4) != syscall.AF_INET {
+		t.Fatalf("sockaddr_in = %x", v4)
+	}
+	if v4[2] != 0xca || v4[3] != 0x6c || !bytes.Equal(v4[4:8], []byte{192, 0, 2, 1}) {
+		t.Errorf("sockaddr_in port/addr = %x", v4[2:8])
+	}
+
+	v6 := encodeSockaddr(netip.MustParseAddrPort("[2001:db8::1]:51820"))
+	if len(v6) != 28 || nl.NativeEndian().Uint16(v6) != syscall.AF_INET6 {
+		t.Fatalf("sockaddr_in6 = %x", v6)
+	}
+	want := netip.MustParseAddr("2001:db8::1").As16()
+	if !bytes.Equal(v6[8:24], want[:]) {
+		t.Errorf("sockaddr_in6 addr = %x", v6[8:24])
+	}
+}
+
+func TestParseDeviceStats(t *testing.T) {
+	peerAttrs := func(tx, rx uint64, handshake int64) *nl.RtAttr {
+		peer := nl.NewRtAttr(wgNestedArrayEntry|syscall.NLA_F_NESTED, nil)
+		peer.AddRtAttr(wgPeerATxBytes, nl.Uint64Attr(tx))
+		peer.AddRtAttr(wgPeerARxBytes, nl.Uint64Attr(rx))
+		ts := append(nl.Uint64Attr(uint64(handshake)), nl.Uint64Attr(0)...)
+		peer.AddRtAttr(wgPeerALastHandshakeTime, ts)
+		return peer
+	}
+	peers := nl.NewRtAttr(wgDeviceAPeers|syscall.NLA_F_NESTED, nil)
+	peers.AddChild(peerAttrs(100, 200, 1700000000))
+	peers.AddChild(peerAttrs(1, 2, 1700000100))
+
+	msg := append((&nl.Genlmsg{Command: wgCmdGetDevice, Version: wgGenlVersion}).Serialize(),
+		nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated("voidvpn0")).Serialize()...)
+	msg = append(msg, peers.Serialize()...)
+
+	stats, err := parseDeviceStats([][]byte{msg})
+	if err != nil {
+		t.Fatalf("parseDeviceStats error: %v", err)
+	}
+	if stats.TxBytes != 101 || stats.RxBytes != 202 {
+		t.Errorf("traffic = %d/%d, want 101/202", stats.TxBytes, stats.RxBytes)
+	}
+	if stats.LastHandshake != 1700000100 {
+		t.Errorf("LastHandshake = %d, want the latest peer handshake", stats.LastHandshake)
+	}
+
+	if _, err := parseDeviceStats([][]byte{{1}}); err == nil {
+		t.Error("expected error for a truncated message")
+	}
+}
@@ -0,0 +1,132 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultHandshakeTimeout is how long Connect waits for the first handshake
+// when the server does not set handshake_timeout.
+const DefaultHandshakeTimeout = 15 * time.Second
+
+// rejectAfterTime is how long a session stays usable without a new
+// handshake (REJECT_AFTER_TIME in the WireGuard paper).
+const rejectAfterTime = 180 * time.Second
+
+const handshakePollInterval = 100 * time.Millisecond
+
+// HandshakeFailure says why no handshake completed.
+type HandshakeFailure string
+
+const (
+	// HandshakeNoResponse means initiations went out but nothing valid came
+	// back: a wrong key, a server that is down, or UDP filtered on the way.
+	HandshakeNoResponse HandshakeFailure = "no response"
+	// HandshakeUnreachable means initiations could not be sent at all, e.g.
+	// the endpoint does not resolve or there is no route to it.
+	HandshakeUnreachable HandshakeFailure = "endpoint unreachable"
+)
+
+// HandshakeError is returned by Connect when the first handshake does not
+// complete within the timeout.
+type HandshakeError struct {
+	Reason   HandshakeFailure
+	Endpoint string
+	Timeout  time.Duration
+	Err      error // send or resolve error behind HandshakeUnreachable
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Reason == HandshakeUnreachable {
+		return fmt.Sprintf("handshake failed: endpoint %s unreachable: %v", e.Endpoint, e.Err)
+	}
+	return fmt.Sprintf("handshake failed: no response from %s within %s", e.Endpoint, e.Timeout)
+}
+
+// Hint suggests what to check for the failure.
+func (e *HandshakeError) Hint() string {
+	if e.Reason == HandshakeUnreachable {
+		return "Check the endpoint address and this machine's network connection."
+	}
+	return "Check the server public key and your private key, and that UDP to the endpoint is not blocked."
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// handshakeTimeout returns the configured timeout in seconds or the default.
+func handshakeTimeout(seconds int) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return DefaultHandshakeTimeout
+}
+
+// handshakeWatch tells a peer waiting for a handshake from one that is
+// merely idle. Without persistent keepalive an idle peer does not handshake
+// at all, and its expired session is renewed with the next packet.
+type handshakeWatch struct {
+	mu   sync.Mutex
+	last time.Time // latest handshake seen
+	tx   int64     // bytes sent when it was first seen
+}
+
+// pending reports whether a connected peer has no usable session: it never
+// completed a handshake, or its last one has expired and packets (data or
+// handshake initiations) have been sent since without a new one. tx is the
+// peer's sent byte count.
+func (w *handshakeWatch) pending(last time.Time, tx int64) bool {
+	if last.IsZero() {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !last.Equal(w.last) {
+		w.last, w.tx = last, tx
+	}
+	return time.Since(last) > rejectAfterTime && tx > w.tx
+}
+
+// waitHandshake polls stats until the peer reports a handshake. On timeout
+// it classifies the failure using sendErr, the device's last send error if
+// it tracks one, and a probe of the endpoint.
+func waitHandshake(ctx context.Context, endpoint string, timeout time.Duration, stats func() (*DeviceStats, error), sendErr func() error) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	tick := time.NewTicker(handshakePollInterval)
+	defer tick.Stop()
+
+	for {
+		if s, err := stats(); err == nil && s.LastHandshake > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			err := sendErr()
+			if err == nil {
+				err = probeEndpoint(endpoint)
+			}
+			if err != nil {
+				return &HandshakeError{Reason: HandshakeUnreachable, Endpoint: endpoint, Timeout: timeout, Err: err}
+			}
+			return &HandshakeError{Reason: HandshakeNoResponse, Endpoint: endpoint, Timeout: timeout}
+		case <-tick.C:
+		}
+	}
+}
+
+// probeEndpoint checks that the endpoint resolves and that the host has a
+// route to it. A connected UDP socket sends nothing, so this is silent.
+func probeEndpoint(endpoint string) error {
+	c, err := net.Dial("udp", endpoint)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
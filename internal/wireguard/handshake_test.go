@@ -0,0 +1,101 @@
+package wireguard
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitHandshakeCompletes(t *testing.T) {
+	var polls atomic.Int32
+	stats := func() (*DeviceStats, error) {
+		if polls.Add(1) < 3 {
+			return &DeviceStats{}, nil
+		}
+		return &DeviceStats{LastHandshake: time.Now().Unix()}, nil
+	}
+	err := waitHandshake(context.Background(), "127.0.0.1:51820", 5*time.Second, stats, func() error { return nil })
+	if err != nil {
+		t.Fatalf("waitHandshake() error: %v", err)
+	}
+}
+
+func TestWaitHandshakeNoResponse(t *testing.T) {
+	stats := func() (*DeviceStats, error) { return &DeviceStats{}, nil }
+	err := waitHandshake(context.Background(), "127.0.0.1:51820", 200*time.Millisecond, stats, func() error { return nil })
+	var hsErr *HandshakeError
+	if !errors.As(err, &hsErr) {
+		t.Fatalf("waitHandshake() error = %v, want *HandshakeError", err)
+	}
+	if hsErr.Reason != HandshakeNoResponse {
+		t.Errorf("Reason = %q, want %q", hsErr.Reason, HandshakeNoResponse)
+	}
+	if hsErr.Hint() == "" {
+		t.Error("Hint() should not be empty")
+	}
+}
+
+func TestWaitHandshakeUnreachable(t *testing.T) {
+	stats := func() (*DeviceStats, error) { return &DeviceStats{}, nil }
+	sendErr := errors.New("sendto: network is unreachable")
+	err := waitHandshake(context.Background(), "127.0.0.1:51820", 200*time.Millisecond, stats, func() error { return sendErr })
+	var hsErr *HandshakeError
+	if !errors.As(err, &hsErr) || hsErr.Reason != HandshakeUnreachable {
+		t.Fatalf("waitHandshake() error = %v, want endpoint unreachable", err)
+	}
+	if !errors.Is(err, sendErr) {
+		t.Error("HandshakeError should wrap the send error")
+	}
+
+	// An endpoint that does not resolve is unreachable without a send error
+	err = waitHandshake(context.Background(), "does-not-exist.invalid:51820", 200*time.Millisecond, stats, func() error { return nil })
+	if !errors.As(err, &hsErr) || hsErr.Reason != HandshakeUnreachable {
+		t.Errorf("waitHandshake(unresolvable) error = %v, want endpoint unreachable", err)
+	}
+}
+
+func TestWaitHandshakeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats := func() (*DeviceStats, error) { return &DeviceStats{}, nil }
+	err := waitHandshake(ctx, "127.0.0.1:51820", time.Minute, stats, func() error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("waitHandshake() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestHandshakePending(t *testing.T) {
+	var w handshakeWatch
+	if !w.pending(time.Time{}, 0) {
+		t.Error("no handshake yet should be pending")
+	}
+	if w.pending(time.Now().Add(-time.Minute), 100) {
+		t.Error("recent handshake should not be pending")
+	}
+
+	// Idle without persistent keepalive: no new handshake, nothing sent
+	expired := time.Now().Add(-5 * time.Minute)
+	if w.pending(expired, 200) {
+		t.Error("expired handshake of an idle peer should not be pending")
+	}
+	if w.pending(expired, 200) {
+		t.Error("expired handshake should not be pending while nothing is sent")
+	}
+	if !w.pending(expired, 348) {
+		t.Error("expired handshake should be pending once packets wait for a new one")
+	}
+	if w.pending(time.Now(), 500) {
+		t.Error("a new handshake should no longer be pending")
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	if got := handshakeTimeout(0); got != DefaultHandshakeTimeout {
+		t.Errorf("handshakeTimeout(0) = %v, want %v", got, DefaultHandshakeTimeout)
+	}
+	if got := handshakeTimeout(30); got != 30*time.Second {
+		t.Errorf("handshakeTimeout(30) = %v, want 30s", got)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"net/netip"
+	"sort"
 	"strings"
+
+	"github.com/voidvpn/voidvpn/internal/network"
 )
 
 // BuildIPCConfig constructs the IPC configuration string for wireguard-go device.IpcSet().
@@ -16,6 +20,9 @@ func BuildIPCConfig(cfg *TunnelConfig) (string, error) {
 		return "", fmt.Errorf("invalid private key: %w", err)
 	}
 	sb.WriteString(fmt.Sprintf("private_key=%s\n", privHex))
+	if cfg.FwMark != 0 {
+		sb.WriteString(fmt.Sprintf("fwmark=%d\n", cfg.FwMark))
+	}
 
 	// Peer configuration
 	pubHex, err := keyToHex(cfg.PeerPublicKey)
@@ -48,7 +55,17 @@ func BuildIPCConfig(cfg *TunnelConfig) (string, error) {
 		if strings.ContainsAny(allowedIP, "\n\r") {
 			return "", fmt.Errorf("invalid allowed IP: contains newline characters")
 		}
-		sb.WriteString(fmt.Sprintf("allowed_ip=%s\n", allowedIP))
+	}
+	// Subtract excluded ranges so the peer never claims traffic meant to bypass the tunnel
+	allowed, err := network.ComputeAllowedIPs(cfg.PeerAllowedIPs, cfg.PeerExcludedIPs)
+	if err != nil {
+		return "", err
+	}
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("peer AllowedIPs is empty after applying exclusions")
+	}
+	for _, prefix := range allowed {
+		sb.WriteString(fmt.Sprintf("allowed_ip=%s\n", prefix))
 	}
 
 	if cfg.PersistentKeepalive > 0 {
@@ -58,6 +75,21 @@ func BuildIPCConfig(cfg *TunnelConfig) (string, error) {
 	return sb.String(), nil
 }
 
+// peerAllowedIPs returns the peer's AllowedIPs minus ExcludedIPs, followed
+// by the extra prefixes allowed since connecting.
+func peerAllowedIPs(cfg *TunnelConfig, extra map[netip.Prefix]bool) ([]netip.Prefix, error) {
+	allowed, err := network.ComputeAllowedIPs(cfg.PeerAllowedIPs, cfg.PeerExcludedIPs)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []netip.Prefix
+	for p := range extra {
+		prefixes = append(prefixes, p)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].String() < prefixes[j].String() })
+	return append(allowed, prefixes...), nil
+}
+
 // keyToHex converts a base64-encoded WireGuard key to hex encoding for IPC.
 func keyToHex(base64Key string) (string, error) {
 	decoded, err := base64.StdEncoding.DecodeString(base64Key)
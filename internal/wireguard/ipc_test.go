@@ -62,6 +62,32 @@ func TestBuildIPCConfigWithPresharedKey(t *testing.T) {
 	}
 }
 
+func TestBuildIPCConfigFwMark(t *testing.T) {
+	cfg := &TunnelConfig{
+		PrivateKey:     validKey,
+		PeerPublicKey:  validKey,
+		PeerEndpoint:   "1.2.3.4:51820",
+		PeerAllowedIPs: []string{"0.0.0.0/0"},
+		FwMark:         51820,
+	}
+
+	result, err := BuildIPCConfig(cfg)
+	if err != nil {
+		t.Fatalf("BuildIPCConfig() error: %v", err)
+	}
+	// fwmark is a device setting and must come before the first peer
+	mark := strings.Index(result, "fwmark=51820\n")
+	if mark < 0 || mark > strings.Index(result, "public_key=") {
+		t.Errorf("fwmark should be set before the peer section:\n%s", result)
+	}
+
+	cfg.FwMark = 0
+	result, _ = BuildIPCConfig(cfg)
+	if strings.Contains(result, "fwmark=") {
+		t.Error("IPC config should not contain fwmark when unset")
+	}
+}
+
 func TestKeyToHex(t *testing.T) {
 	key := make([]byte, 32)
 	for i := range key {
@@ -238,6 +264,43 @@ func TestBuildIPCConfigEmptyAllowedIPs(t *testing.T) {
 	}
 }
 
+func TestBuildIPCConfigExcludedIPs(t *testing.T) {
+	cfg := &TunnelConfig{
+		PrivateKey:      validKey,
+		PeerPublicKey:   validKey,
+		PeerEndpoint:    "1.2.3.4:51820",
+		PeerAllowedIPs:  []string{"0.0.0.0/0"},
+		PeerExcludedIPs: []string{"128.0.0.0/1"},
+	}
+	result, err := BuildIPCConfig(cfg)
+	if err != nil {
+		t.Fatalf("BuildIPCConfig() error: %v", err)
+	}
+	if !strings.Contains(result, "allowed_ip=0.0.0.0/1\n") {
+		t.Errorf("IPC config should contain the remaining half, got:\n%s", result)
+	}
+	if strings.Contains(result, "allowed_ip=0.0.0.0/0") {
+		t.Error("IPC config should not contain the unmodified default route")
+	}
+}
+
+func TestBuildIPCConfigEverythingExcluded(t *testing.T) {
+	cfg := &TunnelConfig{
+		PrivateKey:      validKey,
+		PeerPublicKey:   validKey,
+		PeerEndpoint:    "1.2.3.4:51820",
+		PeerAllowedIPs:  []string{"10.0.0.0/8"},
+		PeerExcludedIPs: []string{"0.0.0.0/0"},
+	}
+	_, err := BuildIPCConfig(cfg)
+	if err == nil {
+		t.Fatal("expected error when exclusions remove every allowed IP")
+	}
+	if !strings.Contains(err.Error(), "exclusions") {
+		t.Errorf("error should mention exclusions: %v", err)
+	}
+}
+
 func TestKeyToHexEmptyString(t *testing.T) {
 	_, err := keyToHex("")
 	if err == nil {
@@ -0,0 +1,278 @@
+//go:build linux
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/network"
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+// KernelTunnel drives the in-kernel WireGuard module: the link is created
+// over rtnetlink and configured through the "wireguard" generic netlink
+// family. It is a drop-in replacement for Tunnel on Linux.
+type KernelTunnel struct {
+	config      *TunnelConfig
+	server      *config.ServerConfig
+	link        netlink.Link
+	family      uint16 // generic netlink family id
+	connectedAt time.Time
+	cancel      context.CancelFunc
+
+	prefixMu sync.Mutex
+	prefixes map[netip.Prefix]bool // allowed with AllowPrefix
+
+	handshakes handshakeWatch
+}
+
+// NewKernelTunnel creates a kernel-backed tunnel. Check KernelAvailable first.
+func NewKernelTunnel(serverCfg *config.ServerConfig, privateKey string) *KernelTunnel {
+	return &KernelTunnel{
+		config: newTunnelConfig(serverCfg, privateKey),
+		server: serverCfg,
+	}
+}
+
+func newKernelTunnel(serverCfg *config.ServerConfig, privateKey string) (tunnel.Tunnel, error) {
+	return NewKernelTunnel(serverCfg, privateKey), nil
+}
+
+// kernelAvailable reports whether the WireGuard module is usable, by
+// resolving its generic netlink family. The lookup has no side effects on
+// the host; the kernel loads the module for it if it is installed, as the
+// module registers an alias for the family.
+func kernelAvailable() bool {
+	_, err := netlink.GenlFamilyGet(wgGenlName)
+	return err == nil
+}
+
+func (t *KernelTunnel) Connect(ctx context.Context) error {
+	family, err := netlink.GenlFamilyGet(wgGenlName)
+	if err != nil {
+		return fmt.Errorf("kernel WireGuard is not available: %w", err)
+	}
+	t.family = family.ID
+
+	endpoint, err := resolveEndpoint(t.config.PeerEndpoint)
+	if err != nil {
+		return err
+	}
+	allowed, err := network.ComputeAllowedIPs(t.config.PeerAllowedIPs, t.config.PeerExcludedIPs)
+	if err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("peer AllowedIPs is empty after applying exclusions")
+	}
+	attrs, err := buildSetDevice(InterfaceName, t.config, endpoint, allowed)
+	if err != nil {
+		return fmt.Errorf("failed to build device config: %w", err)
+	}
+
+	resolveMTU(t.config)
+	mtu := t.config.MTU
+	slog.Debug("creating kernel WireGuard link", "name", InterfaceName, "mtu", mtu)
+	link := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: InterfaceName, MTU: mtu}}
+	if err := netlink.LinkAdd(link); err != nil {
+		return fmt.Errorf("failed to create WireGuard link: %w", err)
+	}
+	t.link = link
+
+	slog.Debug("configuring kernel WireGuard device", "endpoint", endpoint, "allowed_ips", len(allowed))
+	if err := t.genlSet(attrs); err != nil {
+		t.deleteLink()
+		return fmt.Errorf("failed to configure device: %w", err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.deleteLink()
+		return fmt.Errorf("failed to bring device up: %w", err)
+	}
+
+	// Only report success once the server has answered
+	if err := t.initiateHandshake(); err != nil {
+		slog.Debug("failed to initiate handshake", "error", err)
+	}
+	slog.Debug("waiting for handshake", "endpoint", endpoint, "timeout", t.config.HandshakeTimeout)
+	noSendErr := func() error { return nil }
+	if err := waitHandshake(ctx, t.config.PeerEndpoint, t.config.HandshakeTimeout, t.stats, noSendErr); err != nil {
+		t.deleteLink()
+		return err
+	}
+
+	if t.config.AutoMTU {
+		ctx, t.cancel = context.WithCancel(ctx)
+		go watchPathMTU(ctx, *t.config, t.stats, noSendErr, func(mtu int) error {
+			return netlink.LinkSetMTU(link, mtu)
+		})
+	}
+
+	t.connectedAt = time.Now()
+	slog.Info("WireGuard tunnel connected", "server", t.server.Name, "endpoint", t.server.Endpoint, "backend", "kernel")
+	return nil
+}
+
+// initiateHandshake makes the module send a keepalive, and with it a
+// handshake initiation, by raising the persistent keepalive interval from
+// zero; the module only sends one on that transition. The configured
+// interval is left in place afterwards.
+func (t *KernelTunnel) initiateHandshake() error {
+	intervals := []uint16{0, uint16(t.config.PersistentKeepalive)}
+	if t.config.PersistentKeepalive == 0 {
+		intervals = []uint16{0, 1, 0}
+	}
+	for _, interval := range intervals {
+		attrs, err := buildSetKeepalive(InterfaceName, t.config.PeerPublicKey, interval)
+		if err != nil {
+			return err
+		}
+		if err := t.genlSet(attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *KernelTunnel) Disconnect() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.deleteLink()
+	slog.Info("WireGuard tunnel disconnected", "server", t.server.Name)
+	return nil
+}
+
+func (t *KernelTunnel) deleteLink() {
+	if t.link == nil {
+		return
+	}
+	if err := netlink.LinkDel(t.link); err != nil {
+		slog.Warn("failed to delete WireGuard link", "name", InterfaceName, "error", err)
+	}
+	t.link = nil
+}
+
+func (t *KernelTunnel) Status() (*tunnel.TunnelStatus, error) {
+	status := &tunnel.TunnelStatus{
+		Protocol:   "wireguard",
+		ServerName: t.server.Name,
+		Endpoint:   t.server.Endpoint,
+		TunnelIP:   t.config.Address,
+		Connected:  t.link != nil,
+	}
+
+	if t.link != nil {
+		status.ConnectedAt = t.connectedAt
+		if stats, err := t.stats(); err == nil {
+			status.TxBytes = stats.TxBytes
+			status.RxBytes = stats.RxBytes
+			if stats.LastHandshake > 0 {
+				status.LastHandshake = time.Unix(stats.LastHandshake, 0)
+			}
+		}
+		status.HandshakePending = t.handshakes.pending(status.LastHandshake, status.TxBytes)
+		status.InterfaceName = InterfaceName
+	}
+	return status, nil
+}
+
+func (t *KernelTunnel) IsActive() bool {
+	return t.link != nil
+}
+
+// SetFwMark marks the tunnel's own UDP packets, like Tunnel.SetFwMark.
+func (t *KernelTunnel) SetFwMark(mark uint32) {
+	t.config.FwMark = mark
+}
+
+// AllowPrefix lets the peer carry traffic for prefix, like Tunnel.AllowPrefix.
+func (t *KernelTunnel) AllowPrefix(prefix netip.Prefix) error {
+	if t.link == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+	t.prefixMu.Lock()
+	defer t.prefixMu.Unlock()
+	attrs, err := buildAddAllowedIPs(InterfaceName, t.config.PeerPublicKey, []netip.Prefix{prefix})
+	if err != nil {
+		return err
+	}
+	if err := t.genlSet(attrs); err != nil {
+		return err
+	}
+	if t.prefixes == nil {
+		t.prefixes = make(map[netip.Prefix]bool)
+	}
+	t.prefixes[prefix] = true
+	return nil
+}
+
+// RemovePrefix undoes AllowPrefix, like Tunnel.RemovePrefix.
+func (t *KernelTunnel) RemovePrefix(prefix netip.Prefix) error {
+	if t.link == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+	t.prefixMu.Lock()
+	defer t.prefixMu.Unlock()
+	if !t.prefixes[prefix] {
+		return nil
+	}
+	delete(t.prefixes, prefix)
+	allowed, err := peerAllowedIPs(t.config, t.prefixes)
+	if err != nil {
+		return err
+	}
+	attrs, err := buildReplaceAllowedIPs(InterfaceName, t.config.PeerPublicKey, allowed)
+	if err != nil {
+		return err
+	}
+	return t.genlSet(attrs)
+}
+
+// DialContext dials through the host routes, resolving names with the
+// server's DNS, as Tunnel does in kernel TUN mode.
+func (t *KernelTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{Resolver: serverResolver(t.config.DNS)}
+	return d.DialContext(ctx, network, address)
+}
+
+// Listen binds a tunnel address on the host.
+func (t *KernelTunnel) Listen(network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
+
+// ListenPacket is the UDP counterpart of Listen.
+func (t *KernelTunnel) ListenPacket(network, address string) (net.PacketConn, error) {
+	return net.ListenPacket(network, address)
+}
+
+func (t *KernelTunnel) stats() (*DeviceStats, error) {
+	req := nl.NewNetlinkRequest(int(t.family), unix.NLM_F_DUMP)
+	req.AddData(&nl.Genlmsg{Command: wgCmdGetDevice, Version: wgGenlVersion})
+	req.AddData(nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(InterfaceName)))
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device stats: %w", err)
+	}
+	return parseDeviceStats(msgs)
+}
+
+func (t *KernelTunnel) genlSet(attrs []nl.NetlinkRequestData) error {
+	req := nl.NewNetlinkRequest(int(t.family), unix.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: wgCmdSetDevice, Version: wgGenlVersion})
+	for _, a := range attrs {
+		req.AddData(a)
+	}
+	_, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package wireguard
+
+import (
+	"fmt"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/tunnel"
+)
+
+func kernelAvailable() bool {
+	return false
+}
+
+func newKernelTunnel(serverCfg *config.ServerConfig, privateKey string) (tunnel.Tunnel, error) {
+	return nil, fmt.Errorf("kernel WireGuard backend is only available on Linux")
+}
@@ -0,0 +1,92 @@
+package wireguard
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/voidvpn/voidvpn/internal/network"
+)
+
+// Swapped out in tests.
+var (
+	// mtuRecheckInterval is how often a tunnel with AutoMTU checks whether
+	// its path needs a re-probe.
+	mtuRecheckInterval = 30 * time.Second
+	probeTunnelMTU     = network.ProbeTunnelMTU
+)
+
+// resolveMTU sets cfg.MTU from a path MTU probe when AutoMTU is on. If the
+// probe fails, the configured MTU (or the default) is kept.
+func resolveMTU(cfg *TunnelConfig) {
+	if cfg.MTU == 0 {
+		cfg.MTU = network.DefaultTunnelMTU
+	}
+	if !cfg.AutoMTU {
+		return
+	}
+	mtu, err := probeTunnelMTU(cfg.PeerEndpoint, cfg.FwMark)
+	if err != nil {
+		slog.Warn("path MTU probe failed, using configured MTU", "endpoint", cfg.PeerEndpoint, "mtu", cfg.MTU, "error", err)
+		return
+	}
+	slog.Info("path MTU probed", "endpoint", cfg.PeerEndpoint, "mtu", mtu)
+	cfg.MTU = mtu
+}
+
+// watchPathMTU re-probes the path while the tunnel is up. When a router
+// drops oversized tunnel packets it answers with ICMP "fragmentation needed",
+// which lowers the kernel's path MTU estimate for the endpoint; the next
+// probe sees it and the tunnel MTU is lowered with setMTU. The MTU is never
+// raised again, since stalls cost more than a few bytes per packet.
+//
+// Probes are full-size packets to the endpoint, so they are only sent when
+// something looks wrong: sendErr, the device's last data send error if it
+// tracks one, reports EMSGSIZE, or packets went out since the last check
+// and nothing came back. An idle tunnel is never probed.
+func watchPathMTU(ctx context.Context, cfg TunnelConfig, stats func() (*DeviceStats, error), sendErr func() error, setMTU func(int) error) {
+	current := cfg.MTU
+	var lastTx, lastRx int64
+	if s, err := stats(); err == nil {
+		lastTx, lastRx = s.TxBytes, s.RxBytes
+	}
+	ticker := time.NewTicker(mtuRecheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reason := ""
+		if err := sendErr(); errors.Is(err, syscall.EMSGSIZE) {
+			reason = "message too long"
+		}
+		if s, err := stats(); err == nil {
+			if reason == "" && s.TxBytes > lastTx && s.RxBytes == lastRx {
+				reason = "traffic stalled"
+			}
+			lastTx, lastRx = s.TxBytes, s.RxBytes
+		}
+		if reason == "" {
+			continue
+		}
+
+		mtu, err := probeTunnelMTU(cfg.PeerEndpoint, cfg.FwMark)
+		if err != nil {
+			slog.Debug("path MTU re-probe failed", "reason", reason, "error", err)
+			continue
+		}
+		if mtu >= current {
+			continue
+		}
+		slog.Warn("path MTU dropped, lowering tunnel MTU", "endpoint", cfg.PeerEndpoint, "reason", reason, "from", current, "to", mtu)
+		if err := setMTU(mtu); err != nil {
+			slog.Warn("failed to lower tunnel MTU", "error", err)
+			return
+		}
+		current = mtu
+	}
+}
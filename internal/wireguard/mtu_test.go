@@ -0,0 +1,156 @@
+package wireguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func stubProbe(t *testing.T, probe func(string, uint32) (int, error)) {
+	t.Helper()
+	orig := probeTunnelMTU
+	probeTunnelMTU = probe
+	t.Cleanup(func() { probeTunnelMTU = orig })
+}
+
+func TestResolveMTU(t *testing.T) {
+	stubProbe(t, func(string, uint32) (int, error) { return 1432, nil })
+
+	cfg := &TunnelConfig{MTU: 1420, AutoMTU: true}
+	resolveMTU(cfg)
+	if cfg.MTU != 1432 {
+		t.Errorf("MTU = %d, want probed 1432", cfg.MTU)
+	}
+
+	cfg = &TunnelConfig{MTU: 1380}
+	resolveMTU(cfg)
+	if cfg.MTU != 1380 {
+		t.Errorf("MTU = %d, want configured 1380 without AutoMTU", cfg.MTU)
+	}
+
+	cfg = &TunnelConfig{}
+	resolveMTU(cfg)
+	if cfg.MTU != 1420 {
+		t.Errorf("MTU = %d, want default 1420", cfg.MTU)
+	}
+}
+
+func TestResolveMTUProbeFails(t *testing.T) {
+	stubProbe(t, func(string, uint32) (int, error) { return 0, errors.New("no route") })
+	cfg := &TunnelConfig{MTU: 1400, AutoMTU: true}
+	resolveMTU(cfg)
+	if cfg.MTU != 1400 {
+		t.Errorf("MTU = %d, want configured 1400 after a failed probe", cfg.MTU)
+	}
+}
+
+func TestWatchPathMTULowersOnly(t *testing.T) {
+	orig := mtuRecheckInterval
+	mtuRecheckInterval = 5 * time.Millisecond
+	t.Cleanup(func() { mtuRecheckInterval = orig })
+
+	probes := make(chan int, 3)
+	probes <- 1500
+	probes <- 1372
+	probes <- 1440
+	stubProbe(t, func(string, uint32) (int, error) {
+		select {
+		case mtu := <-probes:
+			return mtu, nil
+		default:
+			return 1440, nil
+		}
+	})
+
+	set := make(chan int, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		watchPathMTU(ctx, TunnelConfig{MTU: 1420}, stalledStats(), noSendError, func(mtu int) error {
+			set <- mtu
+			return nil
+		})
+	}()
+
+	select {
+	case mtu := <-set:
+		if mtu != 1372 {
+			t.Errorf("setMTU(%d), want 1372", mtu)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("MTU was not lowered")
+	}
+	select {
+	case mtu := <-set:
+		t.Errorf("setMTU(%d) called again; the MTU should never be raised", mtu)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func noSendError() error { return nil }
+
+// stalledStats reports more sent bytes on every call and nothing received.
+func stalledStats() func() (*DeviceStats, error) {
+	var tx atomic.Int64
+	return func() (*DeviceStats, error) {
+		return &DeviceStats{TxBytes: tx.Add(100)}, nil
+	}
+}
+
+func TestWatchPathMTUProbesOnlyWhenNeeded(t *testing.T) {
+	orig := mtuRecheckInterval
+	mtuRecheckInterval = 5 * time.Millisecond
+	t.Cleanup(func() { mtuRecheckInterval = orig })
+
+	var probes atomic.Int32
+	stubProbe(t, func(string, uint32) (int, error) {
+		probes.Add(1)
+		return 1420, nil
+	})
+	run := func(stats func() (*DeviceStats, error), sendErr func() error) int32 {
+		probes.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		watchPathMTU(ctx, TunnelConfig{MTU: 1420}, stats, sendErr, func(int) error { return nil })
+		return probes.Load()
+	}
+
+	idle := func() (*DeviceStats, error) { return &DeviceStats{TxBytes: 100, RxBytes: 100}, nil }
+	if n := run(idle, noSendError); n != 0 {
+		t.Errorf("idle tunnel was probed %d times, want none", n)
+	}
+
+	var rx atomic.Int64
+	flowing := func() (*DeviceStats, error) {
+		n := rx.Add(100)
+		return &DeviceStats{TxBytes: n, RxBytes: n}, nil
+	}
+	if n := run(flowing, noSendError); n != 0 {
+		t.Errorf("tunnel with replies was probed %d times, want none", n)
+	}
+
+	if n := run(stalledStats(), noSendError); n == 0 {
+		t.Error("stalled tunnel should be probed")
+	}
+
+	var once atomic.Bool
+	tooLong := func() error {
+		if once.CompareAndSwap(false, true) {
+			return &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmsg", syscall.EMSGSIZE)}
+		}
+		return nil
+	}
+	if n := run(idle, tooLong); n != 1 {
+		t.Errorf("EMSGSIZE led to %d probes, want 1", n)
+	}
+}
@@ -0,0 +1,71 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Ping sends one ICMP echo to addr through a userspace tunnel and returns the
+// round-trip time.
+func (t *Tunnel) Ping(ctx context.Context, addr netip.Addr) (time.Duration, error) {
+	if !t.userspace || t.net == nil {
+		return 0, fmt.Errorf("ping is only available on a connected userspace tunnel")
+	}
+	conn, err := t.net.DialPingAddr(netip.Addr{}, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1 // ICMP
+	if addr.Is6() {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = 58 // ICMPv6
+	}
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("voidvpn")},
+	}
+	req, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == 1 {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// LookupHost resolves host with the server's DNS through a userspace tunnel.
+func (t *Tunnel) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if !t.userspace || t.net == nil {
+		return nil, fmt.Errorf("lookup is only available on a connected userspace tunnel")
+	}
+	return t.net.LookupContextHost(ctx, host)
+}
@@ -0,0 +1,152 @@
+package wireguard
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+
+	"github.com/voidvpn/voidvpn/internal/config"
+)
+
+// serveDNS answers every A query sent to 10.0.0.1:53 on tnet with 10.0.0.9.
+func serveDNS(t *testing.T, tnet *netstack.Net) {
+	t.Helper()
+	pc, err := tnet.ListenUDPAddrPort(netip.MustParseAddrPort("10.0.0.1:53"))
+	if err != nil {
+		t.Fatalf("ListenUDPAddrPort() error: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			q := msg.Questions[0]
+			msg.Header.Response = true
+			if q.Type == dnsmessage.TypeA {
+				msg.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 9}},
+				}}
+			}
+			if out, err := msg.Pack(); err == nil {
+				pc.WriteTo(out, from)
+			}
+		}
+	}()
+}
+
+func TestTunnelPingAndLookup(t *testing.T) {
+	client, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	serverPub, endpoint, peerNet := startPeer(t, client.PublicKey)
+	serveDNS(t, peerNet)
+
+	tun := NewUserspaceTunnel(&config.ServerConfig{
+		Name:       "test",
+		Endpoint:   endpoint,
+		PublicKey:  serverPub,
+		Address:    "10.0.0.2/24",
+		DNS:        []string{"10.0.0.1"},
+		AllowedIPs: []string{"10.0.0.0/24"},
+	}, client.PrivateKey)
+	if err := tun.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer tun.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rtt, err := tun.Ping(ctx, netip.MustParseAddr("10.0.0.1"))
+	if err != nil {
+		t.Fatalf("Ping() error: %v", err)
+	}
+	if rtt <= 0 {
+		t.Errorf("Ping() rtt = %v, want > 0", rtt)
+	}
+
+	addrs, err := tun.LookupHost(ctx, "probe.example.com")
+	if err != nil {
+		t.Fatalf("LookupHost() error: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "10.0.0.9" {
+		t.Errorf("LookupHost() = %v, want [10.0.0.9]", addrs)
+	}
+}
+
+func TestTunnelAllowAndRemovePrefix(t *testing.T) {
+	client, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	serverPub, endpoint, _ := startPeer(t, client.PublicKey)
+
+	tun := NewUserspaceTunnel(&config.ServerConfig{
+		Name:       "test",
+		Endpoint:   endpoint,
+		PublicKey:  serverPub,
+		Address:    "10.0.0.2/24",
+		AllowedIPs: []string{"10.0.0.0/24"},
+	}, client.PrivateKey)
+	if err := tun.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer tun.Disconnect()
+
+	allowedIPs := func() []string {
+		t.Helper()
+		conf, err := tun.device.dev.IpcGet()
+		if err != nil {
+			t.Fatalf("IpcGet() error: %v", err)
+		}
+		var ips []string
+		for _, line := range strings.Split(conf, "\n") {
+			if ip, ok := strings.CutPrefix(line, "allowed_ip="); ok {
+				ips = append(ips, ip)
+			}
+		}
+		sort.Strings(ips)
+		return ips
+	}
+
+	a, b := netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("198.51.100.7/32")
+	for _, p := range []netip.Prefix{a, b} {
+		if err := tun.AllowPrefix(p); err != nil {
+			t.Fatalf("AllowPrefix(%s) error: %v", p, err)
+		}
+	}
+	if got := strings.Join(allowedIPs(), " "); got != "10.0.0.0/24 192.0.2.1/32 198.51.100.7/32" {
+		t.Errorf("allowed IPs = %s, want the configured ones and both prefixes", got)
+	}
+
+	if err := tun.RemovePrefix(a); err != nil {
+		t.Fatalf("RemovePrefix() error: %v", err)
+	}
+	if got := strings.Join(allowedIPs(), " "); got != "10.0.0.0/24 198.51.100.7/32" {
+		t.Errorf("allowed IPs = %s, want %s gone", got, a)
+	}
+}
+
+func TestTunnelPingRequiresUserspace(t *testing.T) {
+	tun := NewTunnel(&config.ServerConfig{Name: "test"}, "key")
+	if _, err := tun.Ping(context.Background(), netip.MustParseAddr("10.0.0.1")); err == nil {
+		t.Error("Ping should fail on a kernel-mode tunnel")
+	}
+	if _, err := tun.LookupHost(context.Background(), "example.com"); err == nil {
+		t.Error("LookupHost should fail on a kernel-mode tunnel")
+	}
+}
@@ -3,40 +3,83 @@ package wireguard
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
 
 	"github.com/voidvpn/voidvpn/internal/config"
+	"github.com/voidvpn/voidvpn/internal/network"
 	"github.com/voidvpn/voidvpn/internal/platform"
 	"github.com/voidvpn/voidvpn/internal/tunnel"
 )
 
+// InterfaceName is the name of the tunnel interface on the host.
+const InterfaceName = "voidvpn0"
+
 type Tunnel struct {
 	config      *TunnelConfig
 	server      *config.ServerConfig
 	device      *Device
+	userspace   bool
+	net         *netstack.Net // set in userspace mode
 	cancelFunc  context.CancelFunc
 	connectedAt time.Time
+
+	prefixMu sync.Mutex
+	prefixes map[netip.Prefix]bool // allowed with AllowPrefix
+
+	handshakes handshakeWatch
 }
 
 func NewTunnel(serverCfg *config.ServerConfig, privateKey string) *Tunnel {
-	tunnelCfg := &TunnelConfig{
+	return &Tunnel{
+		config: newTunnelConfig(serverCfg, privateKey),
+		server: serverCfg,
+	}
+}
+
+// newTunnelConfig builds the device configuration shared by all backends.
+func newTunnelConfig(serverCfg *config.ServerConfig, privateKey string) *TunnelConfig {
+	return &TunnelConfig{
 		PrivateKey:          privateKey,
 		Address:             serverCfg.Address,
 		DNS:                 serverCfg.DNS,
 		MTU:                 serverCfg.MTU,
+		AutoMTU:             serverCfg.AutoMTU,
 		PeerPublicKey:       serverCfg.PublicKey,
 		PeerEndpoint:        serverCfg.Endpoint,
 		PeerAllowedIPs:      serverCfg.AllowedIPs,
+		PeerExcludedIPs:     serverCfg.ExcludeIPs,
 		PeerPresharedKey:    serverCfg.PresharedKey,
 		PersistentKeepalive: serverCfg.PersistentKeepalive,
+		HandshakeTimeout:    handshakeTimeout(serverCfg.HandshakeTimeout),
 	}
+}
 
-	return &Tunnel{
-		config: tunnelCfg,
-		server: serverCfg,
+// NewUserspaceTunnel creates a tunnel on a gVisor netstack instead of a kernel
+// TUN device. It needs no privileges and leaves host addresses, routes and
+// DNS alone; traffic enters the tunnel only through DialContext.
+func NewUserspaceTunnel(serverCfg *config.ServerConfig, privateKey string) *Tunnel {
+	t := NewTunnel(serverCfg, privateKey)
+	t.userspace = true
+	return t
+}
+
+// SetFwMark marks the tunnel's own UDP packets so policy routing can tell
+// them apart. It must be called before Connect and is ignored in userspace
+// mode, where setting a socket mark needs CAP_NET_ADMIN and there are no
+// routes to select.
+func (t *Tunnel) SetFwMark(mark uint32) {
+	if !t.userspace {
+		t.config.FwMark = mark
 	}
 }
 
@@ -44,9 +87,18 @@ func (t *Tunnel) Connect(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	t.cancelFunc = cancel
 
+	resolveMTU(t.config)
+
 	// Create TUN device
-	slog.Debug("creating TUN device", "name", "voidvpn0", "mtu", t.config.MTU)
-	tunDev, err := platform.CreateTUN("voidvpn0", t.config.MTU)
+	var tunDev tun.Device
+	var err error
+	if t.userspace {
+		slog.Debug("creating userspace network stack", "address", t.config.Address, "mtu", t.config.MTU)
+		tunDev, t.net, err = createNetstackTUN(t.config)
+	} else {
+		slog.Debug("creating TUN device", "name", InterfaceName, "mtu", t.config.MTU)
+		tunDev, err = platform.CreateTUN(InterfaceName, t.config.MTU)
+	}
 	if err != nil {
 		cancel()
 		return fmt.Errorf("failed to create TUN device: %w", err)
@@ -77,6 +129,24 @@ func (t *Tunnel) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to bring device up: %w", err)
 	}
 
+	// Only report success once the server has answered
+	if err := dev.InitiateHandshake(t.config.PeerPublicKey); err != nil {
+		slog.Debug("failed to initiate handshake", "error", err)
+	}
+	slog.Debug("waiting for handshake", "endpoint", t.config.PeerEndpoint, "timeout", t.config.HandshakeTimeout)
+	if err := waitHandshake(ctx, t.config.PeerEndpoint, t.config.HandshakeTimeout, dev.Stats, dev.HandshakeSendError); err != nil {
+		dev.Close()
+		t.device = nil
+		cancel()
+		return err
+	}
+
+	if t.config.AutoMTU && !t.userspace {
+		go watchPathMTU(ctx, *t.config, dev.Stats, dev.TakeSendError, func(mtu int) error {
+			return network.SetLinkMTU(dev.Name(), mtu)
+		})
+	}
+
 	t.connectedAt = time.Now()
 	slog.Info("WireGuard tunnel connected", "server", t.server.Name, "endpoint", t.server.Endpoint)
 	return nil
@@ -112,12 +182,161 @@ func (t *Tunnel) Status() (*tunnel.TunnelStatus, error) {
 				status.LastHandshake = time.Unix(stats.LastHandshake, 0)
 			}
 		}
+		status.HandshakePending = t.handshakes.pending(status.LastHandshake, status.TxBytes)
 		status.InterfaceName = t.device.Name()
 	}
+	status.Userspace = t.userspace
 
 	return status, nil
 }
 
+// DialContext opens a connection through the tunnel, resolving names with the
+// server's DNS. In userspace mode it uses the netstack; otherwise the host's
+// routes already send the traffic through the TUN interface.
+func (t *Tunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if t.userspace {
+		if t.net == nil {
+			return nil, fmt.Errorf("tunnel is not connected")
+		}
+		return t.net.DialContext(ctx, network, address)
+	}
+	d := net.Dialer{Resolver: serverResolver(t.config.DNS)}
+	return d.DialContext(ctx, network, address)
+}
+
+// Listen accepts TCP connections on a tunnel address. In userspace mode the
+// listener lives on the netstack; otherwise it binds the TUN interface address.
+func (t *Tunnel) Listen(network, address string) (net.Listener, error) {
+	if !t.userspace {
+		return net.Listen(network, address)
+	}
+	addr, err := t.netstackAddr(network, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return t.net.ListenTCPAddrPort(addr)
+}
+
+// ListenPacket is the UDP counterpart of Listen.
+func (t *Tunnel) ListenPacket(network, address string) (net.PacketConn, error) {
+	if !t.userspace {
+		return net.ListenPacket(network, address)
+	}
+	addr, err := t.netstackAddr(network, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return t.net.ListenUDPAddrPort(addr)
+}
+
+func (t *Tunnel) netstackAddr(network, want, address string) (netip.AddrPort, error) {
+	if t.net == nil {
+		return netip.AddrPort{}, fmt.Errorf("tunnel is not connected")
+	}
+	if !strings.HasPrefix(network, want) {
+		return netip.AddrPort{}, fmt.Errorf("unsupported network %q", network)
+	}
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid tunnel address %q: %w", address, err)
+	}
+	return addr, nil
+}
+
+// serverResolver returns a resolver that queries the first of the tunnel's DNS
+// servers, or nil (the system resolver) if none is configured.
+func serverResolver(servers []string) *net.Resolver {
+	for _, s := range servers {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		server := netip.AddrPortFrom(addr, 53).String()
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return nil
+}
+
+// createNetstackTUN builds a userspace TUN from the tunnel's addresses and DNS.
+func createNetstackTUN(cfg *TunnelConfig) (tun.Device, *netstack.Net, error) {
+	var addrs []netip.Addr
+	for _, a := range strings.Split(cfg.Address, ",") {
+		prefix, err := ParseAddress(strings.TrimSpace(a))
+		if err != nil {
+			return nil, nil, err
+		}
+		addrs = append(addrs, prefix.Addr())
+	}
+	var dns []netip.Addr
+	for _, s := range cfg.DNS {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid DNS server %q: %w", s, err)
+		}
+		dns = append(dns, addr)
+	}
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = 1420
+	}
+	return netstack.CreateNetTUN(addrs, dns, mtu)
+}
+
+// AllowPrefix lets the peer carry traffic for prefix, which WireGuard's
+// cryptokey routing would otherwise drop. Used for domain-based routes.
+func (t *Tunnel) AllowPrefix(prefix netip.Prefix) error {
+	if t.device == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+	t.prefixMu.Lock()
+	defer t.prefixMu.Unlock()
+	if err := t.device.AddAllowedIPs(t.config.PeerPublicKey, []netip.Prefix{prefix}); err != nil {
+		return err
+	}
+	if t.prefixes == nil {
+		t.prefixes = make(map[netip.Prefix]bool)
+	}
+	t.prefixes[prefix] = true
+	return nil
+}
+
+// RemovePrefix undoes AllowPrefix. The peer's AllowedIPs are rebuilt from
+// the configured ones and the prefixes still allowed.
+func (t *Tunnel) RemovePrefix(prefix netip.Prefix) error {
+	if t.device == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+	t.prefixMu.Lock()
+	defer t.prefixMu.Unlock()
+	if !t.prefixes[prefix] {
+		return nil
+	}
+	delete(t.prefixes, prefix)
+	allowed, err := peerAllowedIPs(t.config, t.prefixes)
+	if err != nil {
+		return err
+	}
+	return t.device.ReplaceAllowedIPs(t.config.PeerPublicKey, allowed)
+}
+
+// ServeUAPI exposes the device on the standard UAPI socket. Userspace
+// tunnels have no host interface for tools to address, so they have none.
+func (t *Tunnel) ServeUAPI() (io.Closer, error) {
+	if t.device == nil {
+		return nil, fmt.Errorf("tunnel is not connected")
+	}
+	if t.userspace {
+		return nil, fmt.Errorf("UAPI socket is not available in userspace mode")
+	}
+	return t.device.ServeUAPI()
+}
+
 func (t *Tunnel) IsActive() bool {
 	return t.device != nil
 }
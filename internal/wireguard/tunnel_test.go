@@ -1,8 +1,16 @@
 package wireguard
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+
 	"github.com/voidvpn/voidvpn/internal/config"
 )
 
@@ -12,7 +20,7 @@ func TestNewTunnelFieldMapping(t *testing.T) {
 		Address:             "10.0.0.2/24",
 		DNS:                 []string{"8.8.8.8", "1.1.1.1"},
 		MTU:                 1420,
-		PublicKey:            "testpubkey",
+		PublicKey:           "testpubkey",
 		Endpoint:            "vpn.example.com:51820",
 		AllowedIPs:          []string{"0.0.0.0/0", "::/0"},
 		PresharedKey:        "testpsk",
@@ -92,3 +100,159 @@ func TestTunnelDisconnectNilDevice(t *testing.T) {
 		t.Errorf("Disconnect() with nil device should not error: %v", err)
 	}
 }
+
+func TestNewUserspaceTunnel(t *testing.T) {
+	serverCfg := &config.ServerConfig{
+		Name:            "test-server",
+		Address:         "10.0.0.2/24",
+		RoutingStrategy: "policy",
+	}
+	tun := NewUserspaceTunnel(serverCfg, "testprivkey")
+	if !tun.userspace {
+		t.Error("NewUserspaceTunnel should enable userspace mode")
+	}
+	tun.SetFwMark(51820)
+	if tun.config.FwMark != 0 {
+		t.Errorf("FwMark = %d, want 0 in userspace mode", tun.config.FwMark)
+	}
+	if _, err := tun.DialContext(context.Background(), "tcp", "10.0.0.1:80"); err == nil {
+		t.Error("DialContext should fail before Connect")
+	}
+	status, _ := tun.Status()
+	if !status.Userspace {
+		t.Error("Status().Userspace should be true")
+	}
+}
+
+func TestCreateNetstackTUN(t *testing.T) {
+	dev, tnet, err := createNetstackTUN(&TunnelConfig{
+		Address: "10.0.0.2/24, fd00::2/64",
+		DNS:     []string{"10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("createNetstackTUN() error: %v", err)
+	}
+	defer dev.Close()
+	if tnet == nil {
+		t.Fatal("createNetstackTUN() returned nil Net")
+	}
+	if mtu, _ := dev.MTU(); mtu != 1420 {
+		t.Errorf("MTU = %d, want default 1420", mtu)
+	}
+
+	if _, _, err := createNetstackTUN(&TunnelConfig{Address: "10.0.0.2/24", DNS: []string{"not-an-ip"}}); err == nil {
+		t.Error("createNetstackTUN should reject invalid DNS servers")
+	}
+}
+
+func TestUserspaceListen(t *testing.T) {
+	dev, tnet, err := createNetstackTUN(&TunnelConfig{Address: "10.0.0.2/24"})
+	if err != nil {
+		t.Fatalf("createNetstackTUN() error: %v", err)
+	}
+	defer dev.Close()
+	tun := &Tunnel{userspace: true, net: tnet}
+
+	ln, err := tun.Listen("tcp", "10.0.0.2:8080")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	ln.Close()
+
+	pc, err := tun.ListenPacket("udp", "10.0.0.2:5353")
+	if err != nil {
+		t.Fatalf("ListenPacket() error: %v", err)
+	}
+	pc.Close()
+
+	if _, err := tun.Listen("udp", "10.0.0.2:8080"); err == nil {
+		t.Error("Listen should reject non-TCP networks")
+	}
+	if _, err := tun.Listen("tcp", "not-an-address"); err == nil {
+		t.Error("Listen should reject invalid addresses")
+	}
+}
+
+// startPeer runs a wireguard-go peer at 10.0.0.1 on a netstack that accepts
+// clientPub, and returns its public key, UDP endpoint and network stack.
+func startPeer(t *testing.T, clientPub string) (string, string, *netstack.Net) {
+	t.Helper()
+	keys, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	tunDev, tnet, err := createNetstackTUN(&TunnelConfig{Address: "10.0.0.1/24"})
+	if err != nil {
+		t.Fatalf("createNetstackTUN() error: %v", err)
+	}
+	dev, err := NewDevice(tunDev, device.NewLogger(device.LogLevelSilent, ""))
+	if err != nil {
+		t.Fatalf("NewDevice() error: %v", err)
+	}
+	t.Cleanup(dev.Close)
+	privHex, _ := keyToHex(keys.PrivateKey)
+	pubHex, _ := keyToHex(clientPub)
+	if err := dev.dev.IpcSet(fmt.Sprintf("private_key=%s\nlisten_port=0\npublic_key=%s\nallowed_ip=10.0.0.2/32\n", privHex, pubHex)); err != nil {
+		t.Fatalf("IpcSet() error: %v", err)
+	}
+	if err := dev.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	ipc, _ := dev.dev.IpcGet()
+	var port int
+	for _, line := range strings.Split(ipc, "\n") {
+		if strings.HasPrefix(line, "listen_port=") {
+			port, _ = strconv.Atoi(strings.TrimPrefix(line, "listen_port="))
+		}
+	}
+	return keys.PublicKey, fmt.Sprintf("127.0.0.1:%d", port), tnet
+}
+
+func TestConnectWaitsForHandshake(t *testing.T) {
+	client, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	serverPub, endpoint, _ := startPeer(t, client.PublicKey)
+
+	tun := NewUserspaceTunnel(&config.ServerConfig{
+		Name:             "test",
+		Endpoint:         endpoint,
+		PublicKey:        serverPub,
+		Address:          "10.0.0.2/24",
+		AllowedIPs:       []string{"10.0.0.0/24"},
+		HandshakeTimeout: 5,
+	}, client.PrivateKey)
+	if err := tun.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer tun.Disconnect()
+	status, _ := tun.Status()
+	if status.LastHandshake.IsZero() || status.HandshakePending {
+		t.Errorf("handshake not reported after Connect: %+v", status)
+	}
+}
+
+func TestConnectHandshakeNoResponse(t *testing.T) {
+	client, _ := GenerateKeyPair()
+	stranger, _ := GenerateKeyPair()
+	// The peer only accepts stranger, so it ignores our initiations
+	serverPub, endpoint, _ := startPeer(t, stranger.PublicKey)
+
+	tun := NewUserspaceTunnel(&config.ServerConfig{
+		Name:             "test",
+		Endpoint:         endpoint,
+		PublicKey:        serverPub,
+		Address:          "10.0.0.2/24",
+		AllowedIPs:       []string{"10.0.0.0/24"},
+		HandshakeTimeout: 1,
+	}, client.PrivateKey)
+	err := tun.Connect(context.Background())
+	var hsErr *HandshakeError
+	if !errors.As(err, &hsErr) || hsErr.Reason != HandshakeNoResponse {
+		t.Fatalf("Connect() error = %v, want no response", err)
+	}
+	if tun.IsActive() {
+		t.Error("tunnel should not be active after a failed handshake")
+	}
+}
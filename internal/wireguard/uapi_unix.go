@@ -0,0 +1,20 @@
+//go:build !windows
+
+package wireguard
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// listenUAPI creates /var/run/wireguard/<name>.sock. The socket file is
+// unlinked when the listener is closed.
+func listenUAPI(name string) (net.Listener, error) {
+	file, err := ipc.UAPIOpen(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ipc.UAPIListen(name, file)
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package wireguard
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+func TestServeUAPI(t *testing.T) {
+	tunDev, _, err := createNetstackTUN(&TunnelConfig{Address: "10.0.0.2/24"})
+	if err != nil {
+		t.Fatalf("createNetstackTUN() error: %v", err)
+	}
+	dev, err := NewDevice(tunDev, device.NewLogger(device.LogLevelSilent, ""))
+	if err != nil {
+		t.Fatalf("NewDevice() error: %v", err)
+	}
+	defer dev.Close()
+	dev.name = "voidvpn-uapitest"
+
+	ln, err := dev.ServeUAPI()
+	if err != nil {
+		t.Skipf("UAPI socket unavailable: %v", err)
+	}
+	sock := "/var/run/wireguard/voidvpn-uapitest.sock"
+
+	conn, err := net.DialTimeout("unix", sock, time.Second)
+	if err != nil {
+		ln.Close()
+		t.Fatalf("dial UAPI socket: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("get=1\n\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var resp strings.Builder
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read: %v (got %q)", err, resp.String())
+		}
+		if line == "\n" {
+			break
+		}
+		resp.WriteString(line)
+	}
+	conn.Close()
+	if !strings.Contains(resp.String(), "errno=0") {
+		t.Errorf("UAPI get response = %q, want errno=0", resp.String())
+	}
+
+	ln.Close()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket should be removed on close, stat error = %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package wireguard
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// listenUAPI creates the \\.\pipe\ProtectedPrefix\Administrators\WireGuard\<name>
+// named pipe used by wg.exe.
+func listenUAPI(name string) (net.Listener, error) {
+	return ipc.UAPIListen(name)
+}